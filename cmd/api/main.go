@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"os"
+	"os/signal"
 	app2 "storages-api/internal/app"
 	"storages-api/internal/config"
 	"storages-api/internal/infra/filesystem"
+	"storages-api/internal/infra/logstream"
 	"storages-api/internal/infra/transport/http/handlers"
 	"storages-api/internal/infra/transport/http/middleware"
+	"syscall"
 
 	"time"
 
@@ -17,10 +23,23 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 )
 
+const uploadBodyLimit = 100 * 1024 * 1024 // 100MB max upload
+
 func main() {
+	// Route stdout/log output through an in-memory hub for /api/logs/stream
+	logHub := logstream.NewHub(1000)
+	if err := logstream.CaptureStdout(logHub); err != nil {
+		log.Printf("Warning: log streaming disabled: %v", err)
+	}
+
 	// Load Config
 	cfg := config.LoadConfig()
 
+	// Loud startup checks; STRICT_CONFIG turns them into a refusal to start
+	if err := cfg.CheckStartup(); err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Printf("DEBUG: Loaded %d storage mounts\n", len(cfg.StorageMounts))
 	for k, v := range cfg.StorageMounts {
 		fmt.Printf("DEBUG: Storage [%s] -> Path [%s]\n", k, v)
@@ -29,8 +48,9 @@ func main() {
 	// Init Fiber App
 	app := fiber.New(fiber.Config{
 		AppName:      "Storage API File Manager v1",
-		BodyLimit:    100 * 1024 * 1024, // 100MB max upload
+		BodyLimit:    uploadBodyLimit,
 		ServerHeader: "StorageAPI",
+		ErrorHandler: handlers.ErrorHandler,
 	})
 
 	// Middleware
@@ -38,55 +58,40 @@ func main() {
 		c.Locals("startTime", time.Now())
 		return c.Next()
 	})
-	app.Use(logger.New())
+	if cfg.SlowRequestMs > 0 {
+		// Quiet mode: only requests over the threshold are logged
+		app.Use(middleware.SlowRequestLogger(time.Duration(cfg.SlowRequestMs) * time.Millisecond))
+	} else {
+		app.Use(logger.New(logger.Config{
+			Output: os.Stdout, // the captured stdout, not the one bound at package init
+			// Default format plus the caller ("guest" for the guest token)
+			Format: "${time} | ${status} | ${latency} | ${ip} | ${locals:username} | ${method} | ${path} | ${error}\n",
+		}))
+	}
+	app.Use(middleware.ServerTiming(cfg.ServerTimingEnabled))
 	app.Use(compress.New(compress.Config{
 		Level: compress.LevelBestSpeed, // Optimize for speed
 	}))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,PUT,DELETE",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Checksum-SHA256",
 	}))
 
 	// Init Dependencies
 	driver := filesystem.NewLocalDriver(cfg.StorageMounts)
-	service := app2.NewFilesystemService(driver)
-	fileHandler := handlers.NewFileManagerHandler(service)
-	authHandler := handlers.NewAuthHandler(cfg)
-
-	// Routes
-	api := app.Group("/api")
-
-	// Public - only login is public
-	api.Post("/login", authHandler.Login)
-
-	// Protected - all file operations require auth
-	protected := api.Use(middleware.AuthMiddleware(cfg))
-
-	// READ
-	protected.Get("/files", fileHandler.ListFiles)       // List files/folders
-	protected.Get("/preview", fileHandler.PreviewFile)   // Preview file (inline)
-	protected.Get("/download", fileHandler.DownloadFile) // Download file (force download)
-
-	// CREATE
-	protected.Post("/folder", fileHandler.CreateFolder) // Create new folder
-	protected.Post("/upload", fileHandler.UploadFile)   // Upload file
-
-	// UPDATE
-	protected.Put("/rename", fileHandler.RenameOrMove)  // Rename or move file/folder
-	protected.Post("/copy", fileHandler.Copy)           // Copy file/folder
-	protected.Post("/duplicate", fileHandler.Duplicate) // Duplicate file/folder
-
-	// DELETE
-	protected.Delete("/delete", fileHandler.Delete) // Delete file/folder
-
-	protected.Get("/search", fileHandler.SearchFiles)
-	protected.Get("/recent", fileHandler.GetRecent)
-	protected.Get("/reindex", fileHandler.Reindex)
-	protected.Post("/stats", fileHandler.GetStats)
-
-	// Root endpoint - List available storages (also protected)
-	protected.Get("/", fileHandler.ListStorages)
+	driver.SetMountInfo(cfg.MountInfoEnabled)
+	driver.SetWriteModes(cfg.UploadFileMode, cfg.UploadDirMode)
+	driver.SetSpaceMargin(cfg.MinFreeSpacePercent)
+	driver.SetReadDirWorkers(cfg.ReadDirWorkers)
+	service := app2.NewFilesystemService(driver, cfg)
+	// A password reset through /api/admin/users ends the refresh tokens issued before it
+	cfg.Users.OnChange(func(name string) {
+		if err := service.RevokeRefreshTokens(name); err != nil {
+			log.Printf("Warning: failed to revoke refresh tokens of %s: %v", name, err)
+		}
+	})
+	mountRoutes(app, cfg, service, driver, logHub)
 
 	// Health check
 	app.Get("/ping", func(c *fiber.Ctx) error {
@@ -95,16 +100,80 @@ func main() {
 		return c.JSON(fiber.Map{
 			"status":  "ok",
 			"latency": latency,
-			"mounts":  cfg.StorageMounts,
+			"mounts":  driver.MountsSnapshot(),
+			"tools":   service.Tools(),
 			"message": "pong",
 		})
 	})
 
 	// Start Server
-	fmt.Printf("Server running on port %s\n", cfg.Port)
+	if cfg.ListenSocket != "" {
+		fmt.Printf("Server listening on unix socket %s\n", cfg.ListenSocket)
+	} else {
+		fmt.Printf("Server running on port %s\n", cfg.Port)
+	}
 	fmt.Printf("Managing %d storage(s):\n", len(cfg.StorageMounts))
 	for name, path := range cfg.StorageMounts {
 		fmt.Printf("   - %s: %s\n", name, path)
 	}
-	log.Fatal(app.Listen(":" + cfg.Port))
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if cfg.ListenSocket == "" {
+			serverErr <- app.Listen(":" + cfg.Port)
+			return
+		}
+		ln, err := listenUnix(cfg.ListenSocket, cfg.ListenSocketMode)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		serverErr <- app.Listener(ln)
+	}()
+
+	// Graceful shutdown: finish in-flight requests, then clean up the socket
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-quit:
+	}
+
+	fmt.Println("Shutting down...")
+	if err := app.ShutdownWithTimeout(30 * time.Second); err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
+	if cfg.ListenSocket != "" {
+		os.Remove(cfg.ListenSocket)
+	}
+}
+
+// listenUnix binds a unix socket, replacing a stale socket file left by a
+// previous run but refusing to touch a live socket or a regular file.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
 }
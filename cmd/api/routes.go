@@ -0,0 +1,130 @@
+package main
+
+import (
+	app2 "storages-api/internal/app"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/filesystem"
+	"storages-api/internal/infra/logstream"
+	"storages-api/internal/infra/transport/http/handlers"
+	"storages-api/internal/infra/transport/http/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mountRoutes registers the /api routes on app, leaving out the
+// DISABLED_ENDPOINTS groups
+func mountRoutes(app *fiber.App, cfg *config.Config, service *app2.FilesystemService, driver *filesystem.LocalDriver, logHub *logstream.Hub) {
+	fileHandler := handlers.NewFileManagerHandler(service)
+	authHandler := handlers.NewAuthHandler(cfg, service)
+	logsHandler := handlers.NewLogsHandler(logHub)
+	manifestHandler := handlers.NewManifestHandler(cfg, service, uploadBodyLimit)
+
+	// Routes
+	api := app.Group("/api")
+
+	// Public - login, token refresh and the capability manifest
+	api.Post("/login", authHandler.Login)
+	api.Post("/refresh", authHandler.Refresh)
+	api.Get("/manifest", middleware.OptionalAuth(cfg, middleware.AuthMiddleware(cfg, service.TokenRevoked)), manifestHandler.Manifest)
+
+	// Protected - all file operations require auth
+	// and restricted users only see the storages they are allowed
+	protected := api.Use(middleware.AuthMiddleware(cfg, service.TokenRevoked), middleware.StorageACL(cfg),
+		middleware.RequireStorages(func() int { return len(driver.StorageNames()) }))
+
+	protected.Post("/logout", authHandler.Logout) // Revoke the current token
+
+	// READ
+	protected.Get("/files", fileHandler.ListFiles)            // List files/folders
+	protected.Post("/prefetch", fileHandler.Prefetch)         // Warm the listing cache for a subtree
+	protected.Get("/stat", fileHandler.Stat)                  // Single file/folder metadata
+	protected.Get("/exists", fileHandler.Exists)              // Does a path exist (no symlink follow)
+	protected.Get("/mtime", fileHandler.LatestModified)       // Latest modtime under a folder
+	protected.Get("/preview", fileHandler.PreviewFile)        // Preview file (inline)
+	protected.Get("/download", fileHandler.DownloadFile)      // Download file (force download)
+	protected.Get("/download/zip", fileHandler.DownloadZip)   // Folder as a ZIP streamed on the fly
+	protected.Get("/thumb", fileHandler.Thumb)                // Cached image/video thumbnail
+	protected.Get("/contactsheet", fileHandler.ContactSheet)  // Video frame grid
+	protected.Get("/dimensions", fileHandler.ImageDimensions) // Image width/height from the header
+	protected.Get("/checksum", fileHandler.Checksum)          // File hash with a selectable algorithm
+	protected.Get("/dataurl", fileHandler.DataURL)            // Small file as a base64 data: URL
+	protected.Post("/estimate", fileHandler.Estimate)         // Bytes/files of a copy or move vs. free space
+
+	// ARCHIVES (read-through, nothing is extracted to disk)
+	protected.Get("/archive/list", fileHandler.ArchiveList)              // Entries of a ZIP
+	protected.Get("/archive/extract-one", fileHandler.ArchiveExtractOne) // Stream one entry of a ZIP
+
+	// CREATE (not for read-only guests). DISABLED_ENDPOINTS groups are not
+	// mounted at all, so their routes answer 404
+	writer := middleware.RequireWriter(cfg)
+	if cfg.EndpointEnabled("write") {
+		protected.Post("/folder", writer, fileHandler.CreateFolder) // Create new folder
+		protected.Post("/file", writer, fileHandler.CreateFile)     // Create an empty file
+	}
+	if cfg.EndpointEnabled("upload") {
+		protected.Post("/upload", writer, fileHandler.UploadFile) // Upload file
+		// Chunked uploads for files over the body limit, resumable per chunk
+		protected.Post("/upload/init", writer, fileHandler.InitUpload)
+		protected.Post("/upload/chunk", writer, fileHandler.UploadChunk)
+		protected.Get("/upload/status", writer, fileHandler.UploadStatus)
+		protected.Post("/upload/complete", writer, fileHandler.CompleteUpload)
+		protected.Post("/upload/abort", writer, fileHandler.AbortUpload)
+		protected.Post("/fetch", writer, fileHandler.FetchRemote) // Download a remote URL into storage
+	}
+
+	// UPDATE
+	if cfg.EndpointEnabled("write") {
+		protected.Put("/rename", writer, fileHandler.RenameOrMove)  // Rename or move file/folder
+		protected.Post("/move", writer, fileHandler.MoveFiles)      // Move several files into a folder
+		protected.Post("/copy", writer, fileHandler.Copy)           // Copy file/folder
+		protected.Post("/duplicate", writer, fileHandler.Duplicate) // Duplicate file/folder
+		protected.Post("/swap", writer, fileHandler.Swap)           // Exchange two paths atomically
+		protected.Put("/describe", writer, fileHandler.Describe)    // Set or clear a file's note
+		protected.Post("/touch", writer, fileHandler.Touch)         // Set modification times
+		protected.Post("/extract", writer, fileHandler.Extract)     // Unpack a ZIP into a folder
+	}
+
+	// DELETE
+	if cfg.EndpointEnabled("delete") {
+		protected.Delete("/delete", writer, fileHandler.Delete)            // Delete file/folder (or move it to the trash)
+		protected.Post("/delete/batch", writer, fileHandler.DeleteBatch)   // Delete several paths, per-path results
+		protected.Get("/trash", fileHandler.ListTrash)                     // Trashed items, newest first
+		protected.Post("/trash/restore", writer, fileHandler.RestoreTrash) // Move a trashed item back
+		protected.Delete("/trash", writer, fileHandler.PurgeTrash)         // Empty the trash or drop one entry
+	}
+
+	// Transactions can both write and delete
+	if cfg.EndpointEnabled("write") && cfg.EndpointEnabled("delete") {
+		protected.Post("/transaction", writer, fileHandler.Transaction) // Ordered steps with best-effort rollback
+	}
+
+	if cfg.EndpointEnabled("search") {
+		protected.Get("/search", middleware.RateLimit(cfg.RateSearchPerMin), fileHandler.SearchFiles)
+		protected.Get("/category", fileHandler.ListCategory)
+		protected.Get("/count", fileHandler.CountFiles)
+		protected.Get("/recent", fileHandler.GetRecent)
+		protected.Get("/changes", fileHandler.Changes)
+		protected.Get("/duplicates", fileHandler.FindDuplicates)
+		protected.Get("/composition", fileHandler.Composition)
+	}
+	if cfg.EndpointEnabled("reindex") {
+		protected.Get("/reindex", writer, middleware.RateLimit(cfg.RateReindexPerMin), fileHandler.Reindex)
+	}
+	protected.Get("/index/status", fileHandler.IndexStatus)
+	protected.Post("/stats", middleware.RateLimit(cfg.RateStatsPerMin), fileHandler.GetStats)
+
+	// ADMIN
+	protected.Get("/logs/stream", middleware.RequireAdmin(), logsHandler.Stream)              // Live server logs (SSE)
+	protected.Post("/storages", middleware.RequireAdmin(), fileHandler.AddStorage)            // Register a mount
+	protected.Post("/admin/users", middleware.RequireAdmin(), authHandler.AddUser)            // Add a login or reset its password
+	protected.Delete("/storages/:name", middleware.RequireAdmin(), fileHandler.RemoveStorage) // Unregister a mount
+	if cfg.EndpointEnabled("reindex") {
+		protected.Post("/index/optimize", middleware.RequireAdmin(), fileHandler.OptimizeIndex) // VACUUM + ANALYZE the index
+	}
+
+	protected.Get("/storages/:name/settings", middleware.RequireAdmin(), fileHandler.StorageSettings)       // Effective per-storage settings
+	protected.Put("/storages/:name/settings", middleware.RequireAdmin(), fileHandler.UpdateStorageSettings) // Override them at runtime
+
+	// Root endpoint - List available storages (also protected)
+	protected.Get("/", fileHandler.ListStorages)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	app2 "storages-api/internal/app"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/filesystem"
+	"storages-api/internal/infra/logstream"
+	"storages-api/internal/infra/transport/http/handlers"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testGuestToken = "guest-secret"
+
+// testRoutes mounts the routes like main does over one storage "ssd". Calls
+// use the guest token, so mounted write routes stop at 403 before doing anything.
+func testRoutes(t *testing.T, disabled ...string) *fiber.App {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "ssd")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StorageMounts:        map[string]string{"ssd": root},
+		StorageOptions:       map[string]config.StorageOptions{},
+		JwtSecret:            "test-secret",
+		GuestToken:           testGuestToken,
+		Users:                config.NewUserStore(filepath.Join(dir, "users.json"), nil),
+		IndexDBPath:          filepath.Join(dir, "index.db"),
+		IndexIntervalMinutes: 60,
+		ThumbCacheDir:        filepath.Join(dir, "thumbs"),
+		UploadChunkDir:       filepath.Join(dir, "chunks"),
+		ReadDirWorkers:       4,
+		DisabledEndpoints:    map[string]bool{},
+	}
+	for _, group := range disabled {
+		cfg.DisabledEndpoints[group] = true
+	}
+	driver := filesystem.NewLocalDriver(cfg.StorageMounts)
+	service := app2.NewFilesystemService(driver, cfg)
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	mountRoutes(app, cfg, service, driver, logstream.NewHub(10))
+	return app
+}
+
+func call(t *testing.T, app *fiber.App, method, url string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, url, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testGuestToken)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, body
+}
+
+func TestDisabledEndpointsAreNotMounted(t *testing.T) {
+	// Each route with the groups that unmount it
+	routes := []struct {
+		groups      []string
+		method, url string
+	}{
+		{[]string{"write"}, "POST", "/api/folder"},
+		{[]string{"write"}, "PUT", "/api/rename"},
+		{[]string{"upload"}, "POST", "/api/upload"},
+		{[]string{"upload"}, "POST", "/api/upload/init"},
+		{[]string{"delete"}, "DELETE", "/api/delete"},
+		{[]string{"write", "delete"}, "POST", "/api/transaction"},
+		{[]string{"search"}, "GET", "/api/search?q=x"},
+		{[]string{"search"}, "GET", "/api/recent"},
+		{[]string{"reindex"}, "GET", "/api/reindex"},
+		{[]string{"reindex"}, "POST", "/api/index/optimize"},
+	}
+
+	enabled := testRoutes(t)
+	for _, r := range routes {
+		if status, body := call(t, enabled, r.method, r.url); status == 404 {
+			t.Errorf("%s %s with nothing disabled: 404 %s", r.method, r.url, body)
+		}
+	}
+
+	for _, group := range config.EndpointGroups {
+		app := testRoutes(t, group)
+		for _, r := range routes {
+			status, body := call(t, app, r.method, r.url)
+			off := slices.Contains(r.groups, group)
+			if off && status != 404 {
+				t.Errorf("%s disabled: %s %s = %d, want 404", group, r.method, r.url, status)
+			}
+			if !off && status == 404 {
+				t.Errorf("%s disabled: %s %s = 404 %s", group, r.method, r.url, body)
+			}
+		}
+	}
+}
+
+func TestIndexStatusDoesNotScanWithReindexDisabled(t *testing.T) {
+	app := testRoutes(t, "reindex")
+	status, body := call(t, app, "GET", "/api/index/status")
+	if status != 200 {
+		t.Fatalf("index status: %d %s", status, body)
+	}
+	var resp struct {
+		Storages []struct {
+			Storage  string `json:"storage"`
+			Indexed  bool   `json:"indexed"`
+			Scanning bool   `json:"scanning"`
+		} `json:"storages"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Storages) != 1 || resp.Storages[0].Indexed || resp.Storages[0].Scanning {
+		t.Errorf("index status = %s, want ssd neither indexed nor scanning", body)
+	}
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"net/url"
+	"strings"
+)
+
+// AccelRedirectPath maps a file to the internal nginx location that serves
+// it: ACCEL_REDIRECT_PREFIX + "/<storage>/<path>", each segment escaped. nginx
+// needs one internal location per storage aliasing the mount root. The second
+// return value is false when offloading is disabled.
+func (s *FilesystemService) AccelRedirectPath(storage, path string) (string, bool) {
+	prefix := strings.TrimRight(s.cfg.AccelRedirectPrefix, "/")
+	if prefix == "" {
+		return "", false
+	}
+
+	// Use the configured spelling of the storage name so locations match
+	name := storage
+	for _, n := range s.StorageNames() {
+		if strings.EqualFold(n, storage) {
+			name = n
+			break
+		}
+	}
+
+	segments := []string{prefix, url.PathEscape(name)}
+	if p := indexPath(path); p != "" {
+		for _, seg := range strings.Split(p, "/") {
+			segments = append(segments, url.PathEscape(seg))
+		}
+	}
+	return strings.Join(segments, "/"), true
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"storages-api/internal/domain"
+	"strings"
+)
+
+// Read-through access to ZIP archives: list the central directory or stream
+// one entry, without extracting anything to disk.
+
+var (
+	// ErrNotArchive is returned for files that aren't readable ZIP archives
+	ErrNotArchive = errors.New("unsupported_archive")
+	// ErrEntryNotFound is returned when the archive has no such entry
+	ErrEntryNotFound = errors.New("entry_not_found")
+	// ErrEntryTooLarge is returned when an entry decompresses past ARCHIVE_ENTRY_MAX_MB
+	ErrEntryTooLarge = errors.New("entry_too_large")
+)
+
+func (s *FilesystemService) openZip(storage, p string) (*zip.ReadCloser, error) {
+	realPath, err := s.driver.GetRealPath(storage, p)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(realPath)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) {
+			return nil, fmt.Errorf("%w: %v", ErrNotArchive, err)
+		}
+		return nil, err
+	}
+	return zr, nil
+}
+
+// ArchiveEntries lists a ZIP's entries from its central directory
+func (s *FilesystemService) ArchiveEntries(storage, p string) ([]domain.ArchiveEntry, error) {
+	zr, err := s.openZip(storage, p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	entries := make([]domain.ArchiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		entries = append(entries, archiveEntry(f))
+	}
+	return entries, nil
+}
+
+func archiveEntry(f *zip.File) domain.ArchiveEntry {
+	return domain.ArchiveEntry{
+		Name:           f.Name,
+		Size:           int64(f.UncompressedSize64),
+		CompressedSize: int64(f.CompressedSize64),
+		ModTime:        f.Modified,
+		IsDir:          f.FileInfo().IsDir(),
+	}
+}
+
+// cleanEntryName rejects entry names that are absolute or climb out of the
+// archive root; they are only looked up, but such names are never legitimate
+func cleanEntryName(name string) (string, bool) {
+	if name == "" || strings.Contains(name, "\\") || strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	return path.Clean(name), true
+}
+
+// archiveEntryReader streams one entry and closes the archive with it
+type archiveEntryReader struct {
+	entry     io.ReadCloser
+	zr        *zip.ReadCloser
+	remaining int64
+}
+
+// Read stops with ErrEntryTooLarge once the cap is passed, whatever the
+// entry's header claims
+func (r *archiveEntryReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		var probe [1]byte
+		if n, _ := r.entry.Read(probe[:]); n > 0 {
+			return 0, ErrEntryTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.entry.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func (r *archiveEntryReader) Close() error {
+	r.entry.Close()
+	return r.zr.Close()
+}
+
+// OpenArchiveEntry streams the decompressed bytes of one file entry
+func (s *FilesystemService) OpenArchiveEntry(storage, p, name string) (io.ReadCloser, domain.ArchiveEntry, error) {
+	name, ok := cleanEntryName(name)
+	if !ok {
+		return nil, domain.ArchiveEntry{}, fmt.Errorf("%w: invalid entry name", ErrEntryNotFound)
+	}
+	zr, err := s.openZip(storage, p)
+	if err != nil {
+		return nil, domain.ArchiveEntry{}, err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name || f.FileInfo().IsDir() {
+			continue
+		}
+		limit := s.cfg.ArchiveEntryMaxBytes
+		if int64(f.UncompressedSize64) > limit {
+			zr.Close()
+			return nil, domain.ArchiveEntry{}, fmt.Errorf("%w: %d bytes, limit %d", ErrEntryTooLarge, f.UncompressedSize64, limit)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			zr.Close()
+			return nil, domain.ArchiveEntry{}, fmt.Errorf("%w: %v", ErrNotArchive, err)
+		}
+		return &archiveEntryReader{entry: rc, zr: zr, remaining: limit}, archiveEntry(f), nil
+	}
+	zr.Close()
+	return nil, domain.ArchiveEntry{}, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+}
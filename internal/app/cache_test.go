@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"storages-api/internal/domain"
+	"sync"
+	"testing"
+)
+
+func TestSetCacheAfterInvalidationIsDropped(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	gen := s.cacheGeneration("ssd")
+	s.invalidateStorage("ssd")
+	s.setCache("ssd", "ssd:/:false:", gen, []domain.FileInfo{{Name: "stale.txt"}})
+	if files, hit := s.getCache("ssd:/:false:"); hit {
+		t.Errorf("listing produced before the invalidation was cached: %v", files)
+	}
+
+	// Other storages keep their generation
+	gen = s.cacheGeneration("hdd")
+	s.invalidateStorage("ssd")
+	s.setCache("hdd", "hdd:/:false:", gen, []domain.FileInfo{{Name: "fresh.txt"}})
+	if _, hit := s.getCache("hdd:/:false:"); !hit {
+		t.Error("listing of an untouched storage was dropped")
+	}
+}
+
+// Run with -race: listings and writes of one folder interleave freely, and
+// once the writes are done the cached listing has every file
+func TestCacheInvalidationUnderConcurrentReads(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	const writers, perWriter = 4, 25
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, _, err := s.listDir("ssd", "/", false, ""); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	var writes sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writes.Add(1)
+		go func() {
+			defer writes.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := s.CreateFile("ssd", fmt.Sprintf("/w%d-%d.txt", w, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	writes.Wait()
+	close(stop)
+	readers.Wait()
+
+	files, _, err := s.listDir("ssd", "/", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != writers*perWriter {
+		t.Errorf("listing after the writes has %d files, want %d", len(files), writers*perWriter)
+	}
+}
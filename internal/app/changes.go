@@ -0,0 +1,96 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"storages-api/internal/domain"
+	"strings"
+	"time"
+)
+
+// Delta feed for sync clients: index rows modified after a point, oldest
+// first. The cursor holds the last row's stored modified text and path, so
+// resuming compares exactly what SQLite compares and rows sharing a
+// timestamp are neither repeated nor skipped. Deletions are not reported:
+// the index keeps no record of removed files.
+
+// sqliteTimeFormat is how go-sqlite3 stores time.Time values
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// ErrInvalidCursor is returned for a changes cursor this server didn't issue
+var ErrInvalidCursor = errors.New("invalid_cursor")
+
+func encodeChangesCursor(modified, path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(modified + "\x00" + path))
+}
+
+func decodeChangesCursor(cursor string) (modified, path string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", ErrInvalidCursor
+	}
+	modified, path, ok := strings.Cut(string(raw), "\x00")
+	if !ok {
+		return "", "", ErrInvalidCursor
+	}
+	return modified, path, nil
+}
+
+// Changes returns up to limit files and folders of a storage modified after
+// since (or after the cursor position), in ascending modified, path order.
+// The returned cursor resumes after the last row, both for the next page
+// (hasMore) and for polling later; with no rows it is the cursor passed in.
+func (s *FilesystemService) Changes(storage string, since time.Time, cursor string, limit int) (files []domain.FileInfo, next string, hasMore bool, err error) {
+	if s.db == nil {
+		return nil, "", false, fmt.Errorf("index database unavailable")
+	}
+
+	query := "SELECT name, path, is_dir, size, modified, extension, item_count, CAST(modified AS TEXT), " + descriptionColumn + " FROM files WHERE storage = ?"
+	args := []interface{}{storage}
+	if cursor != "" {
+		modified, path, err := decodeChangesCursor(cursor)
+		if err != nil {
+			return nil, "", false, err
+		}
+		query += " AND (modified > ? OR (modified = ? AND path > ?))"
+		args = append(args, modified, modified, path)
+	} else {
+		query += " AND modified > ?"
+		args = append(args, since.In(time.Local).Format(sqliteTimeFormat))
+	}
+	// One extra row tells whether there is another page
+	query += " ORDER BY modified ASC, path ASC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer rows.Close()
+
+	files = []domain.FileInfo{}
+	next = cursor
+	for rows.Next() {
+		if len(files) == limit {
+			hasMore = true
+			break
+		}
+		var f domain.FileInfo
+		var ext, description sql.NullString
+		var rawModified string
+		if err := rows.Scan(&f.Name, &f.Path, &f.IsDir, &f.Size, &f.ModTime, &ext, &f.ItemCount, &rawModified, &description); err != nil {
+			return nil, "", false, err
+		}
+		f.Extension = ext.String
+		f.Description = description.String
+		f.PreviewType = domain.PreviewTypeFor(ext.String)
+		files = append(files, f)
+		next = encodeChangesCursor(rawModified, f.Path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", false, err
+	}
+	return files, next, hasMore, nil
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"storages-api/internal/domain"
+	"strings"
+)
+
+type indexedHash struct {
+	size     int64
+	modified int64 // unix nano
+	sha256   string
+}
+
+// Add a column to an existing table if an older schema lacks it
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, column) {
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
+func (s *FilesystemService) hashFile(storage, path, algo string) (string, error) {
+	f, err := s.driver.GetFile(storage, path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(algo, f)
+}
+
+// computeHashes returns path -> sha256 for the files worth hashing, and how
+// many of them had to be read.
+// Unchanged files (same size and modtime) keep the stored hash, which uploads
+// record as they write. Otherwise only files sharing their size with another
+// file can be duplicates, so unique sizes are skipped.
+// Files are hashed one at a time to keep the disk load of a scan bounded.
+func (s *FilesystemService) computeHashes(storage string, files []domain.FileInfo) (map[string]string, int) {
+	if !s.cfg.IndexHashEnabled {
+		return nil, 0
+	}
+
+	existing := make(map[string]indexedHash)
+	rows, err := s.db.Query("SELECT path, size, modified, sha256 FROM files WHERE storage = ? AND sha256 IS NOT NULL", storage)
+	if err == nil {
+		for rows.Next() {
+			var path string
+			var e indexedHash
+			var modified sql.NullTime
+			if rows.Scan(&path, &e.size, &modified, &e.sha256) == nil {
+				e.modified = modified.Time.UnixNano()
+				existing[path] = e
+			}
+		}
+		rows.Close()
+	}
+
+	sizeCount := make(map[int64]int)
+	for _, f := range files {
+		if !f.IsDir {
+			sizeCount[f.Size]++
+		}
+	}
+
+	hashes := make(map[string]string)
+	hashed := 0
+	for _, f := range files {
+		if f.IsDir || f.Size == 0 {
+			continue
+		}
+		if e, ok := existing[f.Path]; ok && e.sha256 != "" && e.size == f.Size && e.modified == f.ModTime.UnixNano() {
+			hashes[f.Path] = e.sha256
+			continue
+		}
+		if f.Size > s.cfg.IndexHashMaxBytes || sizeCount[f.Size] < 2 {
+			continue
+		}
+		sum, err := s.hashFile(storage, f.Path, HashSHA256)
+		if err != nil {
+			continue
+		}
+		hashes[f.Path] = sum
+		hashed++
+	}
+	return hashes, hashed
+}
+
+// FindDuplicates groups indexed files by content hash (requires INDEX_HASH_ENABLED).
+// With HARDLINK_DEDUP, names of one hard-linked inode are a single copy: they
+// take no extra space, so they only form a group together with real copies.
+func (s *FilesystemService) FindDuplicates(storage string, limit int) ([]domain.DuplicateGroup, error) {
+	copies := "COUNT(*)"
+	if s.cfg.HardlinkDedup {
+		copies = "COUNT(DISTINCT " + contentKey + ")"
+	}
+	rows, err := s.db.Query(`
+		SELECT sha256, size, `+copies+` AS n
+		FROM files
+		WHERE storage = ? AND is_dir = 0 AND sha256 IS NOT NULL AND sha256 != ''
+		GROUP BY sha256
+		HAVING n > 1
+		ORDER BY size * n DESC
+		LIMIT ?
+	`, storage, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []domain.DuplicateGroup{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var g domain.DuplicateGroup
+		if err := rows.Scan(&g.SHA256, &g.Size, &g.Count); err == nil {
+			index[g.SHA256] = len(groups)
+			groups = append(groups, g)
+		}
+	}
+	rows.Close()
+
+	if len(groups) == 0 {
+		return groups, nil
+	}
+
+	placeholders := make([]string, len(groups))
+	args := []interface{}{storage}
+	for i, g := range groups {
+		placeholders[i] = "?"
+		args = append(args, g.SHA256)
+	}
+	rows, err = s.db.Query("SELECT sha256, path FROM files WHERE storage = ? AND sha256 IN ("+strings.Join(placeholders, ",")+") ORDER BY path", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sum, path string
+		if err := rows.Scan(&sum, &path); err == nil {
+			g := &groups[index[sum]]
+			g.Paths = append(g.Paths, path)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,363 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"storages-api/internal/domain"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Chunked uploads for files too large for one request, or connections too
+// flaky to finish one. A session is a folder under UPLOAD_CHUNK_DIR holding
+// upload.json and one <index>.part per received chunk; everything lives on
+// disk, so a session survives restarts. Chunks may arrive in any order and be
+// re-sent; complete checks that 0..N-1 are all there and streams them in
+// order through the normal upload path (temp file + rename). A session
+// belongs to the user who started it, and the chunks it holds never add up to
+// more than its declared size, or UPLOAD_CHUNKED_MAX_MB when none was given.
+
+const (
+	uploadSessionFile = "upload.json"
+	maxUploadChunks   = 100000
+)
+
+var (
+	// ErrUploadNotFound is returned for an unknown, finished or expired upload id
+	ErrUploadNotFound = errors.New("upload_not_found")
+	// ErrInvalidChunk is returned for a chunk index out of range
+	ErrInvalidChunk = errors.New("invalid_chunk")
+	// ErrUploadIncomplete is returned by CompleteUpload while chunks are missing
+	ErrUploadIncomplete = errors.New("upload_incomplete")
+	// ErrUploadTooLarge is returned for a size over UPLOAD_CHUNKED_MAX_MB, or a
+	// chunk that would take the upload past its size
+	ErrUploadTooLarge = errors.New("upload_too_large")
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// uploadSession is the upload.json of a session
+type uploadSession struct {
+	Storage string    `json:"storage"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"` // expected total, 0 = unknown
+	Created time.Time `json:"created"`
+	Owner   string    `json:"owner"` // username that started the upload
+}
+
+// maxUploadBytes is the most the session's chunks may add up to (0 = no limit)
+func (s *FilesystemService) maxUploadBytes(session uploadSession) int64 {
+	if session.Size > 0 {
+		return session.Size
+	}
+	return s.cfg.UploadChunkedMaxBytes
+}
+
+func (s *FilesystemService) uploadDir(id string) (string, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return "", ErrUploadNotFound
+	}
+	return filepath.Join(s.cfg.UploadChunkDir, id), nil
+}
+
+// loadUploadSession reads a session; other users' sessions are reported as
+// not found
+func (s *FilesystemService) loadUploadSession(id, owner string) (string, uploadSession, error) {
+	var session uploadSession
+	dir, err := s.uploadDir(id)
+	if err != nil {
+		return "", session, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, uploadSessionFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", session, ErrUploadNotFound
+		}
+		return "", session, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return "", session, err
+	}
+	if session.Owner != owner {
+		return "", session, ErrUploadNotFound
+	}
+	return dir, session, nil
+}
+
+// receivedChunks returns the indexes present in a session folder, ascending,
+// and their total size
+func receivedChunks(dir string) ([]int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	indexes := []int{}
+	var total int64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".part")
+		if !ok {
+			continue
+		}
+		index, err := strconv.Atoi(name)
+		if err != nil || strconv.Itoa(index) != name {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, 0, err
+		}
+		indexes = append(indexes, index)
+		total += info.Size()
+	}
+	sort.Ints(indexes)
+	return indexes, total, nil
+}
+
+// sweepUploads deletes sessions not touched for UPLOAD_CHUNK_TTL_HOURS
+func (s *FilesystemService) sweepUploads() {
+	if s.cfg.UploadChunkTTLHours <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(s.cfg.UploadChunkDir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(s.cfg.UploadChunkTTLHours) * time.Hour)
+	for _, entry := range entries {
+		if !entry.IsDir() || !uploadIDPattern.MatchString(entry.Name()) {
+			continue
+		}
+		// A new chunk updates the folder's mtime
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.RemoveAll(filepath.Join(s.cfg.UploadChunkDir, entry.Name()))
+		}
+	}
+}
+
+// InitUpload starts a chunked upload of path (the final file) for owner and
+// returns its id. size is the expected total in bytes, 0 if unknown.
+func (s *FilesystemService) InitUpload(storage, path string, size int64, owner string) (string, error) {
+	if err := s.checkWritable(storage, path); err != nil {
+		return "", err
+	}
+	if max := s.cfg.UploadChunkedMaxBytes; max > 0 && size > max {
+		return "", fmt.Errorf("%w: %d bytes (max %d)", ErrUploadTooLarge, size, max)
+	}
+	if err := s.checkNameLength(storage, path); err != nil {
+		return "", err
+	}
+	if _, err := s.driver.GetRealPath(storage, path); err != nil {
+		return "", err
+	}
+	if err := s.checkSpace(storage, path, size); err != nil {
+		return "", err
+	}
+	s.sweepUploads()
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	dir := filepath.Join(s.cfg.UploadChunkDir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(uploadSession{Storage: storage, Path: path, Size: size, Created: time.Now(), Owner: owner})
+	if err := os.WriteFile(filepath.Join(dir, uploadSessionFile), data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return id, nil
+}
+
+// SaveChunk stores chunk index of owner's upload. Sending an index again
+// replaces it. It takes an upload slot like a plain upload.
+func (s *FilesystemService) SaveChunk(id, owner string, index int, src io.Reader) error {
+	if index < 0 || index >= maxUploadChunks {
+		return fmt.Errorf("%w: index must be 0-%d", ErrInvalidChunk, maxUploadChunks-1)
+	}
+	dir, session, err := s.loadUploadSession(id, owner)
+	if err != nil {
+		return err
+	}
+	release, err := s.acquireUploadSlot()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Room left for this chunk: the other chunks count, the one it replaces doesn't
+	partPath := filepath.Join(dir, strconv.Itoa(index)+".part")
+	max := s.maxUploadBytes(session)
+	limit := int64(-1)
+	if max > 0 {
+		_, received, err := receivedChunks(dir)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(partPath); err == nil {
+			received -= info.Size()
+		}
+		if limit = max - received; limit < 0 {
+			limit = 0
+		}
+		src = io.LimitReader(src, limit+1)
+	}
+
+	// Written aside and renamed, so a dropped request never leaves a short part
+	tmp, err := os.CreateTemp(dir, "chunk-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	n, err := io.Copy(tmp, src)
+	if err == nil && limit >= 0 && n > limit {
+		err = fmt.Errorf("%w: the chunks would exceed %d bytes", ErrUploadTooLarge, max)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, partPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Chunks written at the same time each saw room for themselves
+	if max > 0 {
+		if _, received, err := receivedChunks(dir); err == nil && received > max {
+			os.Remove(partPath)
+			return fmt.Errorf("%w: the chunks would exceed %d bytes", ErrUploadTooLarge, max)
+		}
+	}
+	return nil
+}
+
+// UploadStatus reports which chunks of owner's upload have arrived
+func (s *FilesystemService) UploadStatus(id, owner string) (domain.ChunkedUploadStatus, error) {
+	dir, session, err := s.loadUploadSession(id, owner)
+	if err != nil {
+		return domain.ChunkedUploadStatus{}, err
+	}
+	received, total, err := receivedChunks(dir)
+	if err != nil {
+		return domain.ChunkedUploadStatus{}, err
+	}
+	return domain.ChunkedUploadStatus{
+		ID:            id,
+		Storage:       session.Storage,
+		Path:          session.Path,
+		Size:          session.Size,
+		Received:      received,
+		ReceivedBytes: total,
+	}, nil
+}
+
+// chunkReader reads the parts of a session in order, opening one at a time
+type chunkReader struct {
+	dir     string
+	count   int
+	next    int
+	current *os.File
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next == r.count {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, strconv.Itoa(r.next)+".part"))
+			if err != nil {
+				return 0, err
+			}
+			r.current = f
+			r.next++
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() {
+	if r.current != nil {
+		r.current.Close()
+	}
+}
+
+// CompleteUpload joins chunks 0..N-1 of owner's upload in order into the
+// final file and removes the session. Missing chunks, or a total that differs
+// from the size given at init, fail with ErrUploadIncomplete and keep the
+// session so the client can send what's missing.
+func (s *FilesystemService) CompleteUpload(id, owner string) (string, error) {
+	dir, session, err := s.loadUploadSession(id, owner)
+	if err != nil {
+		return "", err
+	}
+	received, total, err := receivedChunks(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(received) == 0 {
+		return "", fmt.Errorf("%w: no chunks received", ErrUploadIncomplete)
+	}
+	// Indexes are sorted and unique, so a gap shows up as a mismatch
+	for i, index := range received {
+		if index != i {
+			return "", fmt.Errorf("%w: chunk %d is missing", ErrUploadIncomplete, i)
+		}
+	}
+	if session.Size > 0 && total != session.Size {
+		return "", fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, total, session.Size)
+	}
+
+	// Claim the session so a second complete (or a late chunk) can't race this one
+	claimed := dir + ".completing"
+	if err := os.Rename(dir, claimed); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+	r := &chunkReader{dir: claimed, count: len(received)}
+	_, err = s.UploadFile(session.Storage, session.Path, r, session.Size, ConflictOverwrite, "")
+	r.Close()
+	if err != nil {
+		os.Rename(claimed, dir) // let the client retry
+		return "", err
+	}
+	os.RemoveAll(claimed)
+	return session.Path, nil
+}
+
+// AbortUpload discards owner's upload and its chunks
+func (s *FilesystemService) AbortUpload(id, owner string) error {
+	dir, _, err := s.loadUploadSession(id, owner)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestChunkedUploadBelongsToItsOwner(t *testing.T) {
+	s, root := newTestService(t, nil)
+	id, err := s.InitUpload("ssd", "big.bin", 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveChunk(id, "bob", 0, strings.NewReader("x")); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("chunk from another user: err = %v, want ErrUploadNotFound", err)
+	}
+	if _, err := s.UploadStatus(id, "bob"); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("status for another user: err = %v, want ErrUploadNotFound", err)
+	}
+	if err := s.AbortUpload(id, "bob"); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("abort by another user: err = %v, want ErrUploadNotFound", err)
+	}
+	if err := s.SaveChunk(id, "alice", 0, strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteUpload(id, "bob"); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("complete by another user: err = %v, want ErrUploadNotFound", err)
+	}
+	if _, err := s.CompleteUpload(id, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "big.bin")); err != nil || string(data) != "data" {
+		t.Errorf("assembled file = %q, %v", data, err)
+	}
+}
+
+func TestChunksStayWithinDeclaredSize(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	id, err := s.InitUpload("ssd", "f.bin", 6, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveChunk(id, "alice", 0, strings.NewReader("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveChunk(id, "alice", 1, strings.NewReader("efg")); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("chunk past the declared size: err = %v, want ErrUploadTooLarge", err)
+	}
+	// Replacing a chunk only counts the new bytes
+	if err := s.SaveChunk(id, "alice", 0, strings.NewReader("abcdef")); err != nil {
+		t.Errorf("replacing chunk 0 within the size: %v", err)
+	}
+	status, err := s.UploadStatus(id, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ReceivedBytes != 6 || len(status.Received) != 1 {
+		t.Errorf("status = %+v, want chunk 0 with 6 bytes", status)
+	}
+}
+
+func TestChunkedUploadMaxBytes(t *testing.T) {
+	s, _ := newTestService(t, func(cfg *config.Config) { cfg.UploadChunkedMaxBytes = 4 })
+	if _, err := s.InitUpload("ssd", "f.bin", 5, "alice"); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("declared size over the max: err = %v, want ErrUploadTooLarge", err)
+	}
+	id, err := s.InitUpload("ssd", "f.bin", 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveChunk(id, "alice", 0, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveChunk(id, "alice", 1, strings.NewReader("de")); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("unknown size past the max: err = %v, want ErrUploadTooLarge", err)
+	}
+}
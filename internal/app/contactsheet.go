@@ -0,0 +1,108 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contactSheetMaxFrames = 64
+	contactSheetTileWidth = 320
+)
+
+// acquireMediaSlot bounds concurrent ffmpeg/ffprobe runs; waiting counts
+// against the caller's timeout
+func (s *FilesystemService) acquireMediaSlot(ctx context.Context) (func(), error) {
+	if s.mediaSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.mediaSlots <- struct{}{}:
+		return func() { <-s.mediaSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *FilesystemService) mediaContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(s.cfg.MediaTimeoutSeconds)*time.Second)
+}
+
+// videoDuration asks ffprobe for the container duration in seconds
+func (s *FilesystemService) videoDuration(ctx context.Context, realPath string) (float64, error) {
+	ffprobe, err := s.toolPath(ToolFFprobe)
+	if err != nil {
+		return 0, err
+	}
+	out, err := exec.CommandContext(ctx, ffprobe, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", realPath).Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("ffprobe: no duration for %s", filepath.Base(realPath))
+	}
+	return d, nil
+}
+
+// GetContactSheet tiles `frames` evenly spaced frames of a video into one
+// JPEG grid. Cached per path, modification time and frame count.
+func (s *FilesystemService) GetContactSheet(realPath string, modTime time.Time, frames int) ([]byte, error) {
+	frames = max(1, min(frames, contactSheetMaxFrames))
+	key := fmt.Sprintf("%s|%d|%d", realPath, modTime.UnixNano(), frames)
+	if b, ok := s.contactSheets.get(key); ok {
+		return b, nil
+	}
+
+	ffmpeg, err := s.toolPath(ToolFFmpeg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.toolPath(ToolFFprobe); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.mediaContext()
+	defer cancel()
+	release, err := s.acquireMediaSlot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for media slot: %w", err)
+	}
+	defer release()
+
+	duration, err := s.videoDuration(ctx, realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := int(math.Ceil(math.Sqrt(float64(frames))))
+	rows := (frames + cols - 1) / cols
+	// fps=frames/duration samples evenly across the whole video
+	filter := fmt.Sprintf("fps=%f,scale=%d:-2,tile=%dx%d", float64(frames)/duration, contactSheetTileWidth, cols, rows)
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-v", "error", "-i", realPath, "-vf", filter,
+		"-frames:v", "1", "-f", "mjpeg", "-q:v", "5", "pipe:1")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err() // killed by the timeout
+		}
+		fmt.Printf("Contact sheet error for %s: %v\n", realPath, err)
+		return nil, err
+	}
+
+	s.contactSheets.put(key, out.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"storages-api/internal/domain"
+)
+
+// ErrDataURLTooLarge is returned for files over DATAURL_MAX_KB
+var ErrDataURLTooLarge = errors.New("file_too_large")
+
+// DataURL returns a small file as "data:<mime>;base64,..." along with its MIME
+// type. The size cap is checked before reading and again while reading, in
+// case the file grows in between.
+func (s *FilesystemService) DataURL(storage, path string) (string, string, error) {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return "", "", err
+	}
+	f, err := os.Open(realPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return "", "", fmt.Errorf("%s is a folder: %w", path, os.ErrNotExist)
+	}
+	limit := s.cfg.DataURLMaxBytes
+	if info.Size() > limit {
+		return "", "", fmt.Errorf("%w: %d bytes, limit %d", ErrDataURLTooLarge, info.Size(), limit)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return "", "", err
+	}
+	if int64(len(data)) > limit {
+		return "", "", fmt.Errorf("%w: limit %d bytes", ErrDataURLTooLarge, limit)
+	}
+
+	mime := domain.ContentTypeFor(filepath.Ext(path))
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), mime, nil
+}
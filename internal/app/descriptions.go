@@ -0,0 +1,160 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"storages-api/internal/domain"
+	"strings"
+	"time"
+)
+
+// Free-text notes on files and folders. They live in their own table so a
+// full reindex (which replaces the files rows) keeps them; renames, moves and
+// deletes done through the API carry them along like the index rows.
+
+const maxDescriptionBytes = 4096
+
+// descriptionColumn selects a files row's note in index queries
+const descriptionColumn = "(SELECT d.description FROM descriptions d WHERE d.storage = files.storage AND d.path = files.path)"
+
+// ErrDescriptionTooLong is returned for notes over maxDescriptionBytes
+var ErrDescriptionTooLong = errors.New("description_too_long")
+
+const descriptionsSchema = `
+	CREATE TABLE IF NOT EXISTS descriptions (
+		storage TEXT NOT NULL,
+		path TEXT NOT NULL,
+		description TEXT NOT NULL,
+		updated DATETIME,
+		PRIMARY KEY (storage, path)
+	);
+`
+
+// SetDescription attaches a note to an existing file or folder; an empty
+// text removes it
+func (s *FilesystemService) SetDescription(storage, path, text string) error {
+	if s.db == nil {
+		return fmt.Errorf("index database unavailable")
+	}
+	if len(text) > maxDescriptionBytes {
+		return fmt.Errorf("%w: max %d bytes", ErrDescriptionTooLong, maxDescriptionBytes)
+	}
+	p := indexPath(path)
+	if p == "" {
+		return fmt.Errorf("cannot describe the storage root")
+	}
+	if _, err := s.driver.Stat(storage, path); err != nil {
+		return err
+	}
+
+	var err error
+	if strings.TrimSpace(text) == "" {
+		_, err = s.db.Exec("DELETE FROM descriptions WHERE storage = ? AND path = ?", storage, p)
+	} else {
+		_, err = s.db.Exec(`INSERT INTO descriptions(storage, path, description, updated) VALUES(?, ?, ?, ?)
+			ON CONFLICT(storage, path) DO UPDATE SET description = excluded.description, updated = excluded.updated`,
+			storage, p, text, time.Now())
+	}
+	if err == nil {
+		// Cached listings carry the old text
+		s.invalidateStorage(storage)
+	}
+	return err
+}
+
+// describe fills Description on listing entries. For a single folder listing
+// dir is its path; with dir == "" and all set, every note in the storage is
+// loaded (recursive listings).
+func (s *FilesystemService) describe(storage, dir string, all bool, files []domain.FileInfo) {
+	if s.db == nil || len(files) == 0 {
+		return
+	}
+
+	query := "SELECT path, description FROM descriptions WHERE storage = ?"
+	args := []interface{}{storage}
+	if !all {
+		if p := indexPath(dir); p == "" {
+			query += " AND instr(path, '/') = 0"
+		} else {
+			query += ` AND path LIKE ? ESCAPE '\' AND instr(substr(path, ?), '/') = 0`
+			args = append(args, likePrefix(p), len(p)+2)
+		}
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	notes := make(map[string]string)
+	for rows.Next() {
+		var p, text string
+		if err := rows.Scan(&p, &text); err == nil {
+			notes[p] = text
+		}
+	}
+	if len(notes) == 0 {
+		return
+	}
+	for i := range files {
+		files[i].Description = notes[indexPath(files[i].Path)]
+	}
+}
+
+// deleteDescriptions drops the notes of a path and everything below it
+func deleteDescriptions(tx *sql.Tx, storage, p string) error {
+	_, err := tx.Exec(`DELETE FROM descriptions WHERE storage = ? AND (path = ? OR path LIKE ? ESCAPE '\')`, storage, p, likePrefix(p))
+	return err
+}
+
+// renameDescriptions moves the notes of a subtree along with it
+func renameDescriptions(tx *sql.Tx, storage, oldP, newP string) error {
+	if err := deleteDescriptions(tx, storage, newP); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE descriptions SET path = ? WHERE storage = ? AND path = ?", newP, storage, oldP); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE descriptions SET path = ? || substr(path, ?) WHERE storage = ? AND path LIKE ? ESCAPE '\'`,
+		newP, len(oldP)+1, storage, likePrefix(oldP))
+	return err
+}
+
+// pruneDescriptions drops notes whose file vanished outside the API. Notes are
+// few, so checking each on disk is cheap and also covers hidden files the
+// index doesn't hold. Only call it after a scan that found files, so an
+// unplugged disk doesn't wipe every note.
+func (s *FilesystemService) pruneDescriptions(storage string) {
+	if s.db == nil {
+		return
+	}
+	rows, err := s.db.Query("SELECT path FROM descriptions WHERE storage = ?", storage)
+	if err != nil {
+		return
+	}
+	var gone []string
+	for rows.Next() {
+		var p string
+		if rows.Scan(&p) != nil {
+			continue
+		}
+		realPath, err := s.driver.GetRealPath(storage, p)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Lstat(realPath); os.IsNotExist(err) {
+			gone = append(gone, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range gone {
+		s.db.Exec("DELETE FROM descriptions WHERE storage = ? AND path = ?", storage, p)
+	}
+	if len(gone) > 0 {
+		fmt.Printf("Dropped %d descriptions of missing files in %s\n", len(gone), storage)
+	}
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyAndMoveDestinationInsideSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		dst     string
+		invalid bool
+	}{
+		{"same path", "/a", true},
+		{"same path, other form", "/a/", true},
+		{"child", "/a/b", true},
+		{"grandchild", "/a/sub/deeper", true},
+		{"sibling sharing a prefix", "/ab", false},
+		{"sibling", "/d", false},
+		{"into a sibling folder", "/c/a", false},
+	}
+	ops := map[string]func(s *FilesystemService, dst string) error{
+		"copy": func(s *FilesystemService, dst string) error { return s.Copy("ssd", "/a", dst) },
+		"move": func(s *FilesystemService, dst string) error { return s.RenameOrMove("ssd", "/a", dst) },
+	}
+	for opName, op := range ops {
+		for _, tt := range tests {
+			t.Run(opName+" "+tt.name, func(t *testing.T) {
+				s, root := newTestService(t, nil)
+				writeFile(t, root, "a/sub/file.txt", "x")
+				if err := os.Mkdir(filepath.Join(root, "c"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				err := op(s, tt.dst)
+				if tt.invalid {
+					if !errors.Is(err, ErrInvalidDestination) {
+						t.Fatalf("err = %v, want ErrInvalidDestination", err)
+					}
+					if _, err := os.Stat(filepath.Join(root, "a", "sub", "file.txt")); err != nil {
+						t.Errorf("source changed: %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(tt.dst), "sub", "file.txt")); err != nil {
+					t.Errorf("%s: %v", opName, err)
+				}
+			})
+		}
+	}
+}
+
+func TestMoveFilesIntoItself(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "a/file.txt", "x")
+	writeFile(t, root, "b.txt", "x")
+	results, err := s.MoveFiles("ssd", []string{"/a", "/b.txt"}, "/a", ConflictSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if !errors.Is(results[0].Err, ErrInvalidDestination) {
+		t.Errorf("moving /a into itself: %+v, want an error", results[0])
+	}
+	if results[1].Err != nil {
+		t.Errorf("moving a sibling in: %+v, want success", results[1])
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "b.txt")); err != nil {
+		t.Errorf("sibling not moved: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+	"time"
+)
+
+// Enough for a few screens of a masonry grid; entries are two ints
+const dimensionCacheEntries = 4096
+
+// ErrNotImage is returned when a file's header isn't a decodable image format
+var ErrNotImage = errors.New("unsupported_image_format")
+
+// ImageSize is the pixel size of an image
+type ImageSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// dimensionCache maps path+modtime to image sizes, oldest evicted first
+type dimensionCache struct {
+	mu    sync.Mutex
+	data  map[string]ImageSize
+	order []string
+}
+
+func (c *dimensionCache) get(key string) (ImageSize, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.data[key]
+	return d, ok
+}
+
+func (c *dimensionCache) put(key string, d ImageSize) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		c.data = make(map[string]ImageSize)
+	}
+	if _, ok := c.data[key]; ok {
+		return
+	}
+	if len(c.order) >= dimensionCacheEntries {
+		delete(c.data, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.data[key] = d
+	c.order = append(c.order, key)
+}
+
+// ImageDimensions reads only the image header (image.DecodeConfig), so it is
+// cheap even for very large files. Results are cached per path and modtime.
+func (s *FilesystemService) ImageDimensions(realPath string, modTime time.Time) (ImageSize, error) {
+	key := fmt.Sprintf("%s|%d", realPath, modTime.UnixNano())
+	if d, ok := s.dimensions.get(key); ok {
+		return d, nil
+	}
+
+	f, err := os.Open(realPath)
+	if err != nil {
+		return ImageSize{}, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return ImageSize{}, ErrNotImage
+		}
+		return ImageSize{}, err
+	}
+
+	d := ImageSize{Width: cfg.Width, Height: cfg.Height}
+	s.dimensions.put(key, d)
+	return d, nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"storages-api/internal/domain"
+	"time"
+)
+
+// Drift checks spot-check a random sample of index rows against the disk
+// between full scans. Phantom rows (file gone) are removed and stale file
+// rows (size/mtime changed) are re-read; folders whose mtime moved may have
+// gained files the index doesn't know about, which only the next full scan
+// can fill in, so they are counted but left alone.
+
+// checkDrift samples one storage's index and repairs what it can
+func (s *FilesystemService) checkDrift(storage string, sample int) (domain.DriftResult, error) {
+	res := domain.DriftResult{CheckedAt: time.Now()}
+
+	rows, err := s.db.Query("SELECT path, is_dir, size, modified FROM files WHERE storage = ? ORDER BY RANDOM() LIMIT ?", storage, sample)
+	if err != nil {
+		return res, err
+	}
+	type entry struct {
+		path     string
+		isDir    bool
+		size     int64
+		modified time.Time
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if rows.Scan(&e.path, &e.isDir, &e.size, &e.modified) == nil {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+
+	for _, e := range entries {
+		realPath, err := s.driver.GetRealPath(storage, "/"+e.path)
+		if err != nil {
+			continue
+		}
+		res.Checked++
+
+		info, err := os.Lstat(realPath)
+		switch {
+		case os.IsNotExist(err):
+			res.Phantoms++
+			s.indexRemove(storage, "/"+e.path)
+		case err != nil:
+			// Unreadable right now; not evidence either way
+		case info.IsDir() != e.isDir:
+			res.Stale++
+			s.indexUpsert(storage, "/"+e.path)
+		case e.isDir:
+			if !info.ModTime().Equal(e.modified) {
+				res.ChangedDirs++
+			}
+		case info.Size() != e.size || !info.ModTime().Equal(e.modified):
+			res.Stale++
+			s.indexUpsert(storage, "/"+e.path)
+		}
+	}
+
+	if res.Checked > 0 {
+		res.Drift = float64(res.Phantoms+res.Stale+res.ChangedDirs) / float64(res.Checked)
+	}
+	if res.Phantoms+res.Stale > 0 {
+		s.invalidateStorage(storage)
+	}
+	return res, nil
+}
+
+// CheckDrift runs a drift check on every storage that isn't being scanned
+func (s *FilesystemService) CheckDrift() {
+	for _, name := range s.driver.StorageNames() {
+		s.stateMu.Lock()
+		state, ok := s.indexState[indexKey(name)]
+		busy := ok && state.scanning
+		s.stateMu.Unlock()
+		if busy {
+			continue
+		}
+
+		res, err := s.checkDrift(name, s.cfg.DriftSampleSize)
+		if err != nil {
+			fmt.Printf("Warning: drift check of %s failed: %v\n", name, err)
+			continue
+		}
+		if res.Phantoms+res.Stale+res.ChangedDirs > 0 {
+			fmt.Printf("Drift check %s: %d checked, %d phantom, %d stale, %d changed folders (%.1f%%)\n",
+				name, res.Checked, res.Phantoms, res.Stale, res.ChangedDirs, res.Drift*100)
+		}
+
+		s.stateMu.Lock()
+		if state, ok = s.indexState[indexKey(name)]; !ok {
+			state = &indexState{}
+			s.indexState[indexKey(name)] = state
+		}
+		state.lastDrift = &res
+		s.stateMu.Unlock()
+	}
+}
+
+func (s *FilesystemService) startDriftChecks() {
+	ticker := time.NewTicker(time.Duration(s.cfg.DriftCheckMinutes) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.CheckDrift()
+	}
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"storages-api/internal/domain"
+)
+
+// ErrInvalidOperation is returned for an estimate of anything but copy or move
+var ErrInvalidOperation = errors.New("invalid_operation")
+
+// Estimate sizes a planned copy or move and compares it with the free space
+// where it would land, so a doomed operation isn't started. Nothing is
+// written; missing sources fail like the operation itself would.
+func (s *FilesystemService) Estimate(req domain.EstimateRequest) (domain.EstimateResult, error) {
+	var result domain.EstimateResult
+	if req.Operation != "copy" && req.Operation != "move" {
+		return result, fmt.Errorf("%w: operation must be copy or move", ErrInvalidOperation)
+	}
+
+	needsSpace := req.Operation == "copy"
+	var apparent int64
+	for _, path := range req.Paths {
+		usage, err := s.driver.DirSize(req.Storage, path)
+		if err != nil {
+			return result, err
+		}
+		if s.cfg.HardlinkDedup {
+			result.TotalBytes += usage.Bytes
+		} else {
+			result.TotalBytes += usage.ApparentBytes
+		}
+		apparent += usage.ApparentBytes
+		result.FileCount += usage.Files
+		result.FolderCount += usage.Folders
+
+		if !needsSpace {
+			// A move is a rename unless a nested mount puts the destination
+			// on another filesystem; then it is a copy plus delete
+			same, err := s.driver.SameDevice(req.Storage, path, req.Destination)
+			if err != nil {
+				return result, err
+			}
+			needsSpace = !same
+		}
+	}
+
+	free, err := s.driver.FreeSpace(req.Storage, req.Destination)
+	if err != nil {
+		return result, err
+	}
+	result.FreeBytes = free
+	if needsSpace {
+		// Copies don't keep hard links: every name becomes a full file
+		result.RequiredBytes = apparent
+	}
+	result.WouldExceedSpace = uint64(result.RequiredBytes) > free
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// ErrUnsafeEntry is returned for an archive entry that would land outside
+// the destination (absolute, "..", backslashes)
+var ErrUnsafeEntry = errors.New("unsafe_entry")
+
+// ExtractZip unpacks a ZIP into destPath and returns how many files it
+// wrote. Every entry is checked before anything is written: unsafe names
+// fail the whole request, existing files are never overwritten (os.ErrExist),
+// and symlinks or device entries are skipped. Sizes are capped per entry by
+// ARCHIVE_ENTRY_MAX_MB and in total by EXTRACT_MAX_MB, counting the bytes
+// actually decompressed. Files written before a failure are kept and indexed.
+func (s *FilesystemService) ExtractZip(storage, zipPath, destPath string) (int, error) {
+	if err := s.checkWritable(storage, destPath); err != nil {
+		return 0, err
+	}
+	zr, err := s.openZip(storage, zipPath)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	type extractEntry struct {
+		file   *zip.File
+		target string
+	}
+	var entries []extractEntry
+	var declared uint64
+	for _, f := range zr.File {
+		name, ok := cleanEntryName(f.Name)
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrUnsafeEntry, f.Name)
+		}
+		mode := f.Mode()
+		if name == "." || (!mode.IsDir() && !mode.IsRegular()) {
+			continue
+		}
+		target := path.Join(destPath, name)
+		// Same containment check every other write goes through
+		if _, err := s.driver.GetRealPath(storage, target); err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrUnsafeEntry, f.Name)
+		}
+		if err := s.checkNameLength(storage, target); err != nil {
+			return 0, err
+		}
+		if !mode.IsDir() {
+			if s.pathExists(storage, target) {
+				return 0, fmt.Errorf("%s: %w", target, os.ErrExist)
+			}
+			if int64(f.UncompressedSize64) > s.cfg.ArchiveEntryMaxBytes {
+				return 0, fmt.Errorf("%w: %s is %d bytes, limit %d", ErrEntryTooLarge, name, f.UncompressedSize64, s.cfg.ArchiveEntryMaxBytes)
+			}
+			declared += f.UncompressedSize64
+		}
+		entries = append(entries, extractEntry{file: f, target: target})
+	}
+	if declared > uint64(s.cfg.ExtractMaxBytes) {
+		return 0, fmt.Errorf("%w: archive holds %d bytes, limit %d", ErrEntryTooLarge, declared, s.cfg.ExtractMaxBytes)
+	}
+	if err := s.checkSpace(storage, destPath, int64(declared)); err != nil {
+		return 0, err
+	}
+
+	release, err := s.acquireUploadSlot()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	written := 0
+	created := destPath
+	if top := s.missingAncestor(storage, destPath); top != "" {
+		created = top
+	}
+	defer func() {
+		s.invalidateStorage(storage)
+		s.indexUpsert(storage, created)
+	}()
+	if err := s.driver.CreateFolder(storage, destPath); err != nil {
+		return 0, err
+	}
+
+	type dirTime struct {
+		path string
+		mod  time.Time
+	}
+	budget := s.cfg.ExtractMaxBytes
+	var dirTimes []dirTime
+	for _, e := range entries {
+		if e.file.Mode().IsDir() {
+			if err := s.driver.CreateFolder(storage, e.target); err != nil {
+				return written, err
+			}
+			dirTimes = append(dirTimes, dirTime{e.target, e.file.Modified})
+			continue
+		}
+
+		rc, err := e.file.Open()
+		if err != nil {
+			return written, fmt.Errorf("%w: %v", ErrNotArchive, err)
+		}
+		src := &cappedReader{r: rc, max: min(s.cfg.ArchiveEntryMaxBytes, budget), tooLarge: ErrEntryTooLarge}
+		err = s.driver.SaveFile(storage, e.target, src)
+		rc.Close()
+		budget -= src.n
+		if err != nil {
+			return written, fmt.Errorf("%s: %w", e.target, err)
+		}
+		if !e.file.Modified.IsZero() {
+			s.driver.Touch(storage, e.target, e.file.Modified, false)
+		}
+		written++
+	}
+	// Folder times last: writing their contents moved them
+	for i := len(dirTimes) - 1; i >= 0; i-- {
+		if !dirTimes[i].mod.IsZero() {
+			s.driver.Touch(storage, dirTimes[i].path, dirTimes[i].mod, false)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrFetchBlocked  = errors.New("fetch target not allowed")
+	ErrFetchTooLarge = errors.New("remote file exceeds size limit")
+	// ErrRemoteStatus is returned when the remote server answers with anything but 200 OK
+	ErrRemoteStatus = errors.New("remote_status")
+)
+
+// Carrier-grade NAT range, not covered by net.IP.IsPrivate
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnatRange.Contains(ip)
+}
+
+func hostMatches(host string, list []string) bool {
+	for _, h := range list {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scheme and host allow/deny check, applied to the initial URL and every redirect
+func (s *FilesystemService) checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrFetchBlocked, u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrFetchBlocked)
+	}
+	if hostMatches(host, s.cfg.FetchDeniedHosts) {
+		return fmt.Errorf("%w: host %s is denied", ErrFetchBlocked, host)
+	}
+	if len(s.cfg.FetchAllowedHosts) > 0 && !hostMatches(host, s.cfg.FetchAllowedHosts) {
+		return fmt.Errorf("%w: host %s is not allowed", ErrFetchBlocked, host)
+	}
+	return nil
+}
+
+func (s *FilesystemService) fetchClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		// Checked on the resolved address, so DNS tricks can't reach internal hosts
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if s.cfg.FetchAllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("%w: %s is an internal address", ErrFetchBlocked, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: time.Duration(s.cfg.FetchTimeoutSeconds) * time.Second,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return s.checkFetchURL(req.URL)
+		},
+	}
+}
+
+// Errors once more than max bytes have been read, with tooLarge
+// (ErrFetchTooLarge if nil)
+type cappedReader struct {
+	r        io.Reader
+	n        int64
+	max      int64
+	tooLarge error
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n > c.max {
+		if c.tooLarge != nil {
+			return n, c.tooLarge
+		}
+		return n, ErrFetchTooLarge
+	}
+	return n, err
+}
+
+// FetchRemote downloads rawURL server-side into the destination folder. A
+// taken name is handled by onConflict like an upload.
+func (s *FilesystemService) FetchRemote(storage, destFolder, name, rawURL string, onConflict ConflictPolicy) (domain.FetchResponse, error) {
+	var res domain.FetchResponse
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return res, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := s.checkFetchURL(u); err != nil {
+		return res, err
+	}
+
+	if name == "" {
+		name = path.Base(u.Path)
+		if name == "" || name == "/" || name == "." {
+			name = "download"
+		}
+	}
+	fullPath := filepath.Join(destFolder, filepath.Base(name))
+	if err := s.checkNameLength(storage, fullPath); err != nil {
+		return res, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.FetchTimeoutSeconds)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return res, err
+	}
+
+	resp, err := s.fetchClient().Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("%w: %s", ErrRemoteStatus, resp.Status)
+	}
+	if resp.ContentLength > s.cfg.FetchMaxBytes {
+		return res, ErrFetchTooLarge
+	}
+
+	body := &cappedReader{r: resp.Body, max: s.cfg.FetchMaxBytes}
+	// A failed download is discarded before it replaces anything, so even
+	// with overwrite an existing file of the same name survives
+	saved, err := s.UploadFile(storage, fullPath, body, resp.ContentLength, onConflict, "")
+	if err != nil {
+		return res, err
+	}
+
+	return domain.FetchResponse{
+		Success:     true,
+		Message:     "file fetched successfully",
+		FilePath:    saved.FilePath,
+		Size:        body.n,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
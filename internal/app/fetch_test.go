@@ -0,0 +1,87 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestFailedFetchKeepsExistingFile(t *testing.T) {
+	s, root := newTestService(t, func(cfg *config.Config) {
+		cfg.FetchAllowPrivate = true
+		cfg.FetchMaxBytes = 4
+		cfg.FetchTimeoutSeconds = 10
+	})
+	writeFile(t, root, "dl/file.bin", "original")
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length: the cap trips while streaming
+		w.Write([]byte("too"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(" many bytes"))
+	}))
+	defer remote.Close()
+
+	if _, err := s.FetchRemote("ssd", "/dl", "file.bin", remote.URL+"/file.bin", ConflictOverwrite); !errors.Is(err, ErrFetchTooLarge) {
+		t.Fatalf("err = %v, want ErrFetchTooLarge", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "dl", "file.bin")); err != nil || string(data) != "original" {
+		t.Errorf("existing file = %q, %v; want it untouched", data, err)
+	}
+}
+
+func TestFetchConflictPolicy(t *testing.T) {
+	s, root := newTestService(t, func(cfg *config.Config) {
+		cfg.FetchAllowPrivate = true
+		cfg.FetchMaxBytes = 1 << 20
+		cfg.FetchTimeoutSeconds = 10
+	})
+	writeFile(t, root, "dl/file.txt", "original")
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("remote"))
+	}))
+	defer remote.Close()
+
+	if _, err := s.FetchRemote("ssd", "/dl", "file.txt", remote.URL, ConflictSkip); !errors.Is(err, ErrTargetExists) {
+		t.Fatalf("skip: err = %v, want ErrTargetExists", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "dl", "file.txt")); string(data) != "original" {
+		t.Errorf("skip replaced the file: %q", data)
+	}
+
+	res, err := s.FetchRemote("ssd", "/dl", "file.txt", remote.URL, ConflictRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilePath == "/dl/file.txt" {
+		t.Errorf("rename kept the taken path %s", res.FilePath)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(res.FilePath))); string(data) != "remote" {
+		t.Errorf("renamed file = %q, want the remote body", data)
+	}
+}
+
+func TestFetchRemoteStatus(t *testing.T) {
+	s, root := newTestService(t, func(cfg *config.Config) {
+		cfg.FetchAllowPrivate = true
+		cfg.FetchMaxBytes = 1 << 20
+		cfg.FetchTimeoutSeconds = 10
+	})
+	remote := httptest.NewServer(http.NotFoundHandler())
+	defer remote.Close()
+
+	_, err := s.FetchRemote("ssd", "/dl", "file.txt", remote.URL, ConflictSkip)
+	if !errors.Is(err, ErrRemoteStatus) {
+		t.Fatalf("err = %v, want ErrRemoteStatus", err)
+	}
+	if !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want the upstream status", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dl", "file.txt")); !os.IsNotExist(err) {
+		t.Errorf("failed fetch left a file: %v", err)
+	}
+}
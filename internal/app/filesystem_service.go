@@ -2,19 +2,26 @@ package app
 
 import (
 	"bytes"
+	"cmp"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"storages-api/internal/config"
 	"storages-api/internal/domain"
 	"storages-api/internal/infra/filesystem"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -23,24 +30,155 @@ type cacheEntry struct {
 	timestamp time.Time
 }
 
+type indexState struct {
+	scanning    bool
+	rerun       bool // another scan was requested while this one ran
+	full        bool // the next scan reads every folder
+	lastIndexed time.Time
+	lastError   error
+	lastDrift   *domain.DriftResult
+}
+
+// indexLock serializes all index writes of one storage: the full scan's
+// delete-and-reinsert and the incremental patches of write operations.
+type indexLock struct {
+	mu     sync.Mutex
+	writes uint64 // incremental patches applied, guarded by mu
+}
+
+// A full scan whose walk was overtaken by incremental writes is repeated,
+// but only this many times in a row so a busy storage can't loop forever
+const maxIndexReruns = 2
+
 type FilesystemService struct {
 	driver *filesystem.LocalDriver
+	cfg    *config.Config
 	cache  map[string]cacheEntry
 	mu     sync.RWMutex
+	// Bumped on every invalidation so a listing read before a write can't
+	// be stored after it; guarded by mu
+	generations map[string]uint64
 
 	// SQLite Indexing system
 	db *sql.DB
+
+	// Per-storage scan state and index write locks, guarded by stateMu
+	stateMu    sync.Mutex
+	indexState map[string]*indexState
+	indexLocks map[string]*indexLock
+	// Only one VACUUM at a time
+	optimizeMu sync.Mutex
+	// FTS5 is compiled in and files_fts is maintained
+	fullText bool
+
+	// Upload slots (nil = unlimited)
+	uploadSlots chan struct{}
+
+	// External tools resolved at startup: name -> binary path
+	tools map[string]string
+
+	// Serializes runtime mount changes and their persistence
+	mountsMu sync.Mutex
+
+	// Generated image thumbnails and first-frame posters, on disk
+	thumbs *ThumbnailCache
+	// Video contact sheets
+	contactSheets posterCache
+
+	// Category -> extensions, shared by /api/category and stats
+	categories map[string][]string
+
+	// Runtime per-storage overrides: lower-cased storage -> key -> JSON value.
+	// settingsMu also guards cfg.StorageOptions, which AddStorage extends.
+	settingsMu sync.RWMutex
+	settings   map[string]map[string]json.RawMessage
+
+	// Image header sizes for /api/dimensions
+	dimensions dimensionCache
+
+	// Concurrent ffmpeg/ffprobe runs (nil = unlimited)
+	mediaSlots chan struct{}
+
+	// Live fsnotify watchers: lower-cased storage -> watcher
+	watchMu  sync.Mutex
+	watchers map[string]*fsnotify.Watcher
+
+	// jti -> expiry of access tokens invalidated by logout
+	revokedMu sync.RWMutex
+	revoked   map[string]time.Time
 }
 
-func NewFilesystemService(driver *filesystem.LocalDriver) *FilesystemService {
+var (
+	// ErrUploadBusy is returned when all upload slots are taken
+	ErrUploadBusy = errors.New("too many concurrent uploads, retry later")
+	// ErrWriteNotAllowed is returned for writes outside a storage's write prefixes
+	ErrWriteNotAllowed = errors.New("write_not_allowed")
+	// ErrInvalidDestination is returned when a copy/move target is the source itself or lies inside it
+	ErrInvalidDestination = errors.New("invalid_destination")
+	// ErrNotAFolder is returned when a batch move's destination is a file
+	ErrNotAFolder = errors.New("not_a_folder")
+	// ErrAlreadyInDestination is reported for a batch move item that is already in the destination folder
+	ErrAlreadyInDestination = errors.New("already_in_destination")
+	// ErrNameTooLong is returned before touching the disk for names over MAX_NAME_BYTES or paths over MAX_PATH_BYTES
+	ErrNameTooLong = errors.New("name_too_long")
+	// ErrInvalidGlob is returned for a malformed listing glob
+	ErrInvalidGlob = errors.New("invalid_glob")
+	// ErrTargetExists is returned when an upload would replace a file it may not overwrite
+	ErrTargetExists = errors.New("target_exists")
+	// ErrInvalidChecksum is returned for an expected SHA-256 that isn't 64 hex digits
+	ErrInvalidChecksum = errors.New("invalid_checksum")
+	// ErrChecksumMismatch is returned when the received bytes don't hash to the expected SHA-256
+	ErrChecksumMismatch = filesystem.ErrChecksumMismatch
+	// ErrInsufficientSpace is returned before a write that wouldn't fit on the storage
+	ErrInsufficientSpace = errors.New("insufficient_storage")
+)
+
+var sha256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// indexDSN turns INDEX_DB_PATH into a sqlite3 URI with the WAL and sync
+// settings, creating the parent folder. ":memory:" is an in-memory database
+// that lives as long as the process (journal in memory, no WAL); it runs on
+// one connection, so rows must be closed before the next query.
+func indexDSN(path string) (string, error) {
+	if path == ":memory:" {
+		return "file:storage_index?mode=memory&cache=shared&_sync=NORMAL", nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
 	// Use 'file:' prefix for proper URI parameter support in sqlite3
-	db, err := sql.Open("sqlite3", "file:storage_index.db?_journal_mode=WAL&_sync=NORMAL")
+	return "file:" + escaped + "?_journal_mode=WAL&_sync=NORMAL", nil
+}
+
+func NewFilesystemService(driver *filesystem.LocalDriver, cfg *config.Config) *FilesystemService {
+	dsn, err := indexDSN(cfg.IndexDBPath)
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to create the index folder for %s: %v", cfg.IndexDBPath, err)
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		log.Fatalf("CRITICAL: Failed to open SQLite: %v", err)
 	}
 	if db == nil {
 		log.Fatal("CRITICAL: SQL handle is nil")
 	}
+	if cfg.IndexDBPath == ":memory:" {
+		// Shared-cache connections lock each other out with SQLITE_LOCKED,
+		// which the busy timeout doesn't retry, and the database is gone once
+		// the last one closes: use a single connection and never let it go
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		log.Fatalf("CRITICAL: Failed to open SQLite index %s: %v", cfg.IndexDBPath, err)
+	}
+	if cfg.IndexDBPath != ":memory:" && !strings.EqualFold(journalMode, "wal") {
+		log.Printf("Warning: index %s uses journal_mode=%s, not WAL", cfg.IndexDBPath, journalMode)
+	}
 
 	// Create table
 	_, err = db.Exec(`
@@ -67,139 +205,406 @@ func NewFilesystemService(driver *filesystem.LocalDriver) *FilesystemService {
 		log.Fatalf("CRITICAL: Failed to initialize schema: %v", err)
 	}
 
+	// Migrations for indexes created by older versions
+	if err := ensureColumn(db, "files", "sha256", "TEXT"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_storage_sha256 ON files(storage, sha256)"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if err := ensureColumn(db, "files", "name_norm", "TEXT"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if err := backfillNameNorm(db); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	// Hard-linked files only; filled by the next scan
+	if err := ensureColumn(db, "files", "inode", "TEXT"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	// Start of the scan that last read a row; NULL until then
+	if err := ensureColumn(db, "files", "last_indexed", "DATETIME"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec(descriptionsSchema); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec(storageSettingsSchema); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec(tokensSchema); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	// Refresh tokens stored before bindings existed are refused
+	if err := ensureColumn(db, "refresh_tokens", "binding", "TEXT"); err != nil {
+		log.Fatalf("CRITICAL: Failed to migrate schema: %v", err)
+	}
+	fullText, err := setupFullText(db)
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to set up full-text search: %v", err)
+	}
+	settings, err := loadStorageSettings(db)
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to load storage settings: %v", err)
+	}
+	revoked, err := loadRevokedTokens(db)
+	if err != nil {
+		log.Fatalf("CRITICAL: Failed to load revoked tokens: %v", err)
+	}
+
 	s := &FilesystemService{
-		driver: driver,
-		cache:  make(map[string]cacheEntry),
-		db:     db,
+		driver:      driver,
+		cfg:         cfg,
+		cache:       make(map[string]cacheEntry),
+		generations: make(map[string]uint64),
+		db:          db,
+		indexState:  make(map[string]*indexState),
+		indexLocks:  make(map[string]*indexLock),
+		categories:  mergeCategories(cfg.Categories),
+		settings:    settings,
+		fullText:    fullText,
+		thumbs:      NewThumbnailCache(cfg.ThumbCacheDir, cfg.ThumbCacheMaxBytes),
+		watchers:    make(map[string]*fsnotify.Watcher),
+		revoked:     revoked,
+	}
+	if cfg.UploadMaxConcurrent > 0 {
+		s.uploadSlots = make(chan struct{}, cfg.UploadMaxConcurrent)
+	}
+	if cfg.MediaMaxConcurrent > 0 {
+		s.mediaSlots = make(chan struct{}, cfg.MediaMaxConcurrent)
+	}
+	for _, name := range driver.StorageNames() {
+		s.applyFilterRules(name)
 	}
+	s.probeTools()
 	// Start background indexer
-	go s.StartIndexing()
+	if cfg.IndexEnabled {
+		go s.StartIndexing()
+	} else {
+		fmt.Println("Background indexing disabled (INDEX_ENABLED=false)")
+	}
+	if cfg.IndexOptimizeHours > 0 {
+		go s.startOptimizer()
+	}
+	if cfg.IndexEnabled && cfg.DriftCheckMinutes > 0 && cfg.DriftSampleSize > 0 {
+		go s.startDriftChecks()
+	}
 	return s
 }
 
 // Background Indexer: Runs periodically to keep SQLite index fresh
 func (s *FilesystemService) StartIndexing() {
-	ticker := time.NewTicker(30 * time.Minute) // SQLite is persistent, can run less often
+	ticker := time.NewTicker(time.Duration(s.cfg.IndexIntervalMinutes) * time.Minute) // SQLite is persistent, can run less often
 	defer ticker.Stop()
 
+	// Watch first, so changes during the initial scan aren't missed
+	for _, name := range s.driver.StorageNames() {
+		s.startWatching(name)
+	}
+
 	// Initial Scan immediately
-	s.ReindexAll()
+	s.ReindexAll(false)
 
 	for range ticker.C {
-		s.ReindexAll()
+		s.ReindexAll(false)
 	}
 }
 
-func (s *FilesystemService) ReindexAll() {
-	storages := s.driver.ListStorages()
+// ReindexAll scans every storage. Scans are incremental except the first one
+// of the process and full ones: see indexStorage.
+func (s *FilesystemService) ReindexAll(full bool) {
 	var wg sync.WaitGroup
-	for _, st := range storages {
+	for _, name := range s.driver.StorageNames() {
 		wg.Add(1)
-		go func(st domain.StorageInfo) {
+		go func(name string) {
 			defer wg.Done()
-			files, err := s.driver.ReadDirRecursive(st.Name, false)
-			if err != nil {
-				fmt.Printf("ERROR: Failed to scan storage %s: %v\n", st.Name, err)
-				return
-			}
-			s.updateIndex(st.Name, files)
-			fmt.Printf("Indexed %s: %d files to SQLite\n", st.Name, len(files))
-		}(st)
+			s.indexStorage(name, full)
+		}(name)
 	}
 	wg.Wait()
 }
 
-func (s *FilesystemService) updateIndex(storage string, files []domain.FileInfo) {
-	tx, err := s.db.Begin()
-	if err != nil {
-		fmt.Printf("Error starting transaction: %v\n", err)
-		return
-	}
-	defer tx.Rollback() // Safety Rollback
+// indexKey is the key of a storage's index lock and scan state. Storage
+// names match without regard to case, so "Media" and "media" share both.
+func indexKey(storage string) string {
+	return strings.ToLower(storage)
+}
 
-	// For simplicity, we clear and re-insert.
-	_, err = tx.Exec("DELETE FROM files WHERE storage = ?", storage)
-	if err != nil {
-		fmt.Printf("Error clearing index for %s: %v\n", storage, err)
-		return
+// storageIndexLock returns the write lock of a storage's index rows
+func (s *FilesystemService) storageIndexLock(storage string) *indexLock {
+	key := indexKey(storage)
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	l, ok := s.indexLocks[key]
+	if !ok {
+		l = &indexLock{}
+		s.indexLocks[key] = l
 	}
+	return l
+}
 
-	stmt, err := tx.Prepare("INSERT INTO files(storage, name, path, is_dir, size, modified, extension, item_count) VALUES(?, ?, ?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		fmt.Printf("Error preparing statement: %v\n", err)
-		return
+// lockIndexWrite takes the storage's index lock for an incremental patch;
+// call the returned func when done
+func (s *FilesystemService) lockIndexWrite(storage string) func() {
+	l := s.storageIndexLock(storage)
+	l.mu.Lock()
+	l.writes++
+	return l.mu.Unlock
+}
+
+// Scan of one storage, tracked for /api/index/status.
+// Returns false if a scan of this storage is already running; that scan is
+// then repeated once it finishes, so overlapping requests coalesce.
+//
+// A scan only rewrites the rows that changed. Unless full, it also skips
+// reading folders whose mtime is still the indexed one and predates the
+// scan that last read them: their files are kept as indexed. In-place edits
+// don't change a folder's mtime, so the first scan of the process is always
+// full, and writes through the API patch the index themselves.
+func (s *FilesystemService) indexStorage(name string, full bool) bool {
+	s.stateMu.Lock()
+	state, ok := s.indexState[indexKey(name)]
+	if !ok {
+		state = &indexState{}
+		s.indexState[indexKey(name)] = state
 	}
-	defer stmt.Close()
+	if full {
+		state.full = true
+	}
+	if state.scanning {
+		state.rerun = true
+		s.stateMu.Unlock()
+		return false
+	}
+	state.scanning = true
+	s.stateMu.Unlock()
+
+	lock := s.storageIndexLock(name)
+	for attempt := 0; ; attempt++ {
+		s.stateMu.Lock()
+		state.rerun = false
+		full := state.full || state.lastIndexed.IsZero()
+		state.full = false
+		s.stateMu.Unlock()
+
+		lock.mu.Lock()
+		writesBefore := lock.writes
+		lock.mu.Unlock()
+
+		result, err := s.scanStorage(name, full)
+		overtaken := false
+		if err == nil {
+			overtaken = s.updateIndex(name, &result, writesBefore)
+			if result.total > 0 {
+				s.pruneDescriptions(name)
+			}
+			fmt.Printf("Indexed %s: %d entries, %d updated, %d removed, %d folders unchanged, %d hashed\n",
+				name, result.total, result.updated, result.removed, len(result.skipped), result.hashed)
+		} else {
+			fmt.Printf("ERROR: Failed to scan storage %s: %v\n", name, err)
+		}
 
-	for _, f := range files {
-		ext := f.Extension
-		if len(ext) > 0 && ext[0] == '.' {
-			ext = ext[1:]
+		s.stateMu.Lock()
+		if err == nil {
+			state.lastIndexed = time.Now()
+			state.lastError = nil
+		} else {
+			state.lastError = err
 		}
-		_, err = stmt.Exec(storage, f.Name, f.Path, f.IsDir, f.Size, f.ModTime, strings.ToLower(ext), f.ItemCount)
-		if err != nil {
-			// Skip single record error but log it
-			continue
+		again := (state.rerun || overtaken) && attempt < maxIndexReruns
+		if !again {
+			state.scanning = false
+			state.rerun = false
 		}
-	}
+		s.stateMu.Unlock()
 
-	err = tx.Commit()
-	if err != nil {
-		fmt.Printf("Error committing transaction for %s: %v\n", storage, err)
+		if !again {
+			return true
+		}
+		fmt.Printf("Index of %s changed during scan, rescanning\n", name)
 	}
 }
 
-// SEARCH from SQLite (Persistent & Fast)
-func (s *FilesystemService) SearchIndexedFiles(storage string, extensions []string, limit, offset, days int) ([]domain.FileInfo, int) {
-	if s.db == nil {
-		return []domain.FileInfo{}, 0
+// IndexStatus reports index coverage per storage. It only reads: a storage
+// that was never scanned reports not indexed until the background pass or a
+// reindex gets to it.
+func (s *FilesystemService) IndexStatus() []domain.IndexStatus {
+	counts := make(map[string]int)
+	rows, err := s.db.Query("SELECT storage, COUNT(*) FROM files GROUP BY storage")
+	if err == nil {
+		for rows.Next() {
+			var name string
+			var n int
+			if rows.Scan(&name, &n) == nil {
+				counts[name] = n
+			}
+		}
+		rows.Close()
+	}
+
+	var statuses []domain.IndexStatus
+	for _, name := range s.driver.StorageNames() {
+		status := domain.IndexStatus{Storage: name, RowCount: counts[name]}
+
+		s.stateMu.Lock()
+		if state, ok := s.indexState[indexKey(name)]; ok {
+			status.Scanning = state.scanning
+			status.LastErr = state.lastError
+			status.Drift = state.lastDrift
+			if !state.lastIndexed.IsZero() {
+				t := state.lastIndexed
+				status.LastIndexed = &t
+			}
+		}
+		s.stateMu.Unlock()
+		status.Watching = s.watching(name)
+
+		status.Indexed = status.RowCount > 0 || status.LastIndexed != nil
+		statuses = append(statuses, status)
 	}
+	return statuses
+}
+
+// SearchFilter narrows index queries. Nil Storages means all storages; an
+// empty non-nil list matches nothing.
+type SearchFilter struct {
+	Storages   []string
+	Extensions []string
+	// Never matched, even if also listed in Extensions
+	ExcludeExtensions []string
+	Days              int    // modified within the last N days
+	Name              string // substring of the file name, ignoring case and accents
+	// Words matched against name and path; results are ranked by relevance
+	Query string
+
+	fullText bool // Query goes through files_fts
+}
 
+// where builds the shared WHERE clause for search and count queries
+func (f SearchFilter) where() (string, []interface{}) {
 	// Pure content filter (Hide system/hidden noise)
-	query := `SELECT name, path, is_dir, size, modified, extension, item_count 
-              FROM files 
-              WHERE storage = ? AND is_dir = 0 
+	clause := `is_dir = 0
               AND name NOT LIKE '.%' 
               AND name NOT LIKE '$%' 
               AND name NOT LIKE '~%'`
-	args := []interface{}{storage}
+	var args []interface{}
+
+	if f.Storages != nil && len(f.Storages) == 0 {
+		clause += " AND 0"
+	}
+	if len(f.Storages) > 0 {
+		placeholders := make([]string, len(f.Storages))
+		for i, st := range f.Storages {
+			placeholders[i] = "?"
+			args = append(args, st)
+		}
+		clause += " AND storage IN (" + strings.Join(placeholders, ",") + ")"
+	}
 
-	if len(extensions) > 0 {
-		placeholders := make([]string, len(extensions))
-		for i, ext := range extensions {
+	if len(f.Extensions) > 0 {
+		placeholders := make([]string, len(f.Extensions))
+		for i, ext := range f.Extensions {
 			placeholders[i] = "?"
-			args = append(args, strings.ToLower(ext))
+			args = append(args, strings.ToLower(strings.TrimPrefix(ext, ".")))
 		}
-		query += " AND extension IN (" + strings.Join(placeholders, ",") + ")"
+		clause += " AND extension IN (" + strings.Join(placeholders, ",") + ")"
 	}
 
-	if days > 0 {
-		query += " AND modified > ?"
+	if len(f.ExcludeExtensions) > 0 {
+		placeholders := make([]string, len(f.ExcludeExtensions))
+		for i, ext := range f.ExcludeExtensions {
+			placeholders[i] = "?"
+			args = append(args, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		}
+		// COALESCE keeps extensionless files: NULL NOT IN (...) is never true
+		clause += " AND COALESCE(extension, '') NOT IN (" + strings.Join(placeholders, ",") + ")"
+	}
+
+	if f.Days > 0 {
+		clause += " AND modified > ?"
 		// Use formatted string for safer SQLite comparison
-		args = append(args, time.Now().AddDate(0, 0, -days).Format("2006-01-02 15:04:05"))
+		args = append(args, time.Now().AddDate(0, 0, -f.Days).Format("2006-01-02 15:04:05"))
 	}
 
-	// Count total matches
-	countQuery := strings.Replace(query, "name, path, is_dir, size, modified, extension, item_count", "COUNT(*)", 1)
+	if f.Name != "" {
+		// Matched against the case- and accent-folded name
+		clause += ` AND name_norm LIKE ? ESCAPE '\'`
+		args = append(args, likeContains(normalizeName(f.Name)))
+	}
+
+	if f.Query != "" {
+		if match := fullTextMatch(f.Query); f.fullText && match == "" {
+			clause += " AND 0" // nothing but punctuation
+		} else if f.fullText {
+			clause += " AND id IN (SELECT rowid FROM files_fts WHERE files_fts MATCH ?)"
+			args = append(args, match)
+		} else {
+			// LIKE folds ASCII case; name_norm also folds accents
+			pattern := likeContains(normalizeName(f.Query))
+			clause += ` AND (name_norm LIKE ? ESCAPE '\' OR path LIKE ? ESCAPE '\')`
+			args = append(args, pattern, pattern)
+		}
+	}
+
+	return clause, args
+}
+
+// CountIndexedFiles returns only the number of matches, without materializing rows
+func (s *FilesystemService) CountIndexedFiles(filter SearchFilter) int {
+	if s.db == nil {
+		return 0
+	}
+	filter.fullText = s.fullText
+	where, args := filter.where()
 	var total int
-	err := s.db.QueryRow(countQuery, args...).Scan(&total)
-	if err != nil {
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM files WHERE "+where, args...).Scan(&total); err != nil {
 		fmt.Printf("Count error: %v\n", err)
+		return 0
+	}
+	return total
+}
+
+// stableOrder sorts newest first with a unique tiebreaker, for deterministic paging
+const stableOrder = "modified DESC, storage ASC, path ASC"
+
+// SEARCH from SQLite (Persistent & Fast)
+func (s *FilesystemService) SearchIndexedFiles(filter SearchFilter, limit, offset int) ([]domain.FileInfo, int) {
+	if s.db == nil {
 		return []domain.FileInfo{}, 0
 	}
 
+	// Count total matches
+	total := s.CountIndexedFiles(filter)
+
 	// Optimization: If limit is 0 and offset is 0, user likely only wants the total count.
 	if limit <= 0 && offset <= 0 {
 		return []domain.FileInfo{}, total
 	}
 
-	// Add limit and offset
-	query += " ORDER BY modified DESC"
+	filter.fullText = s.fullText
+	from := "files"
+	var args []interface{}
+	if match := fullTextMatch(filter.Query); filter.fullText && match != "" {
+		from = "files JOIN (SELECT rowid AS file_id, " + fullTextRank + " AS score FROM files_fts WHERE files_fts MATCH ?) AS m ON m.file_id = files.id"
+		args = append(args, match)
+	}
+	where, whereArgs := filter.where()
+	rank, rankArgs := filter.rankOrder()
+	args = append(append(args, whereArgs...), rankArgs...)
+	query := "SELECT name, path, is_dir, size, modified, extension, item_count, " + descriptionColumn + " FROM " + from + " WHERE " + where
+
+	// Best text matches first. Many files share a second-resolution mtime;
+	// the tiebreakers keep page boundaries stable so paging neither repeats
+	// nor skips rows.
+	query += " ORDER BY " + rank + stableOrder
 	if limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, limit)
 	}
 	if offset > 0 {
+		if limit <= 0 {
+			query += " LIMIT -1" // SQLite needs LIMIT before OFFSET
+		}
 		query += " OFFSET ?"
 		args = append(args, offset)
 	}
@@ -214,10 +619,12 @@ func (s *FilesystemService) SearchIndexedFiles(storage string, extensions []stri
 	var results []domain.FileInfo
 	for rows.Next() {
 		var f domain.FileInfo
-		var ext sql.NullString
-		err := rows.Scan(&f.Name, &f.Path, &f.IsDir, &f.Size, &f.ModTime, &ext, &f.ItemCount)
+		var ext, description sql.NullString
+		err := rows.Scan(&f.Name, &f.Path, &f.IsDir, &f.Size, &f.ModTime, &ext, &f.ItemCount, &description)
 		if err == nil {
 			f.Extension = ext.String
+			f.Description = description.String
+			f.PreviewType = domain.PreviewTypeFor(ext.String)
 			results = append(results, f)
 		}
 	}
@@ -231,13 +638,13 @@ func (s *FilesystemService) GetRecentFiles(storage string, limit, offset int) []
 	}
 
 	query := `
-		SELECT name, path, is_dir, size, modified, extension 
+		SELECT name, path, is_dir, size, modified, extension, ` + descriptionColumn + `
 		FROM files 
 		WHERE storage = ? AND is_dir = 0 
 		AND name NOT LIKE '.%' 
 		AND name NOT LIKE '$%' 
 		AND name NOT LIKE '~%'
-		ORDER BY modified DESC 
+		ORDER BY ` + stableOrder + `
 		LIMIT ? OFFSET ?
 	`
 	rows, err := s.db.Query(query, storage, limit, offset)
@@ -250,10 +657,12 @@ func (s *FilesystemService) GetRecentFiles(storage string, limit, offset int) []
 	var results []domain.FileInfo
 	for rows.Next() {
 		var f domain.FileInfo
-		var ext sql.NullString
-		err := rows.Scan(&f.Name, &f.Path, &f.IsDir, &f.Size, &f.ModTime, &ext)
+		var ext, description sql.NullString
+		err := rows.Scan(&f.Name, &f.Path, &f.IsDir, &f.Size, &f.ModTime, &ext, &description)
 		if err == nil {
 			f.Extension = ext.String
+			f.Description = description.String
+			f.PreviewType = domain.PreviewTypeFor(ext.String)
 			results = append(results, f)
 		}
 	}
@@ -275,81 +684,519 @@ func (s *FilesystemService) getCache(key string) ([]domain.FileInfo, bool) {
 	return entry.files, true
 }
 
-func (s *FilesystemService) setCache(key string, files []domain.FileInfo) {
+// cacheGeneration must be read before the listing it will guard is produced
+func (s *FilesystemService) cacheGeneration(storage string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generations[storage]
+}
+
+// setCache stores files only if the storage hasn't been invalidated since gen
+// was taken; otherwise the listing may predate a write and is dropped.
+func (s *FilesystemService) setCache(storage, key string, gen uint64, files []domain.FileInfo) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.generations[storage] != gen {
+		return
+	}
 	s.cache[key] = cacheEntry{
 		files:     files,
 		timestamp: time.Now(),
 	}
 }
 
+// invalidateStorage drops cached listings for a storage. Index rows are
+// patched separately by the index* helpers of each write operation.
 func (s *FilesystemService) invalidateStorage(storage string) {
 	s.mu.Lock()
-	// Clear standard cache
-	prefix := fmt.Sprintf("%s:", storage)
+	defer s.mu.Unlock()
+	s.generations[storage]++
+	prefix := storage + ":"
 	for k := range s.cache {
-		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+		if strings.HasPrefix(k, prefix) {
 			delete(s.cache, k)
 		}
 	}
-	s.mu.Unlock()
+}
 
-	// Trigger Reindex for this storage in background
-	go func() {
-		files, err := s.driver.ReadDirRecursive(storage, true)
-		if err == nil {
-			s.updateIndex(storage, files)
+// StorageNames lists the currently registered mounts
+func (s *FilesystemService) StorageNames() []string {
+	return s.driver.StorageNames()
+}
+
+// RejectTrailingSlash reports whether client paths ending in "/" are refused
+// rather than cleaned (PATH_TRAILING_SLASH=reject)
+func (s *FilesystemService) RejectTrailingSlash() bool {
+	return s.cfg.RejectTrailingSlash
+}
+
+// SearchableStorages lists the storages included in storage=all searches
+func (s *FilesystemService) SearchableStorages() []string {
+	names := []string{}
+	for _, name := range s.driver.StorageNames() {
+		if s.StorageOptions(name).IsSearchable() {
+			names = append(names, name)
 		}
-	}()
+	}
+	return names
+}
+
+// FormatSize formats bytes in the configured SIZE_UNITS
+func (s *FilesystemService) FormatSize(bytes int64) string {
+	return domain.FormatSize(bytes, s.cfg.SizeUnitsBinary)
 }
 
 func (s *FilesystemService) ListStorages() []domain.StorageInfo {
-	return s.driver.ListStorages()
+	storages := s.driver.ListStorages()
+	for i := range storages {
+		opts := s.StorageOptions(storages[i].Name)
+		storages[i].Label = opts.Label
+		storages[i].Searchable = opts.IsSearchable()
+		if storages[i].Label == "" {
+			storages[i].Label = storages[i].Name
+		}
+	}
+	return storages
+}
+
+// ListFiles returns the sorted directory listing, capped at ListMaxEntries.
+// The second return value is the total number of entries before truncation.
+// A non-empty glob keeps only the entries whose name matches it.
+func (s *FilesystemService) ListFiles(storage, path string, showHidden bool, glob string, order ListOrder, limit, offset int) ([]domain.FileInfo, int, error) {
+	if err := validateGlob(glob); err != nil {
+		return nil, 0, err
+	}
+	files, _, err := s.listDir(storage, path, showHidden, glob)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.listPage(files, order, limit, offset), len(files), nil
+}
+
+// validateGlob rejects patterns filepath.Match can't evaluate. Globs match
+// names within one folder, so a separator is an error rather than a silent no-match.
+func validateGlob(glob string) error {
+	if glob == "" {
+		return nil
+	}
+	if strings.ContainsRune(glob, '/') {
+		return fmt.Errorf("%w: pattern matches names, not paths", ErrInvalidGlob)
+	}
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGlob, err)
+	}
+	return nil
 }
 
-func (s *FilesystemService) ListFiles(storage, path string, showHidden bool) ([]domain.FileInfo, error) {
-	cacheKey := fmt.Sprintf("%s:%s:%t", storage, path, showHidden)
+// listDir returns the full (uncapped) listing of one folder from the cache,
+// or reads and caches it; cached reports which
+func (s *FilesystemService) listDir(storage, path string, showHidden bool, glob string) ([]domain.FileInfo, bool, error) {
+	cacheKey := fmt.Sprintf("%s:%s:%t:%s", storage, path, showHidden, glob)
 	if files, hit := s.getCache(cacheKey); hit {
-		return files, nil
+		return files, true, nil
 	}
 
-	files, err := s.driver.ReadDir(storage, path, showHidden)
-	if err == nil {
-		s.setCache(cacheKey, files)
+	gen := s.cacheGeneration(storage)
+	files, err := s.driver.ReadDirWithCounts(storage, path, showHidden, glob, s.indexedItemCounts(storage, path))
+	if err != nil {
+		return nil, false, err
 	}
-	return files, err
+	s.describe(storage, path, false, files)
+	sortFiles(files)
+	s.setCache(storage, cacheKey, gen, files)
+	return files, false, nil
 }
 
-func (s *FilesystemService) ListAllFiles(storage string, showHidden bool) ([]domain.FileInfo, error) {
+// indexedItemCounts returns the indexed child counts of path's immediate
+// subfolders, keyed by name. Nil unless LIST_COUNTS_FROM_INDEX is set and this
+// process has completed a scan of the storage (older rows may predate counts).
+func (s *FilesystemService) indexedItemCounts(storage, path string) map[string]filesystem.KnownCount {
+	if !s.cfg.ListCountsFromIndex || s.db == nil {
+		return nil
+	}
+	s.stateMu.Lock()
+	state, ok := s.indexState[indexKey(storage)]
+	scanned := ok && !state.lastIndexed.IsZero()
+	s.stateMu.Unlock()
+	if !scanned {
+		return nil
+	}
+
+	p := indexPath(path)
+	query := "SELECT name, item_count, modified FROM files WHERE storage = ? AND is_dir AND instr(path, '/') = 0"
+	args := []interface{}{storage}
+	if p != "" {
+		query = `SELECT name, item_count, modified FROM files WHERE storage = ? AND is_dir AND path LIKE ? ESCAPE '\' AND instr(substr(path, ?), '/') = 0`
+		args = append(args, likePrefix(p), len(p)+2)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	counts := make(map[string]filesystem.KnownCount)
+	for rows.Next() {
+		var name string
+		var k filesystem.KnownCount
+		if err := rows.Scan(&name, &k.Count, &k.ModTime); err == nil {
+			counts[name] = k
+		}
+	}
+	return counts
+}
+
+func (s *FilesystemService) ListAllFiles(storage string, showHidden bool, order ListOrder, limit, offset int) ([]domain.FileInfo, int, error) {
 	cacheKey := fmt.Sprintf("%s:recursive:%t", storage, showHidden)
 	if files, hit := s.getCache(cacheKey); hit {
-		return files, nil
+		return s.listPage(files, order, limit, offset), len(files), nil
 	}
 
+	gen := s.cacheGeneration(storage)
 	files, err := s.driver.ReadDirRecursive(storage, showHidden)
-	if err == nil {
-		s.setCache(cacheKey, files)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.describe(storage, "", true, files)
+	sortFiles(files)
+	s.setCache(storage, cacheKey, gen, files)
+	return s.listPage(files, order, limit, offset), len(files), nil
+}
+
+// Listing sort keys
+const (
+	SortByName     = "name"
+	SortBySize     = "size"
+	SortByModified = "modified"
+	SortByType     = "type" // extension
+)
+
+// ListOrder is the order of a listing
+type ListOrder struct {
+	By        string
+	Desc      bool
+	DirsFirst bool
+}
+
+// DefaultListOrder is what listings are cached in: directories first, then
+// case-insensitive name
+var DefaultListOrder = ListOrder{By: SortByName, DirsFirst: true}
+
+// ErrInvalidSort is returned for an unknown sort key or direction
+var ErrInvalidSort = errors.New("invalid_sort")
+
+// ParseListOrder reads the sort ("" = name) and order ("" = asc) params
+func ParseListOrder(by, direction string, dirsFirst bool) (ListOrder, error) {
+	order := ListOrder{By: strings.ToLower(by), DirsFirst: dirsFirst}
+	switch order.By {
+	case "":
+		order.By = SortByName
+	case SortByName, SortBySize, SortByModified, SortByType:
+	default:
+		return order, fmt.Errorf("%w: sort by name, size, modified or type", ErrInvalidSort)
+	}
+	switch strings.ToLower(direction) {
+	case "", "asc":
+	case "desc":
+		order.Desc = true
+	default:
+		return order, fmt.Errorf("%w: order is asc or desc", ErrInvalidSort)
+	}
+	return order, nil
+}
+
+// Sorting happens before truncation so the cap keeps the most relevant entries.
+func sortFiles(files []domain.FileInfo) {
+	sortFilesBy(files, DefaultListOrder)
+}
+
+// sortFilesBy sorts by the order's key, ties broken by case-insensitive and
+// then exact name (ascending either way), so equal keys never depend on the
+// order the entries were read in
+func sortFilesBy(files []domain.FileInfo, order ListOrder) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if order.DirsFirst && a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		c := 0
+		switch order.By {
+		case SortBySize:
+			c = cmp.Compare(a.Size, b.Size)
+		case SortByModified:
+			c = a.ModTime.Compare(b.ModTime)
+		case SortByType:
+			c = cmp.Compare(strings.ToLower(a.Extension), strings.ToLower(b.Extension))
+		}
+		if order.Desc {
+			c = -c
+		}
+		if c == 0 {
+			if c = cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c == 0 {
+				c = cmp.Compare(a.Name, b.Name)
+			}
+			if order.By == SortByName && order.Desc {
+				c = -c
+			}
+		}
+		return c < 0
+	})
+}
+
+// reorder returns a cached listing in another order, sorting a copy
+func reorder(files []domain.FileInfo, order ListOrder) []domain.FileInfo {
+	if order == DefaultListOrder {
+		return files
+	}
+	sorted := make([]domain.FileInfo, len(files))
+	copy(sorted, files)
+	sortFilesBy(sorted, order)
+	return sorted
+}
+
+// listPage returns the window [offset, offset+limit) of a full listing in
+// the given order; limit 0 means up to the cap
+func (s *FilesystemService) listPage(files []domain.FileInfo, order ListOrder, limit, offset int) []domain.FileInfo {
+	files = reorder(files, order)
+	if offset > 0 {
+		files = files[min(offset, len(files)):]
+	}
+	if limit > 0 && limit < len(files) {
+		files = files[:limit]
+	}
+	return s.capListing(files)
+}
+
+// Hard backstop against huge directories (the cached slice is never modified)
+func (s *FilesystemService) capListing(files []domain.FileInfo) []domain.FileInfo {
+	max := s.cfg.ListMaxEntries
+	if max > 0 && len(files) > max {
+		return files[:max]
+	}
+	return files
+}
+
+func (s *FilesystemService) Stat(storage, path string) (domain.FileInfo, error) {
+	info, err := s.driver.Stat(storage, path)
+	if err == nil && s.db != nil {
+		s.db.QueryRow("SELECT description FROM descriptions WHERE storage = ? AND path = ?", storage, indexPath(path)).Scan(&info.Description)
+	}
+	return info, err
+}
+
+// Exists reports whether path exists and is a folder; symlinks aren't followed
+func (s *FilesystemService) Exists(storage, path string) (exists, isDir bool, err error) {
+	return s.driver.Exists(storage, path)
+}
+
+// checkWritable enforces the storage's read_only and write_prefixes settings
+// on the cleaned relative path. The trash folder is never writable this way:
+// its records decide where a restore goes, so only the trash methods touch it.
+func (s *FilesystemService) checkWritable(storage, path string) error {
+	if filesystem.InTrash(path) {
+		return ErrInTrash
+	}
+	opts := s.StorageOptions(storage)
+	if opts.ReadOnly {
+		return ErrWriteNotAllowed
+	}
+	prefixes := opts.WritePrefixes
+	if len(prefixes) == 0 {
+		return nil
+	}
+	p := indexPath(path)
+	for _, prefix := range prefixes {
+		pre := indexPath(prefix)
+		if pre == "" || p == pre || strings.HasPrefix(p, pre+"/") {
+			return nil
+		}
+	}
+	return ErrWriteNotAllowed
+}
+
+// checkNameLength rejects a path with a component over MaxNameBytes or a full
+// on-disk path over MaxPathBytes. Filesystems limit bytes, not characters.
+func (s *FilesystemService) checkNameLength(storage, path string) error {
+	for _, name := range strings.Split(indexPath(path), "/") {
+		if s.cfg.MaxNameBytes > 0 && len(name) > s.cfg.MaxNameBytes {
+			return fmt.Errorf("%w: name is %d bytes (max %d)", ErrNameTooLong, len(name), s.cfg.MaxNameBytes)
+		}
+	}
+	if s.cfg.MaxPathBytes > 0 {
+		realPath, err := s.driver.GetRealPath(storage, path)
+		if err == nil && len(realPath) > s.cfg.MaxPathBytes {
+			return fmt.Errorf("%w: path is %d bytes (max %d)", ErrNameTooLong, len(realPath), s.cfg.MaxPathBytes)
+		}
+	}
+	return nil
+}
+
+// checkDestination rejects dst == src and dst nested under src, which would
+// make copyDir recurse into its own output or move a folder into itself
+func checkDestination(src, dst string) error {
+	if within("/"+indexPath(src), "/"+indexPath(dst)) {
+		return fmt.Errorf("%w: %s is inside %s", ErrInvalidDestination, dst, src)
 	}
-	return files, err
+	return nil
 }
 
 func (s *FilesystemService) CreateFolder(storage, path string) error {
+	if err := s.checkWritable(storage, path); err != nil {
+		return err
+	}
+	if err := s.checkNameLength(storage, path); err != nil {
+		return err
+	}
+	created := path
+	if top := s.missingAncestor(storage, path); top != "" {
+		created = top
+	}
 	err := s.driver.CreateFolder(storage, path)
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexUpsert(storage, created)
 	}
 	return err
 }
 
-func (s *FilesystemService) UploadFile(storage, path string, src io.Reader) error {
-	err := s.driver.SaveFile(storage, path, src)
+// CreateFile creates an empty file; an existing path fails with ErrTargetExists
+func (s *FilesystemService) CreateFile(storage, path string) error {
+	if err := s.checkWritable(storage, path); err != nil {
+		return err
+	}
+	if err := s.checkNameLength(storage, path); err != nil {
+		return err
+	}
+	created := path
+	if top := s.missingAncestor(storage, path); top != "" {
+		created = top
+	}
+	err := s.driver.CreateFile(storage, path)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrTargetExists, path)
+	}
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexUpsert(storage, created)
 	}
 	return err
 }
 
+// Take an upload slot, waiting up to UploadQueueSeconds for one to free up
+func (s *FilesystemService) acquireUploadSlot() (func(), error) {
+	if s.uploadSlots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-s.uploadSlots }
+
+	select {
+	case s.uploadSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if s.cfg.UploadQueueSeconds <= 0 {
+		return nil, ErrUploadBusy
+	}
+
+	timer := time.NewTimer(time.Duration(s.cfg.UploadQueueSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case s.uploadSlots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrUploadBusy
+	}
+}
+
+// checkSpace refuses a write of bytes to path that wouldn't fit on its
+// filesystem with MIN_FREE_SPACE_PERCENT left over. Unknown sizes (<= 0) pass.
+func (s *FilesystemService) checkSpace(storage, path string, bytes int64) error {
+	ok, err := s.driver.HasSpaceFor(storage, path, bytes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %d bytes don't fit on storage %s", ErrInsufficientSpace, bytes, storage)
+	}
+	return nil
+}
+
+// UploadFile saves src (size bytes, <= 0 if unknown) at path and reports
+// where it ended up, its size and SHA-256. When path is taken, onConflict
+// decides: skip refuses with ErrTargetExists, rename picks a free numeric
+// suffix like Duplicate, overwrite replaces the file. Skip and rename never
+// replace a file, even one another upload creates meanwhile. A non-empty
+// expectedSHA must match the received bytes or nothing is written
+// (ErrChecksumMismatch).
+func (s *FilesystemService) UploadFile(storage, path string, src io.Reader, size int64, onConflict ConflictPolicy, expectedSHA string) (domain.UploadResponse, error) {
+	var res domain.UploadResponse
+	if expectedSHA != "" && !sha256Regex.MatchString(expectedSHA) {
+		return res, ErrInvalidChecksum
+	}
+	if err := s.checkWritable(storage, path); err != nil {
+		return res, err
+	}
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if s.pathExists(storage, path) {
+		switch onConflict {
+		case ConflictSkip:
+			return res, ErrTargetExists
+		case ConflictRename:
+			path = s.availablePath(storage, dir, stem, ext)
+		}
+	}
+	if err := s.checkNameLength(storage, path); err != nil {
+		return res, err
+	}
+	if err := s.checkSpace(storage, path, size); err != nil {
+		return res, err
+	}
+	release, err := s.acquireUploadSlot()
+	if err != nil {
+		return res, err
+	}
+	defer release()
+
+	top := s.missingAncestor(storage, path)
+	upload, err := s.driver.StageUpload(storage, path, src, expectedSHA)
+	if err != nil {
+		return res, err
+	}
+	for {
+		err = upload.Place(path, onConflict == ConflictOverwrite)
+		if err == nil || !errors.Is(err, os.ErrExist) {
+			break
+		}
+		// Taken since the check above
+		if onConflict != ConflictRename {
+			err = ErrTargetExists
+			break
+		}
+		path = s.availablePath(storage, dir, stem, ext)
+		if err = s.checkNameLength(storage, path); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		upload.Discard()
+		return res, err
+	}
+	s.invalidateStorage(storage)
+	var known map[string]indexedHash
+	if s.cfg.IndexHashEnabled {
+		known = map[string]indexedHash{indexPath(path): {size: upload.Size, sha256: upload.SHA256}}
+	}
+	created := path
+	if top != "" {
+		created = top
+	}
+	s.indexUpsertKnown(storage, created, known)
+	return domain.UploadResponse{FilePath: path, Size: upload.Size, SHA256: upload.SHA256}, nil
+}
+
 func (s *FilesystemService) GetRealPath(storage, path string) (string, error) {
 	return s.driver.GetRealPath(storage, path)
 }
@@ -359,68 +1206,340 @@ func (s *FilesystemService) DownloadFile(storage, path string) (io.ReadCloser, e
 }
 
 func (s *FilesystemService) RenameOrMove(storage, oldPath, newPath string) error {
+	// Moving out of a read-only area would modify it too
+	if err := s.checkWritable(storage, oldPath); err != nil {
+		return err
+	}
+	if err := s.checkWritable(storage, newPath); err != nil {
+		return err
+	}
+	if err := checkDestination(oldPath, newPath); err != nil {
+		return err
+	}
+	if err := s.checkNameLength(storage, newPath); err != nil {
+		return err
+	}
 	err := s.driver.Rename(storage, oldPath, newPath)
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexRename(storage, oldPath, newPath)
 	}
 	return err
 }
 
+// Swap exchanges two paths so neither is ever missing; atomic is false when
+// the platform or filesystem forced the three-way rename fallback
+func (s *FilesystemService) Swap(storage, pathA, pathB string) (bool, error) {
+	if err := s.checkWritable(storage, pathA); err != nil {
+		return false, err
+	}
+	if err := s.checkWritable(storage, pathB); err != nil {
+		return false, err
+	}
+	if err := checkDestination(pathA, pathB); err != nil {
+		return false, err
+	}
+	if err := checkDestination(pathB, pathA); err != nil {
+		return false, err
+	}
+	atomic, err := s.driver.Swap(storage, pathA, pathB)
+	if err == nil {
+		s.invalidateStorage(storage)
+		// Exchange the index rows through an upload temp name, which is never indexed
+		parked := filepath.Join(filepath.Dir(pathA), "."+filepath.Base(pathA)+".tmp-0")
+		s.indexRenames(storage, [][2]string{{pathA, parked}, {pathB, pathA}, {parked, pathB}})
+	}
+	return atomic, err
+}
+
+// Touch sets the modification time of a path (and with recursive of its
+// whole subtree) and refreshes the index rows. Contents don't change, so the
+// rows keep their hashes.
+func (s *FilesystemService) Touch(storage, path string, t time.Time, recursive bool) (int, error) {
+	if err := s.checkWritable(storage, path); err != nil {
+		return 0, err
+	}
+	known := s.indexedHashes(storage, path)
+	touched, err := s.driver.Touch(storage, path, t, recursive)
+	if touched > 0 {
+		s.invalidateStorage(storage)
+		s.indexUpsertKnown(storage, path, known)
+	}
+	return touched, err
+}
+
 func (s *FilesystemService) Copy(storage, srcPath, dstPath string) error {
+	if err := s.checkWritable(storage, dstPath); err != nil {
+		return err
+	}
+	if err := checkDestination(srcPath, dstPath); err != nil {
+		return err
+	}
+	if err := s.checkNameLength(storage, dstPath); err != nil {
+		return err
+	}
+	if err := s.checkCopySpace(storage, srcPath, dstPath); err != nil {
+		return err
+	}
 	err := s.driver.Copy(storage, srcPath, dstPath)
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexUpsert(storage, dstPath)
 	}
 	return err
 }
 
+// checkCopySpace sizes the source tree first; copies don't keep hard links,
+// so every name needs its full size
+func (s *FilesystemService) checkCopySpace(storage, srcPath, dstPath string) error {
+	usage, err := s.driver.DirSize(storage, srcPath)
+	if err != nil {
+		return err
+	}
+	return s.checkSpace(storage, dstPath, usage.ApparentBytes)
+}
+
+// availablePath returns dir/stem+ext, or the first free dir/stem_N+ext
+func (s *FilesystemService) availablePath(storage, dir, stem, ext string) string {
+	candidate := filepath.Join(dir, stem+ext)
+	for counter := 1; ; counter++ {
+		realPath, err := s.driver.GetRealPath(storage, candidate)
+		if err != nil {
+			return candidate
+		}
+		if _, err := os.Lstat(realPath); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s_%d%s", stem, counter, ext))
+	}
+}
+
 func (s *FilesystemService) Duplicate(storage, srcPath string) error {
 	// Generate new path: /path/to/file.txt -> /path/to/file_copy.txt
 	// For folders: /path/to/folder -> /path/to/folder_copy
+	// If taken: file_copy_1.txt, file_copy_2.txt, ...
 	dir := filepath.Dir(srcPath)
 	base := filepath.Base(srcPath)
 	ext := filepath.Ext(base)
 	nameWithoutExt := strings.TrimSuffix(base, ext)
 
-	newPath := filepath.Join(dir, nameWithoutExt+"_copy"+ext)
+	newPath := s.availablePath(storage, dir, nameWithoutExt+"_copy", ext)
 
-	// Check if exists, if so add number
-	counter := 1
-	for {
-		realPath, _ := s.driver.GetRealPath(storage, newPath)
-		if _, err := os.Stat(realPath); os.IsNotExist(err) {
-			break
-		}
-		newPath = filepath.Join(dir, fmt.Sprintf("%s_copy_%d%s", nameWithoutExt, counter, ext))
-		counter++
+	if err := s.checkWritable(storage, newPath); err != nil {
+		return err
+	}
+	if err := s.checkNameLength(storage, newPath); err != nil {
+		return err
+	}
+	if err := s.checkCopySpace(storage, srcPath, newPath); err != nil {
+		return err
 	}
-
 	err := s.driver.Copy(storage, srcPath, newPath)
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexUpsert(storage, newPath)
 	}
 	return err
 }
 
+// ConflictPolicy says what a batch move does when the target name is taken
+type ConflictPolicy string
+
+const (
+	ConflictRename    ConflictPolicy = "rename"    // numeric suffix: photo.jpg -> photo_1.jpg
+	ConflictSkip      ConflictPolicy = "skip"      // leave the item where it is, reported as failed
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace the existing file/folder
+)
+
+// ErrInvalidConflict is returned for an unknown on_conflict value
+var ErrInvalidConflict = errors.New("invalid_on_conflict")
+
+// ParseConflictPolicy reads the on_conflict field ("" = rename)
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(value)); p {
+	case "":
+		return ConflictRename, nil
+	case ConflictRename, ConflictSkip, ConflictOverwrite:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: use skip, overwrite or rename", ErrInvalidConflict)
+}
+
+// MoveFiles moves each source into destFolder under its own name; onConflict
+// decides what happens when that name is taken. Cache and index are updated
+// once at the end.
+func (s *FilesystemService) MoveFiles(storage string, srcs []string, destFolder string, onConflict ConflictPolicy) ([]domain.BatchResult, error) {
+	isDir, err := s.driver.IsDir(storage, destFolder)
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		return nil, fmt.Errorf("%w: %s", ErrNotAFolder, destFolder)
+	}
+	if err := s.checkWritable(storage, destFolder); err != nil {
+		return nil, err
+	}
+
+	results := make([]domain.BatchResult, 0, len(srcs))
+	var moves [][2]string
+	var replaced []string
+	for _, src := range srcs {
+		res := domain.BatchResult{Path: src}
+
+		if filepath.Clean("/"+filepath.Dir(src)) == filepath.Clean("/"+destFolder) {
+			res.Err = fmt.Errorf("%w: %s", ErrAlreadyInDestination, destFolder)
+			results = append(results, res)
+			continue
+		}
+		if err := s.checkWritable(storage, src); err != nil {
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		if err := checkDestination(src, destFolder); err != nil {
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+
+		base := filepath.Base(src)
+		dst := filepath.Join(destFolder, base)
+		taken := s.pathExists(storage, dst)
+		if taken && onConflict == ConflictRename {
+			ext := filepath.Ext(base)
+			dst = s.availablePath(storage, destFolder, strings.TrimSuffix(base, ext), ext)
+			taken = false
+		}
+		res.Destination = dst
+		if taken && onConflict == ConflictSkip {
+			res.Err = fmt.Errorf("%w: %s", ErrTargetExists, dst)
+			results = append(results, res)
+			continue
+		}
+		if err := s.checkNameLength(storage, dst); err != nil {
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+
+		if taken {
+			err = s.driver.Replace(storage, src, dst)
+		} else {
+			err = s.driver.Rename(storage, src, dst)
+		}
+		if err != nil {
+			res.Err = err
+		} else {
+			res.Success = true
+			if taken {
+				replaced = append(replaced, dst)
+			}
+			moves = append(moves, [2]string{src, dst})
+		}
+		results = append(results, res)
+	}
+
+	if len(moves) > 0 {
+		s.invalidateStorage(storage)
+		// Rows of overwritten items go first so the moved rows can take their paths
+		for _, dst := range replaced {
+			s.indexRemove(storage, dst)
+		}
+		s.indexRenames(storage, moves)
+	}
+	return results, nil
+}
+
+// pathExists reports whether anything (even a broken symlink) is at path
+func (s *FilesystemService) pathExists(storage, path string) bool {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Lstat(realPath)
+	return err == nil
+}
+
 func (s *FilesystemService) Delete(storage, path string) error {
+	if indexPath(path) == "" {
+		return fmt.Errorf("%w: cannot delete the storage root", ErrWriteNotAllowed)
+	}
+	if err := s.checkWritable(storage, path); err != nil {
+		return err
+	}
 	err := s.driver.Delete(storage, path)
 	if err == nil {
 		s.invalidateStorage(storage)
+		s.indexRemove(storage, path)
 	}
 	return err
 }
 
+// DeleteBatch deletes several paths permanently and reports each one; a
+// failure doesn't stop the rest. The cache is invalidated once at the end.
+func (s *FilesystemService) DeleteBatch(storage string, paths []string) []domain.BatchResult {
+	results := make([]domain.BatchResult, 0, len(paths))
+	var deleted []string
+	for _, path := range paths {
+		res := domain.BatchResult{Path: path}
+		if indexPath(path) == "" {
+			res.Err = fmt.Errorf("%w: cannot delete the storage root", ErrWriteNotAllowed)
+			results = append(results, res)
+			continue
+		}
+		if err := s.checkWritable(storage, path); err != nil {
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		// RemoveAll succeeds on a missing path; report it instead
+		if _, err := s.driver.IsDir(storage, path); err != nil {
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+
+		if err := s.driver.Delete(storage, path); err != nil {
+			res.Err = err
+		} else {
+			res.Success = true
+			deleted = append(deleted, path)
+		}
+		results = append(results, res)
+	}
+
+	if len(deleted) > 0 {
+		s.invalidateStorage(storage)
+		for _, path := range deleted {
+			s.indexRemove(storage, path)
+		}
+	}
+	return results
+}
+
 func (s *FilesystemService) IsDirectory(storage, path string) (bool, error) {
 	return s.driver.IsDir(storage, path)
 }
 
 func (s *FilesystemService) GetVideoThumbnail(realPath string) ([]byte, error) {
+	ffmpeg, err := s.toolPath(ToolFFmpeg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.mediaContext()
+	defer cancel()
+	release, err := s.acquireMediaSlot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for media slot: %w", err)
+	}
+	defer release()
+
 	// Extract 1 frame at 1 second
-	cmd := exec.Command("ffmpeg", "-ss", "00:00:01", "-i", realPath, "-vframes", "1", "-f", "mjpeg", "-q:v", "5", "pipe:1")
+	cmd := exec.CommandContext(ctx, ffmpeg, "-ss", "00:00:01", "-i", realPath, "-vframes", "1", "-f", "mjpeg", "-q:v", "5", "pipe:1")
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		fmt.Printf("Thumbnail error for %s: %v\n", realPath, err)
 		return nil, err
 	}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Text search over names and paths. Builds with FTS5 (go build -tags
+// sqlite_fts5) keep files_fts, an external-content FTS5 table over
+// files.name and files.path, in sync through triggers, so every writer of
+// the files table (scans, watcher, write patches, renames) updates it
+// without knowing about it. Matches are ranked with bm25, names weighing
+// more than paths. Builds without FTS5 fall back to a case- and
+// accent-insensitive substring match, ranked exact name > name prefix >
+// name substring > path only.
+
+const fullTextSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+		name, path, content='files', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER IF NOT EXISTS files_fts_insert AFTER INSERT ON files BEGIN
+		INSERT INTO files_fts(rowid, name, path) VALUES (new.id, new.name, new.path);
+	END;
+	CREATE TRIGGER IF NOT EXISTS files_fts_delete AFTER DELETE ON files BEGIN
+		INSERT INTO files_fts(files_fts, rowid, name, path) VALUES ('delete', old.id, old.name, old.path);
+	END;
+	CREATE TRIGGER IF NOT EXISTS files_fts_update AFTER UPDATE OF name, path ON files BEGIN
+		INSERT INTO files_fts(files_fts, rowid, name, path) VALUES ('delete', old.id, old.name, old.path);
+		INSERT INTO files_fts(rowid, name, path) VALUES (new.id, new.name, new.path);
+	END;
+`
+
+// bm25 weights of the name and path columns
+const fullTextRank = "bm25(files_fts, 10.0, 1.0)"
+
+// setupFullText creates files_fts and its triggers and reports whether FTS5
+// is available. Without it the triggers are dropped: they would make every
+// write to files fail, e.g. after switching back to a build without FTS5.
+func setupFullText(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, err
+	}
+	if !enabled {
+		_, err := db.Exec(`
+			DROP TRIGGER IF EXISTS files_fts_insert;
+			DROP TRIGGER IF EXISTS files_fts_delete;
+			DROP TRIGGER IF EXISTS files_fts_update;
+		`)
+		return false, err
+	}
+
+	var triggers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'files_fts%'").Scan(&triggers); err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(fullTextSchema); err != nil {
+		return false, err
+	}
+	// New table, or writes happened without the triggers: index everything
+	if triggers < 3 {
+		if _, err := db.Exec("INSERT INTO files_fts(files_fts) VALUES('rebuild')"); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// fullTextMatch turns free text into an FTS5 query: every word must appear,
+// as a word or the start of one. Returns "" when there are no words.
+func fullTextMatch(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// rankOrder returns the ORDER BY terms that put the best matches of Query
+// first, with their args. In full-text mode the query must join the scores
+// as "m" (see SearchIndexedFiles).
+func (f SearchFilter) rankOrder() (string, []interface{}) {
+	if f.Query == "" {
+		return "", nil
+	}
+	if f.fullText {
+		if fullTextMatch(f.Query) == "" {
+			return "", nil // matches nothing anyway
+		}
+		return "m.score, ", nil
+	}
+	q := normalizeName(f.Query)
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+	return `CASE WHEN name_norm = ? THEN 0 WHEN name_norm LIKE ? ESCAPE '\' THEN 1 WHEN name_norm LIKE ? ESCAPE '\' THEN 2 ELSE 3 END, `,
+		[]interface{}{q, escaped + "%", likeContains(q)}
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"strings"
+	"testing"
+)
+
+func TestHardlinkDedup(t *testing.T) {
+	s, root := hashingService(t)
+	content := strings.Repeat("x", 1000)
+	original := writeFile(t, root, "media/a.mp4", content)
+	if err := os.Link(original, filepath.Join(root, "media", "b.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "media/c.mp4", content) // a real copy
+	writeFile(t, root, "media/d.mp4", strings.Repeat("y", 500))
+	s.indexStorage("ssd", true)
+
+	tests := []struct {
+		dedup      bool
+		copies     int   // of the a/b/c content in the duplicate finder
+		files      int   // .mp4 files in the composition stats
+		totalBytes int64 // estimate of the folder
+	}{
+		{false, 3, 4, 3500},
+		{true, 2, 3, 2500},
+	}
+	for _, tt := range tests {
+		s.cfg.HardlinkDedup = tt.dedup
+
+		groups, err := s.FindDuplicates("ssd", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].Count != tt.copies {
+			t.Errorf("dedup %v: duplicates = %+v, want one group of %d", tt.dedup, groups, tt.copies)
+		}
+
+		totals, err := s.extensionTotals(SearchFilter{Storages: []string{"ssd"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := totals["mp4"]; got.count != tt.files || got.size != tt.totalBytes {
+			t.Errorf("dedup %v: mp4 totals = %+v, want %d files, %d bytes", tt.dedup, got, tt.files, tt.totalBytes)
+		}
+
+		est, err := s.Estimate(domain.EstimateRequest{Operation: "copy", Storage: "ssd", Paths: []string{"media"}, Destination: "/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A copy writes every name as a full file either way
+		if est.TotalBytes != tt.totalBytes || est.RequiredBytes != 3500 || est.FileCount != 4 {
+			t.Errorf("dedup %v: estimate = %+v, want total %d, required 3500, 4 files", tt.dedup, est, tt.totalBytes)
+		}
+	}
+
+	// Two names of one inode alone are not duplicates
+	if err := os.Remove(filepath.Join(root, "media", "c.mp4")); err != nil {
+		t.Fatal(err)
+	}
+	s.indexStorage("ssd", true)
+	if groups, _ := s.FindDuplicates("ssd", 10); len(groups) != 0 {
+		t.Errorf("hard links alone reported as duplicates: %+v", groups)
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// ErrUnsupportedHash is returned for algorithm names the resolver doesn't know
+var ErrUnsupportedHash = errors.New("unsupported_hash_algorithm")
+
+// HashSHA256 is what the index stores for duplicate detection
+const HashSHA256 = "sha256"
+
+// Every feature that hashes content picks its algorithm from this set
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"blake3": func() hash.Hash { return blake3.New(32, nil) },
+}
+
+// HashAlgorithms lists the supported algorithm names
+func HashAlgorithms() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveHashAlgorithm validates a requested algorithm (case-insensitive,
+// "sha-256" == "sha256"); empty selects CHECKSUM_ALGORITHM
+func (s *FilesystemService) ResolveHashAlgorithm(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		name = s.cfg.ChecksumAlgorithm
+	}
+	name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "")
+	if _, ok := hashAlgorithms[name]; !ok {
+		return "", fmt.Errorf("%w: %q (supported: %s)", ErrUnsupportedHash, name, strings.Join(HashAlgorithms(), ", "))
+	}
+	return name, nil
+}
+
+// hashReader returns the hex digest of r; algo must come from ResolveHashAlgorithm
+func hashReader(algo string, r io.Reader) (string, error) {
+	newHash, ok := hashAlgorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedHash, algo)
+	}
+	h := newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checksum hashes a stored file with the requested algorithm
+func (s *FilesystemService) Checksum(storage, path, algo string) (string, string, error) {
+	algo, err := s.ResolveHashAlgorithm(algo)
+	if err != nil {
+		return "", "", err
+	}
+	sum, err := s.hashFile(storage, path, algo)
+	return algo, sum, err
+}
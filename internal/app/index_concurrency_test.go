@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentReindexAndWrites(t *testing.T) {
+	s, root := newTestService(t, nil)
+	for i := 0; i < 50; i++ {
+		writeFile(t, root, fmt.Sprintf("seed/f%d.txt", i), "x")
+	}
+	s.indexStorage("ssd", true)
+
+	const writers, perWriter, scanners = 3, 20, 3
+	var wg sync.WaitGroup
+	for i := 0; i < scanners; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				s.indexStorage("ssd", true)
+			}
+		}()
+	}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := s.CreateFile("ssd", fmt.Sprintf("/w%d/f%d.txt", w, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// seed + w0..w2 folders, and their files
+	want := 1 + 50 + writers + writers*perWriter
+	var rows, distinct int
+	if err := s.db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT path) FROM files WHERE storage = 'ssd'").Scan(&rows, &distinct); err != nil {
+		t.Fatal(err)
+	}
+	if rows != want || distinct != want {
+		t.Errorf("index has %d rows (%d distinct paths), want %d", rows, distinct, want)
+	}
+
+	// A full scan afterwards finds nothing to fix
+	s.indexStorage("ssd", true)
+	var after int
+	s.db.QueryRow("SELECT COUNT(*) FROM files WHERE storage = 'ssd'").Scan(&after)
+	if after != want {
+		t.Errorf("rescan changed the row count to %d, want %d", after, want)
+	}
+}
+
+func TestScanStateIgnoresStorageNameCase(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	s.stateMu.Lock()
+	s.indexState[indexKey("ssd")] = &indexState{scanning: true}
+	s.stateMu.Unlock()
+
+	if s.indexStorage("SSD", false) {
+		t.Fatal("a scan of SSD ran while one of ssd was running")
+	}
+	s.stateMu.Lock()
+	rerun := s.indexState["ssd"].rerun
+	s.stateMu.Unlock()
+	if !rerun {
+		t.Error("the running scan was not asked to rerun")
+	}
+	if s.storageIndexLock("SSD") != s.storageIndexLock("ssd") {
+		t.Error("SSD and ssd have different index locks")
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+// indexedSHA is the sha256 stored in path's index row, "" when it has none
+func indexedSHA(t *testing.T, s *FilesystemService, path string) string {
+	t.Helper()
+	var sum sql.NullString
+	if err := s.db.QueryRow("SELECT sha256 FROM files WHERE storage = 'ssd' AND path = ?", path).Scan(&sum); err != nil {
+		t.Fatalf("index row %s: %v", path, err)
+	}
+	return sum.String
+}
+
+func hashingService(t *testing.T) (*FilesystemService, string) {
+	return newTestService(t, func(cfg *config.Config) {
+		cfg.IndexHashEnabled = true
+		cfg.IndexHashMaxBytes = 1 << 20
+	})
+}
+
+func TestUploadIndexesItsHash(t *testing.T) {
+	s, _ := hashingService(t)
+	const content = "uploaded content"
+	res, err := s.UploadFile("ssd", "/docs/a.txt", strings.NewReader(content), int64(len(content)), ConflictOverwrite, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	want := hex.EncodeToString(sum[:])
+	if res.SHA256 != want {
+		t.Fatalf("response sha256 = %s, want %s", res.SHA256, want)
+	}
+	if got := indexedSHA(t, s, "docs/a.txt"); got != want {
+		t.Errorf("indexed sha256 after upload = %q, want %s", got, want)
+	}
+
+	// A full scan keeps it, though no other file shares the size
+	s.indexStorage("ssd", true)
+	if got := indexedSHA(t, s, "docs/a.txt"); got != want {
+		t.Errorf("indexed sha256 after a full scan = %q, want %s", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"fmt"
+	"storages-api/internal/config"
+	"sync"
+	"testing"
+)
+
+func TestMemoryIndexConcurrentWrites(t *testing.T) {
+	hdd := t.TempDir()
+	s, ssd := newTestService(t, func(cfg *config.Config) {
+		cfg.IndexDBPath = ":memory:"
+		cfg.StorageMounts["hdd"] = hdd
+	})
+	const perStorage = 40
+	var wg sync.WaitGroup
+	for storage, root := range map[string]string{"ssd": ssd, "hdd": hdd} {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perStorage; i++ {
+				name := fmt.Sprintf("f%d.txt", i)
+				writeFile(t, root, name, "x")
+				s.indexUpsert(storage, "/"+name)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perStorage; i++ {
+				s.SearchIndexedFiles(SearchFilter{Storages: []string{storage}, Name: "f"}, 10, 0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM files").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2*perStorage {
+		t.Errorf("indexed %d rows, want %d", n, 2*perStorage)
+	}
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"strings"
+)
+
+// Incremental index maintenance: write operations patch just the rows they
+// touch instead of rescanning the whole storage. The periodic ReindexAll
+// remains the reconciliation pass (it also fills in content hashes).
+// Descriptions follow renames and go away with deletes.
+// Every patch holds the storage's index lock, as does the full scan's update.
+
+const insertFileSQL = "INSERT INTO files(storage, name, path, is_dir, size, modified, extension, item_count, sha256, name_norm, inode) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func fileRowArgs(storage string, f domain.FileInfo, sum string) []interface{} {
+	ext := f.Extension
+	if len(ext) > 0 && ext[0] == '.' {
+		ext = ext[1:]
+	}
+	return []interface{}{
+		storage, f.Name, f.Path, f.IsDir, f.Size, f.ModTime, strings.ToLower(ext), f.ItemCount,
+		sql.NullString{String: sum, Valid: sum != ""}, normalizeName(f.Name),
+		sql.NullString{String: f.Inode, Valid: f.Inode != ""},
+	}
+}
+
+// contentKey identifies a row's content for hard-link-aware counting: the
+// inode when the file has several names, otherwise the (unique) path
+const contentKey = "COALESCE('i' || inode, 'p' || path)"
+
+// indexPath converts a request path ("/a/b/") to the index form ("a/b")
+func indexPath(p string) string {
+	return strings.TrimPrefix(filepath.Clean("/"+p), "/")
+}
+
+// likePrefix returns a LIKE pattern matching everything below dir
+func likePrefix(dir string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(dir) + "/%"
+}
+
+// likeContains returns a LIKE pattern matching s anywhere
+func likeContains(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+// deleteIndexedTree removes a path and all of its descendants
+func deleteIndexedTree(tx *sql.Tx, storage, p string) error {
+	_, err := tx.Exec(`DELETE FROM files WHERE storage = ? AND (path = ? OR path LIKE ? ESCAPE '\')`, storage, p, likePrefix(p))
+	return err
+}
+
+// missingAncestor returns the topmost folder above path that doesn't exist
+// yet, or "" when its parent does. Writes that create parent folders index
+// from there, so the new folders get rows too.
+func (s *FilesystemService) missingAncestor(storage, path string) string {
+	top := ""
+	for dir := filepath.Dir(path); indexPath(dir) != "" && !s.pathExists(storage, dir); dir = filepath.Dir(dir) {
+		top = dir
+	}
+	return top
+}
+
+// indexUpsert rescans a single file or subtree and replaces its rows
+func (s *FilesystemService) indexUpsert(storage, path string) {
+	s.indexUpsertKnown(storage, path, nil)
+}
+
+// indexUpsertKnown is indexUpsert with content hashes the caller knows to be
+// current, keyed by index path; a hash is kept while the size still matches
+func (s *FilesystemService) indexUpsertKnown(storage, path string, known map[string]indexedHash) {
+	if indexPath(path) == "" {
+		return
+	}
+	s.indexUpserts(storage, []string{path}, known)
+}
+
+// indexUpserts rescans several files or subtrees in one transaction. A path
+// that no longer exists just loses its rows. Rows get the hashes in known;
+// the others are left for the next full scan to fill in. The parent folders'
+// rows get their new item count and modification time.
+func (s *FilesystemService) indexUpserts(storage string, paths []string, known map[string]indexedHash) {
+	defer s.lockIndexWrite(storage)()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, path := range paths {
+		p := indexPath(path)
+		if p == "" {
+			continue
+		}
+		files, err := s.driver.ReadDirRecursiveFrom(storage, p, false)
+		if err != nil {
+			fmt.Printf("Error scanning %s:%s for index: %v\n", storage, p, err)
+			continue
+		}
+		if err := deleteIndexedTree(tx, storage, p); err != nil {
+			fmt.Printf("Error clearing index rows for %s:%s: %v\n", storage, p, err)
+			return
+		}
+		for _, f := range files {
+			sum := ""
+			if h, ok := known[f.Path]; ok && !f.IsDir && h.size == f.Size {
+				sum = h.sha256
+			}
+			tx.Exec(insertFileSQL, fileRowArgs(storage, f, sum)...)
+		}
+		s.refreshFolderRow(tx, storage, filepath.Dir(p))
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing index update for %s: %v\n", storage, err)
+	}
+}
+
+// refreshFolderRow updates an indexed folder's item count and modification
+// time after a child was added or removed
+func (s *FilesystemService) refreshFolderRow(tx *sql.Tx, storage, dir string) {
+	dir = indexPath(dir)
+	if dir == "" {
+		return
+	}
+	count, modified, err := s.driver.ItemCount(storage, dir)
+	if err != nil {
+		return
+	}
+	if _, err := tx.Exec("UPDATE files SET item_count = ?, modified = ? WHERE storage = ? AND path = ? AND is_dir = 1", count, modified, storage, dir); err != nil {
+		fmt.Printf("Error refreshing index row %s:%s: %v\n", storage, dir, err)
+	}
+}
+
+// indexedHashes is the stored content hashes of a path and its descendants
+func (s *FilesystemService) indexedHashes(storage, path string) map[string]indexedHash {
+	p := indexPath(path)
+	rows, err := s.db.Query(`SELECT path, size, sha256 FROM files
+		WHERE storage = ? AND (path = ? OR path LIKE ? ESCAPE '\') AND sha256 IS NOT NULL AND sha256 != ''`,
+		storage, p, likePrefix(p))
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	hashes := make(map[string]indexedHash)
+	for rows.Next() {
+		var path string
+		var h indexedHash
+		if rows.Scan(&path, &h.size, &h.sha256) == nil {
+			hashes[path] = h
+		}
+	}
+	return hashes
+}
+
+// indexRemove drops a deleted path (and its children) from the index
+func (s *FilesystemService) indexRemove(storage, path string) {
+	p := indexPath(path)
+	if p == "" {
+		return
+	}
+	defer s.lockIndexWrite(storage)()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := deleteIndexedTree(tx, storage, p); err != nil {
+		fmt.Printf("Error removing index rows for %s:%s: %v\n", storage, p, err)
+		return
+	}
+	if err := deleteDescriptions(tx, storage, p); err != nil {
+		fmt.Printf("Error removing descriptions for %s:%s: %v\n", storage, p, err)
+		return
+	}
+	s.refreshFolderRow(tx, storage, filepath.Dir(p))
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing index removal for %s:%s: %v\n", storage, p, err)
+	}
+}
+
+// indexRename rewrites the paths of a moved file or subtree in place
+func (s *FilesystemService) indexRename(storage, oldPath, newPath string) {
+	s.indexRenames(storage, [][2]string{{oldPath, newPath}})
+}
+
+// indexRenames applies several moves in a single transaction
+func (s *FilesystemService) indexRenames(storage string, moves [][2]string) {
+	if len(moves) == 0 {
+		return
+	}
+	defer s.lockIndexWrite(storage)()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, m := range moves {
+		if err := renameIndexedTree(tx, storage, indexPath(m[0]), indexPath(m[1])); err != nil {
+			fmt.Printf("Error renaming index rows %s -> %s: %v\n", m[0], m[1], err)
+			return
+		}
+		s.refreshFolderRow(tx, storage, filepath.Dir(indexPath(m[0])))
+		s.refreshFolderRow(tx, storage, filepath.Dir(indexPath(m[1])))
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing index rename for %s: %v\n", storage, err)
+	}
+}
+
+func renameIndexedTree(tx *sql.Tx, storage, oldP, newP string) error {
+	if oldP == "" || newP == "" || oldP == newP {
+		return nil
+	}
+
+	// The move replaced whatever was at the destination
+	if err := deleteIndexedTree(tx, storage, newP); err != nil {
+		return err
+	}
+	if err := renameDescriptions(tx, storage, oldP, newP); err != nil {
+		return err
+	}
+
+	name := filepath.Base(newP)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	_, err := tx.Exec(`UPDATE files SET path = ?, name = ?, name_norm = ?, extension = CASE WHEN is_dir THEN '' ELSE ? END WHERE storage = ? AND path = ?`,
+		newP, name, normalizeName(name), ext, storage, oldP)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE files SET path = ? || substr(path, ?) WHERE storage = ? AND path LIKE ? ESCAPE '\'`,
+		newP, len(oldP)+1, storage, likePrefix(oldP))
+	return err
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+// indexedFolder returns a folder row's item count, or -1 without a row
+func indexedFolder(t *testing.T, s *FilesystemService, path string) int {
+	t.Helper()
+	count := -1
+	s.db.QueryRow("SELECT item_count FROM files WHERE storage = 'ssd' AND path = ? AND is_dir = 1", path).Scan(&count)
+	return count
+}
+
+func TestWritesIndexCreatedParents(t *testing.T) {
+	s, root := newTestService(t, func(cfg *config.Config) {
+		cfg.ArchiveEntryMaxBytes = 1 << 20
+		cfg.ExtractMaxBytes = 1 << 20
+	})
+	writeFile(t, root, "top/old.txt", "x")
+	writeFile(t, root, "gone/sub/trashed.txt", "x")
+
+	zipPath := filepath.Join(root, "a.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("inner.txt")
+	w.Write([]byte("zipped"))
+	zw.Close()
+	f.Close()
+
+	id, err := s.Trash("ssd", "gone/sub/trashed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	s.indexStorage("ssd", true)
+
+	writes := map[string]func() error{
+		"create file":   func() error { return s.CreateFile("ssd", "/top/file/a/b.txt") },
+		"create folder": func() error { return s.CreateFolder("ssd", "/top/folder/a/b") },
+		"upload": func() error {
+			_, err := s.UploadFile("ssd", "/top/upload/a/b.txt", strings.NewReader("x"), 1, ConflictSkip, "")
+			return err
+		},
+		"extract": func() error { _, err := s.ExtractZip("ssd", "/a.zip", "/top/extract/a"); return err },
+	}
+	for name, write := range writes {
+		if err := write(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if _, err := s.RestoreFromTrash("ssd", id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"top/file", "top/file/a", "top/folder", "top/folder/a", "top/upload", "top/upload/a", "top/extract", "gone", "gone/sub"} {
+		if indexedFolder(t, s, dir) != 1 {
+			t.Errorf("folder %s: item_count %d, want a row with 1", dir, indexedFolder(t, s, dir))
+		}
+	}
+	// The existing parent counts its new children
+	if got := indexedFolder(t, s, "top"); got != 5 {
+		t.Errorf("top item_count = %d, want 5", got)
+	}
+}
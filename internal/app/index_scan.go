@@ -0,0 +1,239 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"time"
+)
+
+// The periodic scan compares what it finds with the rows already indexed and
+// only writes the differences, so a mostly static storage costs a walk and a
+// handful of statements instead of a full delete and re-insert. Folders the
+// scan can trust (see indexStorage) aren't even read.
+
+const upsertFileSQL = `INSERT INTO files(storage, name, path, is_dir, size, modified, extension, item_count, sha256, name_norm, inode, last_indexed)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(storage, path) DO UPDATE SET name = excluded.name, is_dir = excluded.is_dir, size = excluded.size,
+		modified = excluded.modified, extension = excluded.extension, item_count = excluded.item_count, sha256 = excluded.sha256,
+		name_norm = excluded.name_norm, inode = excluded.inode, last_indexed = excluded.last_indexed`
+
+// indexedRow is the part of an index row a scan compares against
+type indexedRow struct {
+	isDir       bool
+	size        int64
+	modified    int64 // UnixNano
+	itemCount   int
+	inode       string
+	sha256      string
+	lastIndexed time.Time // zero if never read by a scan
+}
+
+// matches reports whether a scanned entry would leave the row as it is
+func (r indexedRow) matches(f domain.FileInfo, sum string) bool {
+	return r.isDir == f.IsDir && r.size == f.Size && r.modified == f.ModTime.UnixNano() &&
+		r.itemCount == f.ItemCount && r.inode == f.Inode && r.sha256 == sum
+}
+
+// fileInfo rebuilds the scan entry of an unchanged row
+func (r indexedRow) fileInfo(p string) domain.FileInfo {
+	name := filepath.Base(p)
+	return domain.FileInfo{
+		Name:      name,
+		Path:      p,
+		IsDir:     r.isDir,
+		Size:      r.size,
+		ModTime:   time.Unix(0, r.modified),
+		Extension: filepath.Ext(name),
+		ItemCount: r.itemCount,
+		Inode:     r.inode,
+	}
+}
+
+// indexScan is one scan of a storage and, once applied, what it changed
+type indexScan struct {
+	started  time.Time
+	files    []domain.FileInfo // everything present, including the kept files of skipped folders
+	existing map[string]indexedRow
+	skipped  map[string]bool // folders that were not read
+	// Folders that could not be read; their rows and everything below stay
+	unread map[string]bool
+
+	total, updated, removed int
+	hashed                  int // files read for their sha256
+}
+
+// underUnread reports whether p lies inside a folder the scan could not read
+func (scan *indexScan) underUnread(p string) bool {
+	for dir := indexParent(p); dir != ""; dir = indexParent(dir) {
+		if scan.unread[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// indexParent returns the index path of a row's folder ("" for the root)
+func indexParent(p string) string {
+	if dir := filepath.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// indexedRows loads every row of a storage
+func (s *FilesystemService) indexedRows(storage string) (map[string]indexedRow, error) {
+	rows, err := s.db.Query(`SELECT path, is_dir, size, modified, item_count, COALESCE(inode, ''), COALESCE(sha256, ''), last_indexed
+		FROM files WHERE storage = ?`, storage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]indexedRow)
+	for rows.Next() {
+		var p string
+		var r indexedRow
+		var modified, lastIndexed sql.NullTime
+		var itemCount sql.NullInt64
+		if err := rows.Scan(&p, &r.isDir, &r.size, &modified, &itemCount, &r.inode, &r.sha256, &lastIndexed); err != nil {
+			return nil, err
+		}
+		r.modified = modified.Time.UnixNano()
+		r.itemCount = int(itemCount.Int64)
+		r.lastIndexed = lastIndexed.Time
+		existing[p] = r
+	}
+	return existing, rows.Err()
+}
+
+// scanStorage walks a storage, reading only the folders that changed unless full
+func (s *FilesystemService) scanStorage(storage string, full bool) (indexScan, error) {
+	scan := indexScan{started: time.Now()}
+	existing, err := s.indexedRows(storage)
+	if err != nil {
+		return scan, err
+	}
+	scan.existing = existing
+
+	subdirs := make(map[string][]string)
+	if !full {
+		for p, row := range existing {
+			if row.isDir {
+				parent := indexParent(p)
+				subdirs[parent] = append(subdirs[parent], filepath.Base(p))
+			}
+		}
+	}
+	// A folder's mtime moves when entries are added, removed or renamed in it.
+	// It must also predate the scan that read it, or a change during that
+	// scan could have been missed.
+	unchanged := func(rel string, modTime time.Time) ([]string, bool) {
+		if full {
+			return nil, false
+		}
+		row, ok := existing[rel]
+		if !ok || !row.isDir || row.modified != modTime.UnixNano() || !modTime.Before(row.lastIndexed) {
+			return nil, false
+		}
+		return subdirs[rel], true
+	}
+
+	files, skipped, unread, err := s.driver.ScanChanged(storage, unchanged)
+	if err != nil {
+		return scan, err
+	}
+	for i, f := range files {
+		if skipped[f.Path] || unread[f.Path] {
+			files[i].ItemCount = existing[f.Path].itemCount
+		}
+	}
+	for p, row := range existing {
+		if !row.isDir && skipped[indexParent(p)] {
+			files = append(files, row.fileInfo(p))
+		}
+	}
+	scan.files = files
+	scan.skipped = skipped
+	scan.unread = unread
+	scan.total = len(files)
+	return scan, nil
+}
+
+// updateIndex writes the rows a scan found changed or new and deletes those
+// it no longer found. It reports whether incremental patches were committed
+// since writesBefore was read, i.e. after the walk started; the scan may
+// have undone those, so the caller should scan again.
+func (s *FilesystemService) updateIndex(storage string, scan *indexScan, writesBefore uint64) bool {
+	// Hash before taking the lock; this reads file contents
+	hashes, hashed := s.computeHashes(storage, scan.files)
+	scan.hashed = hashed
+
+	lock := s.storageIndexLock(storage)
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	overtaken := lock.writes != writesBefore
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return overtaken
+	}
+	defer tx.Rollback() // Safety Rollback
+
+	upsert, err := tx.Prepare(upsertFileSQL)
+	if err != nil {
+		fmt.Printf("Error preparing statement: %v\n", err)
+		return overtaken
+	}
+	defer upsert.Close()
+	touch, err := tx.Prepare("UPDATE files SET last_indexed = ? WHERE storage = ? AND path = ?")
+	if err != nil {
+		fmt.Printf("Error preparing statement: %v\n", err)
+		return overtaken
+	}
+	defer touch.Close()
+
+	found := make(map[string]bool, len(scan.files))
+	for _, f := range scan.files {
+		found[f.Path] = true
+		row, ok := scan.existing[f.Path]
+		kept := scan.skipped[f.Path] || scan.unread[f.Path]
+		read := f.IsDir && !kept
+		if ok && row.matches(f, hashes[f.Path]) {
+			// Only read folders need the mark; files don't use it
+			if read {
+				touch.Exec(scan.started, storage, f.Path)
+			}
+			continue
+		}
+		lastIndexed := sql.NullTime{Time: scan.started, Valid: true}
+		if kept {
+			lastIndexed = sql.NullTime{Time: row.lastIndexed, Valid: !row.lastIndexed.IsZero()}
+		}
+		// Skip single record error but log it
+		if _, err := upsert.Exec(append(fileRowArgs(storage, f, hashes[f.Path]), lastIndexed)...); err != nil {
+			fmt.Printf("Error indexing %s:%s: %v\n", storage, f.Path, err)
+			continue
+		}
+		scan.updated++
+	}
+
+	for p := range scan.existing {
+		// A failed ReadDir says nothing about what is gone
+		if found[p] || scan.underUnread(p) {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM files WHERE storage = ? AND path = ?", storage, p); err != nil {
+			fmt.Printf("Error removing index row %s:%s: %v\n", storage, p, err)
+			return overtaken
+		}
+		scan.removed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction for %s: %v\n", storage, err)
+	}
+	return overtaken
+}
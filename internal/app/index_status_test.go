@@ -0,0 +1,21 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexStatusDoesNotScan(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "a.txt", "a")
+	s.cfg.IndexEnabled = true
+
+	statuses := s.IndexStatus()
+	if len(statuses) != 1 || statuses[0].Indexed || statuses[0].Scanning {
+		t.Fatalf("status = %+v, want one storage, not indexed and not scanning", statuses)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if st := s.IndexStatus()[0]; st.RowCount != 0 || st.Scanning {
+		t.Errorf("status after a while = %+v, want no scan to have run", st)
+	}
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"strings"
+	"time"
+)
+
+// Live search walks a storage that has no index rows yet, so /api/search
+// answers before the first scan finishes. The walk is bounded by
+// LIVE_SEARCH_BUDGET_MS; when it runs out, the matches found so far are
+// returned flagged as partial instead of keeping the client waiting.
+
+// LiveSearchResult is a filesystem-walk search page
+type LiveSearchResult struct {
+	Files   []domain.FileInfo
+	Total   int // matches seen; a lower bound when Partial or when the page filled up
+	Partial bool
+	Elapsed time.Duration
+}
+
+// NeedsLiveSearch reports whether filter targets a single storage that has
+// nothing in the index yet
+func (s *FilesystemService) NeedsLiveSearch(filter SearchFilter) bool {
+	if len(filter.Storages) != 1 {
+		return false
+	}
+	if s.db == nil {
+		return true
+	}
+	var one int
+	err := s.db.QueryRow("SELECT 1 FROM files WHERE storage = ? LIMIT 1", filter.Storages[0]).Scan(&one)
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// LiveSearch runs filter against the storage on disk within the time budget
+func (s *FilesystemService) LiveSearch(filter SearchFilter, limit, offset int) (LiveSearchResult, error) {
+	start := time.Now()
+	var deadline time.Time
+	if s.cfg.LiveSearchBudgetMs > 0 {
+		deadline = start.Add(time.Duration(s.cfg.LiveSearchBudgetMs) * time.Millisecond)
+	}
+
+	files, total, partial, err := s.driver.SearchFiles(filter.Storages[0], filter.matcher(), limit, offset, false, deadline)
+	if err != nil {
+		return LiveSearchResult{}, err
+	}
+	// Like the indexed search, no page asked for means count only
+	if files == nil || (limit <= 0 && offset <= 0) {
+		files = []domain.FileInfo{}
+	}
+	return LiveSearchResult{Files: files, Total: total, Partial: partial, Elapsed: time.Since(start)}, nil
+}
+
+// matcher mirrors where() for files read from disk
+func (f SearchFilter) matcher() func(name string, info os.FileInfo) bool {
+	include := extensionSet(f.Extensions)
+	exclude := extensionSet(f.ExcludeExtensions)
+	var since time.Time
+	if f.Days > 0 {
+		since = time.Now().AddDate(0, 0, -f.Days)
+	}
+	query := normalizeName(f.Name)
+	text := normalizeName(f.Query) // the disk walk only sees names
+
+	return func(name string, info os.FileInfo) bool {
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "$") || strings.HasPrefix(name, "~") {
+			return false
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if len(include) > 0 && !include[ext] {
+			return false
+		}
+		if exclude[ext] {
+			return false
+		}
+		if !since.IsZero() && !info.ModTime().After(since) {
+			return false
+		}
+		if text != "" && !strings.Contains(normalizeName(name), text) {
+			return false
+		}
+		return query == "" || strings.Contains(normalizeName(name), query)
+	}
+}
+
+func extensionSet(exts []string) map[string]bool {
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		set[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
+	return set
+}
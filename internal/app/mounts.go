@@ -0,0 +1,149 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/filesystem"
+	"strings"
+)
+
+var (
+	ErrInvalidMount    = errors.New("invalid mount")
+	ErrStorageExists   = errors.New("storage already exists")
+	ErrStorageNotFound = filesystem.ErrStorageNotFound
+	ErrPathOutsideRoot = filesystem.ErrPathOutsideRoot
+)
+
+var mountNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// within reports whether path equals root or lies below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// applyFilterRules installs a storage's hidden/junk overrides in the driver.
+// An invalid pattern is logged and the global rules stay in effect.
+func (s *FilesystemService) applyFilterRules(name string) {
+	s.setFilterRules(name, s.StorageOptions(name))
+}
+
+func (s *FilesystemService) setFilterRules(name string, opts config.StorageOptions) {
+	var hidden *regexp.Regexp
+	if opts.HiddenRegex != "" {
+		re, err := regexp.Compile(opts.HiddenRegex)
+		if err != nil {
+			fmt.Printf("Warning: invalid hidden pattern for storage %s, using global rules: %v\n", name, err)
+		} else {
+			hidden = re
+		}
+	}
+	s.driver.SetFilterRules(name, filesystem.NewFilterRules(hidden, opts.JunkFilter))
+}
+
+// AddStorage registers a new mount at runtime, persists it to MOUNTS_FILE (when
+// set) and starts indexing it. Its STORAGE_<NAME>_* options are read from the
+// environment like those of the startup mounts. The path must be an existing
+// directory that neither lies inside nor contains another mount.
+func (s *FilesystemService) AddStorage(name, path string) error {
+	if !mountNameRegex.MatchString(name) {
+		return fmt.Errorf("%w: name may only contain letters, digits, '-' and '_'", ErrInvalidMount)
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%w: path must be absolute", ErrInvalidMount)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMount, err)
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrInvalidMount, path)
+	}
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+
+	mounts := s.driver.MountsSnapshot()
+	for existing, root := range mounts {
+		if strings.EqualFold(existing, name) {
+			return fmt.Errorf("%w: %s", ErrStorageExists, existing)
+		}
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			root = r
+		}
+		if within(root, resolved) || within(resolved, root) {
+			return fmt.Errorf("%w: %s overlaps storage %s", ErrInvalidMount, path, existing)
+		}
+	}
+
+	mounts[name] = filepath.Clean(path)
+	if err := config.SaveMounts(s.cfg.MountsFile, mounts); err != nil {
+		return fmt.Errorf("persist mounts: %w", err)
+	}
+	s.settingsMu.Lock()
+	if s.cfg.StorageOptions == nil {
+		s.cfg.StorageOptions = make(map[string]config.StorageOptions)
+	}
+	s.cfg.StorageOptions[name] = config.LoadStorageOptions(name)
+	s.settingsMu.Unlock()
+	s.driver.AddMount(name, filepath.Clean(path))
+	s.applyFilterRules(name)
+	fmt.Printf("Registered storage %s -> %s\n", name, path)
+
+	if s.cfg.IndexEnabled {
+		go s.indexStorage(name, true) // may be a different folder than a mount of the same name before
+		s.startWatching(name)
+	}
+	return nil
+}
+
+// RemoveStorage unregisters a mount and drops its index rows. Files on disk
+// are left alone.
+func (s *FilesystemService) RemoveStorage(name string) error {
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+
+	mounts := s.driver.MountsSnapshot()
+	realName := ""
+	for existing := range mounts {
+		if strings.EqualFold(existing, name) {
+			realName = existing
+		}
+	}
+	if realName == "" {
+		return fmt.Errorf("%w: %s", ErrStorageNotFound, name)
+	}
+
+	delete(mounts, realName)
+	if err := config.SaveMounts(s.cfg.MountsFile, mounts); err != nil {
+		return fmt.Errorf("persist mounts: %w", err)
+	}
+	s.driver.RemoveMount(realName)
+	s.stopWatching(realName)
+	s.settingsMu.Lock()
+	delete(s.cfg.StorageOptions, realName)
+	s.settingsMu.Unlock()
+
+	s.invalidateStorage(realName)
+	if s.db != nil {
+		unlock := s.lockIndexWrite(realName)
+		if _, err := s.db.Exec("DELETE FROM files WHERE storage = ?", realName); err != nil {
+			fmt.Printf("Failed to drop index rows for %s: %v\n", realName, err)
+		}
+		if _, err := s.db.Exec("DELETE FROM descriptions WHERE storage = ?", realName); err != nil {
+			fmt.Printf("Failed to drop descriptions for %s: %v\n", realName, err)
+		}
+		unlock()
+		s.dropStorageSettings(realName)
+	}
+	s.stateMu.Lock()
+	delete(s.indexState, realName)
+	s.stateMu.Unlock()
+
+	fmt.Printf("Unregistered storage %s\n", realName)
+	return nil
+}
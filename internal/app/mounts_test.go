@@ -0,0 +1,29 @@
+package app
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddedStorageReadsItsEnvOptions(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	t.Setenv("STORAGE_ARCHIVE_READ_ONLY", "true")
+	t.Setenv("STORAGE_ARCHIVE_LABEL", "Old photos")
+	if err := s.AddStorage("archive", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	opts := s.StorageOptions("archive")
+	if !opts.ReadOnly || opts.Label != "Old photos" {
+		t.Errorf("options = %+v, want read-only with label", opts)
+	}
+	if err := s.CreateFolder("archive", "x"); !errors.Is(err, ErrWriteNotAllowed) {
+		t.Errorf("write to the new read-only storage: err = %v, want ErrWriteNotAllowed", err)
+	}
+
+	if err := s.RemoveStorage("archive"); err != nil {
+		t.Fatal(err)
+	}
+	if opts := s.StorageOptions("archive"); opts.ReadOnly || opts.Label != "" {
+		t.Errorf("options after removal = %+v, want none", opts)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Where LatestModified got its answer from
+const (
+	MtimeSourceIndex = "index"
+	MtimeSourceWalk  = "walk"
+)
+
+// LatestModified returns the most recent modification time of a folder and
+// everything below it, so clients can cheaply poll whether anything changed.
+// It is an index query; prefixes with no index rows fall back to a live walk.
+func (s *FilesystemService) LatestModified(storage, path string) (time.Time, string, error) {
+	// The folder's own mtime also covers deletions directly inside it,
+	// which leave no row behind in the index
+	root, err := s.driver.Stat(storage, path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if !root.IsDir {
+		return root.ModTime, MtimeSourceWalk, nil
+	}
+
+	p := indexPath(path)
+	if s.db != nil {
+		query := "SELECT modified FROM files WHERE storage = ?"
+		args := []interface{}{storage}
+		if p != "" {
+			query += ` AND (path = ? OR path LIKE ? ESCAPE '\')`
+			args = append(args, p, likePrefix(p))
+		}
+		query += " ORDER BY modified DESC LIMIT 1"
+
+		var latest time.Time
+		err := s.db.QueryRow(query, args...).Scan(&latest)
+		if err == nil {
+			if root.ModTime.After(latest) {
+				latest = root.ModTime
+			}
+			return latest, MtimeSourceIndex, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, "", err
+		}
+	}
+
+	// Not indexed (yet): walk the folder
+	files, err := s.driver.ReadDirRecursiveFrom(storage, path, false)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	latest := root.ModTime
+	for _, f := range files {
+		if f.ModTime.After(latest) {
+			latest = f.ModTime
+		}
+	}
+	return latest, MtimeSourceWalk, nil
+}
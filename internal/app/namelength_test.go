@@ -0,0 +1,67 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestOverLengthNamesAreRejected(t *testing.T) {
+	long := strings.Repeat("a", 256)
+	writes := map[string]func(s *FilesystemService, path string) error{
+		"folder": func(s *FilesystemService, path string) error { return s.CreateFolder("ssd", path) },
+		"file":   func(s *FilesystemService, path string) error { return s.CreateFile("ssd", path) },
+		"upload": func(s *FilesystemService, path string) error {
+			_, err := s.UploadFile("ssd", path, strings.NewReader("x"), 1, ConflictOverwrite, "")
+			return err
+		},
+		"rename": func(s *FilesystemService, path string) error { return s.RenameOrMove("ssd", "/src.txt", path) },
+		"copy":   func(s *FilesystemService, path string) error { return s.Copy("ssd", "/src.txt", path) },
+	}
+	tests := []struct {
+		name    string
+		path    string
+		tooLong bool
+	}{
+		{"at the limit", "/" + strings.Repeat("a", 255), false},
+		{"one byte over", "/" + long, true},
+		// 128 runes, but 256 bytes
+		{"multi-byte runes", "/" + strings.Repeat("é", 128), true},
+		{"long folder component", "/" + long + "/x.txt", true},
+	}
+	for op, write := range writes {
+		for _, tt := range tests {
+			t.Run(op+" "+tt.name, func(t *testing.T) {
+				s, root := newTestService(t, func(cfg *config.Config) { cfg.MaxNameBytes = 255 })
+				writeFile(t, root, "src.txt", "x")
+				err := write(s, tt.path)
+				if !tt.tooLong {
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				if !errors.Is(err, ErrNameTooLong) {
+					t.Fatalf("err = %v, want ErrNameTooLong", err)
+				}
+				entries, _ := os.ReadDir(root)
+				if len(entries) != 1 {
+					t.Errorf("storage has %d entries after a refused write, want only src.txt", len(entries))
+				}
+			})
+		}
+	}
+}
+
+func TestOverLengthPathIsRejected(t *testing.T) {
+	s, root := newTestService(t, nil)
+	s.cfg.MaxPathBytes = len(root) + len("/dir/name.txt")
+	if err := s.CreateFile("ssd", "/dir/name.txt"); err != nil {
+		t.Fatalf("path at the limit: %v", err)
+	}
+	if err := s.CreateFile("ssd", "/dir/names.txt"); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("path one byte over: err = %v, want ErrNameTooLong", err)
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeName folds case and strips diacritics ("Café" -> "cafe") so name
+// search matches regardless of either. Stored in files.name_norm.
+func normalizeName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+	return strings.ToLower(folded)
+}
+
+// backfillNameNorm fills name_norm for rows indexed before the column existed
+func backfillNameNorm(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name FROM files WHERE name_norm IS NULL")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id   int64
+		name string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.name); err == nil {
+			todo = append(todo, p)
+		}
+	}
+	rows.Close()
+	if len(todo) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("UPDATE files SET name_norm = ? WHERE id = ?")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range todo {
+		if _, err := stmt.Exec(normalizeName(p.name), p.id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
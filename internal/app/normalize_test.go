@@ -0,0 +1,61 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNameFoldsCaseAndAccents(t *testing.T) {
+	tests := []struct {
+		query, name string
+	}{
+		{"cafe", "Café.jpg"},
+		{"CAFÉ", "cafe.jpg"},
+		{"resume", "Résumé final.pdf"},
+		{"naive", "naïve.txt"},
+		{"senor", "Señor.mp3"},
+		{"uber", "Über uns.md"},
+		{"sao paulo", "São Paulo.png"},
+		// Precomposed and decomposed forms fold to the same thing
+		{"caf\u00e9", "Cafe\u0301.jpg"},
+		{"cafe\u0301", "Caf\u00e9.jpg"},
+	}
+	for _, tt := range tests {
+		q, n := normalizeName(tt.query), normalizeName(tt.name)
+		if !strings.Contains(n, q) {
+			t.Errorf("normalizeName(%q) = %q does not contain normalizeName(%q) = %q", tt.name, n, tt.query, q)
+		}
+	}
+}
+
+func TestSearchMatchesAccentedNames(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "Café.jpg", "x")
+	writeFile(t, root, "docs/Résumé.pdf", "x")
+	writeFile(t, root, "plain.txt", "x")
+	s.indexStorage("ssd", true)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"cafe", []string{"Café.jpg"}},
+		{"CAFÉ", []string{"Café.jpg"}},
+		{"resume", []string{"docs/Résumé.pdf"}},
+		{"RÉSUMÉ", []string{"docs/Résumé.pdf"}},
+		{"plain", []string{"plain.txt"}},
+		{"caff", nil},
+	}
+	for _, tt := range tests {
+		files, total := s.SearchIndexedFiles(SearchFilter{Name: tt.name}, 10, 0)
+		if total != len(tt.want) || len(files) != len(tt.want) {
+			t.Errorf("name %q: got %d (total %d) results, want %v", tt.name, len(files), total, tt.want)
+			continue
+		}
+		for i, f := range files {
+			if f.Path != tt.want[i] {
+				t.Errorf("name %q: result %d is %q, want %q", tt.name, i, f.Path, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"bytes"
+	"image/gif"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Contact sheets are few and small, so a bounded in-memory cache is enough
+const posterCacheEntries = 256
+
+// posterCache keeps recently generated images keyed by path+modtime, so an
+// edited file never gets a stale one. Oldest entries are evicted first.
+type posterCache struct {
+	mu    sync.Mutex
+	data  map[string][]byte
+	order []string
+}
+
+func (c *posterCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.data[key]
+	return b, ok
+}
+
+func (c *posterCache) put(key string, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		c.data = make(map[string][]byte)
+	}
+	if _, ok := c.data[key]; ok {
+		return
+	}
+	if len(c.order) >= posterCacheEntries {
+		delete(c.data, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.data[key] = b
+	c.order = append(c.order, key)
+}
+
+func isGIF(ext string) bool {
+	return strings.EqualFold(strings.TrimPrefix(ext, "."), "gif")
+}
+
+// GetPoster returns a static JPEG of the first frame: decoded in Go for GIFs,
+// via ffmpeg for videos. Results go through the thumbnail cache, keyed by
+// path and modification time.
+func (s *FilesystemService) GetPoster(storage, path string, modTime time.Time) ([]byte, error) {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := s.thumbs.GetOrCreate(s.thumbs.Key(storage, path, modTime, "poster"), func() ([]byte, error) {
+		if isGIF(filepath.Ext(path)) {
+			return gifFirstFrame(realPath)
+		}
+		return s.GetVideoThumbnail(realPath)
+	})
+	return data, err
+}
+
+// gif.Decode only decodes frame 0, which is all a poster needs
+func gifFirstFrame(realPath string) ([]byte, error) {
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	frame, err := gif.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, frame, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"path/filepath"
+	"storages-api/internal/domain"
+	"sync"
+)
+
+const (
+	// Limits for one prefetch request: levels below the start folder,
+	// folders read in total, and concurrent reads
+	maxPrefetchDepth   = 5
+	maxPrefetchFolders = 500
+	prefetchWorkers    = 4
+)
+
+// Prefetch warms the listing cache for path and its subfolders down to depth
+// levels (0 = just path), so navigating into them is served from memory.
+// Folders already cached are not read again but are still descended into.
+func (s *FilesystemService) Prefetch(storage, path string, depth int, showHidden bool) (domain.PrefetchResult, error) {
+	var res domain.PrefetchResult
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > maxPrefetchDepth {
+		depth = maxPrefetchDepth
+	}
+
+	// The start folder is read directly so a bad path is reported
+	files, cached, err := s.listDir(storage, path, showHidden, "")
+	if err != nil {
+		return res, err
+	}
+	res.Folders = 1
+	if cached {
+		res.AlreadyWarm++
+	} else {
+		res.Warmed++
+	}
+
+	level := subfolders(path, files)
+	for d := 1; d <= depth && len(level) > 0; d++ {
+		if room := maxPrefetchFolders - res.Folders; len(level) > room {
+			level = level[:room]
+			res.Truncated = true
+		}
+		if len(level) == 0 {
+			break
+		}
+
+		var mu sync.Mutex
+		var next []string
+		jobs := make(chan string)
+		var wg sync.WaitGroup
+		for w := 0; w < prefetchWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for dir := range jobs {
+					files, cached, err := s.listDir(storage, dir, showHidden, "")
+					mu.Lock()
+					switch {
+					case err != nil:
+						res.Failed++
+					case cached:
+						res.AlreadyWarm++
+					default:
+						res.Warmed++
+					}
+					if err == nil && d < depth {
+						next = append(next, subfolders(dir, files)...)
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, dir := range level {
+			jobs <- dir
+		}
+		close(jobs)
+		wg.Wait()
+
+		res.Folders += len(level)
+		level = next
+	}
+	return res, nil
+}
+
+func subfolders(dir string, files []domain.FileInfo) []string {
+	var dirs []string
+	for _, f := range files {
+		if f.IsDir {
+			dirs = append(dirs, filepath.Join(dir, f.Name))
+		}
+	}
+	return dirs
+}
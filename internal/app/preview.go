@@ -0,0 +1,153 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // registered for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"storages-api/internal/domain"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// PreviewAction is what the preview endpoint should send
+type PreviewAction int
+
+const (
+	PreviewServeFile PreviewAction = iota // whole file, Range-capable
+	PreviewPoster                         // static first frame of a video or animated GIF
+	PreviewThumbnail                      // downscaled image
+	PreviewTextHead                       // first MaxLines lines of a text file
+)
+
+// PreviewDecision is the outcome of PreviewPolicy.Decide
+type PreviewDecision struct {
+	Action   PreviewAction
+	MaxLines int
+}
+
+// PreviewPolicy holds the per-type preview rules, resolved from config
+type PreviewPolicy struct {
+	ImageInlineMaxBytes int64
+	ThumbMaxPixels      int
+	TextMaxLines        int
+}
+
+// PreviewPolicy returns the configured preview rules
+func (s *FilesystemService) PreviewPolicy() PreviewPolicy {
+	return PreviewPolicy{
+		ImageInlineMaxBytes: s.cfg.PreviewImageInlineMaxBytes,
+		ThumbMaxPixels:      s.cfg.PreviewThumbMaxPixels,
+		TextMaxLines:        s.cfg.PreviewTextMaxLines,
+	}
+}
+
+// Decide picks the preview action for a file with the given extension and
+// size. thumb/poster are the client's explicit asks.
+func (p PreviewPolicy) Decide(ext string, size int64, thumb, poster bool) PreviewDecision {
+	switch domain.PreviewTypeFor(ext) {
+	case domain.PreviewVideo:
+		if thumb || poster {
+			return PreviewDecision{Action: PreviewPoster}
+		}
+	case domain.PreviewImage:
+		if poster && isGIF(ext) {
+			return PreviewDecision{Action: PreviewPoster}
+		}
+		if thumb || (p.ImageInlineMaxBytes > 0 && size > p.ImageInlineMaxBytes) {
+			return PreviewDecision{Action: PreviewThumbnail}
+		}
+	case domain.PreviewText:
+		if p.TextMaxLines > 0 {
+			return PreviewDecision{Action: PreviewTextHead, MaxLines: p.TextMaxLines}
+		}
+	}
+	return PreviewDecision{Action: PreviewServeFile}
+}
+
+// GetImageThumbnail decodes a jpeg/png/gif/webp image and returns a JPEG
+// whose longest edge is at most maxPixels. Other formats return an error.
+func (s *FilesystemService) GetImageThumbnail(realPath string, maxPixels int) ([]byte, error) {
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, downscale(src, maxPixels), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ImageThumbnail is GetImageThumbnail through the thumbnail cache
+func (s *FilesystemService) ImageThumbnail(storage, path string, modTime time.Time, maxPixels int) ([]byte, error) {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	key := s.thumbs.Key(storage, path, modTime, fmt.Sprintf("img%d", maxPixels))
+	data, _, err := s.thumbs.GetOrCreate(key, func() ([]byte, error) {
+		return s.GetImageThumbnail(realPath, maxPixels)
+	})
+	return data, err
+}
+
+// downscale fits src into maxPixels on its longest edge, keeping the aspect
+// ratio. Bilinear sampling over the whole source avoids the jagged edges of
+// picking single pixels.
+func downscale(src image.Image, maxPixels int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxPixels <= 0 || (w <= maxPixels && h <= maxPixels) {
+		return src
+	}
+
+	nw, nh := maxPixels, maxPixels
+	if w > h {
+		nh = max(1, h*maxPixels/w)
+	} else {
+		nw = max(1, w*maxPixels/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+// ReadTextHead returns up to maxLines lines and whether the file had more
+func (s *FilesystemService) ReadTextHead(realPath string, maxLines int) ([]byte, bool, error) {
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	var out bytes.Buffer
+	r := bufio.NewReader(f)
+	for lines := 0; lines < maxLines; lines++ {
+		line, err := r.ReadBytes('\n')
+		out.Write(line)
+		if err == io.EOF {
+			return out.Bytes(), false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	_, err = r.Peek(1)
+	return out.Bytes(), err == nil, nil
+}
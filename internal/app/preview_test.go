@@ -0,0 +1,37 @@
+package app
+
+import "testing"
+
+func TestPreviewPolicyDecide(t *testing.T) {
+	policy := PreviewPolicy{ImageInlineMaxBytes: 1000, ThumbMaxPixels: 320, TextMaxLines: 50}
+	tests := []struct {
+		name          string
+		policy        PreviewPolicy
+		ext           string
+		size          int64
+		thumb, poster bool
+		want          PreviewDecision
+	}{
+		{"video streams", policy, ".mkv", 1 << 30, false, false, PreviewDecision{Action: PreviewServeFile}},
+		{"video poster", policy, ".mp4", 1 << 30, false, true, PreviewDecision{Action: PreviewPoster}},
+		{"video thumb", policy, ".webm", 1 << 30, true, false, PreviewDecision{Action: PreviewPoster}},
+		{"small image inline", policy, ".jpg", 1000, false, false, PreviewDecision{Action: PreviewServeFile}},
+		{"large image thumbnailed", policy, ".jpg", 1001, false, false, PreviewDecision{Action: PreviewThumbnail}},
+		{"image thumb asked", policy, ".png", 10, true, false, PreviewDecision{Action: PreviewThumbnail}},
+		{"no inline limit", PreviewPolicy{}, ".jpg", 1 << 30, false, false, PreviewDecision{Action: PreviewServeFile}},
+		{"gif poster", policy, ".GIF", 10, false, true, PreviewDecision{Action: PreviewPoster}},
+		{"poster of a still image", policy, ".png", 10, false, true, PreviewDecision{Action: PreviewServeFile}},
+		{"text capped", policy, ".log", 1 << 20, false, false, PreviewDecision{Action: PreviewTextHead, MaxLines: 50}},
+		{"text uncapped", PreviewPolicy{}, ".txt", 1 << 20, false, false, PreviewDecision{Action: PreviewServeFile}},
+		{"audio streams", policy, ".flac", 1 << 20, true, true, PreviewDecision{Action: PreviewServeFile}},
+		{"pdf served", policy, ".pdf", 1 << 20, false, false, PreviewDecision{Action: PreviewServeFile}},
+		{"other served", policy, ".bin", 1 << 20, false, false, PreviewDecision{Action: PreviewServeFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Decide(tt.ext, tt.size, tt.thumb, tt.poster); got != tt.want {
+				t.Errorf("Decide(%s, %d, thumb=%v, poster=%v) = %+v, want %+v", tt.ext, tt.size, tt.thumb, tt.poster, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"storages-api/internal/domain"
+	"testing"
+	"time"
+)
+
+// searchPaths runs an indexed search and returns the matched paths, sorted
+func searchPaths(t *testing.T, s *FilesystemService, f SearchFilter) ([]string, int) {
+	t.Helper()
+	files, total := s.SearchIndexedFiles(f, 100, 0)
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	slices.Sort(paths)
+	return paths, total
+}
+
+func TestSearchExcludeExtensionWins(t *testing.T) {
+	s, root := newTestService(t, nil)
+	for _, name := range []string{"a.mp3", "b.mkv", "c.txt", "D.TXT", "e.jpg", "notes"} {
+		writeFile(t, root, name, "x")
+	}
+	s.indexStorage("ssd", true)
+
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"include only", []string{"mp3", "txt"}, nil, []string{"D.TXT", "a.mp3", "c.txt"}},
+		{"exclude only", nil, []string{"mkv", ".MP3"}, []string{"D.TXT", "c.txt", "e.jpg", "notes"}},
+		{"exclude wins", []string{"mp3", "txt"}, []string{"mp3"}, []string{"D.TXT", "c.txt"}},
+		{"everything excluded", []string{"txt"}, []string{"TXT"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := SearchFilter{Extensions: tt.include, ExcludeExtensions: tt.exclude}
+			got, total := searchPaths(t, s, f)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("indexed search = %v, want %v", got, tt.want)
+			}
+			if total != len(tt.want) || s.CountIndexedFiles(f) != len(tt.want) {
+				t.Errorf("total = %d, count = %d, want %d", total, s.CountIndexedFiles(f), len(tt.want))
+			}
+
+			// The disk walk applies the same precedence
+			match := f.matcher()
+			var live []string
+			for _, name := range []string{"a.mp3", "b.mkv", "c.txt", "D.TXT", "e.jpg", "notes"} {
+				if match(name, nil) {
+					live = append(live, name)
+				}
+			}
+			slices.Sort(live)
+			if !slices.Equal(live, tt.want) && !(len(live) == 0 && len(tt.want) == 0) {
+				t.Errorf("live search = %v, want %v", live, tt.want)
+			}
+		})
+	}
+}
+
+func TestPagingWithIdenticalModTimes(t *testing.T) {
+	s, root := newTestService(t, nil)
+	same := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var want []string
+	for i := range 11 {
+		name := fmt.Sprintf("f%02d.txt", i)
+		if err := os.Chtimes(writeFile(t, root, name, "x"), same, same); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	newer := writeFile(t, root, "newest.txt", "x")
+	if err := os.Chtimes(newer, same.Add(time.Hour), same.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	want = append([]string{"newest.txt"}, want...)
+	// Insert in reverse so row order alone would page backwards
+	for i := len(want) - 1; i >= 0; i-- {
+		s.indexUpsert("ssd", want[i])
+	}
+
+	pages := map[string]func(limit, offset int) []domain.FileInfo{
+		"search": func(limit, offset int) []domain.FileInfo {
+			files, _ := s.SearchIndexedFiles(SearchFilter{Extensions: []string{"txt"}}, limit, offset)
+			return files
+		},
+		"recent": func(limit, offset int) []domain.FileInfo { return s.GetRecentFiles("ssd", limit, offset) },
+	}
+	for name, page := range pages {
+		var got []string
+		for offset := 0; offset < len(want)+5; offset += 5 {
+			for _, f := range page(5, offset) {
+				got = append(got, f.Path)
+			}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s pages = %v, want %v", name, got, want)
+		}
+	}
+}
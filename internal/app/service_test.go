@@ -0,0 +1,53 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/filesystem"
+	"testing"
+)
+
+// newTestService serves one storage "ssd" from a temp folder with its own
+// index file and no background indexing; configure may adjust the config
+// before the service is built.
+func newTestService(t *testing.T, configure func(cfg *config.Config)) (*FilesystemService, string) {
+	t.Helper()
+	root := t.TempDir()
+	storage := filepath.Join(root, "ssd")
+	if err := os.Mkdir(storage, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StorageMounts:        map[string]string{"ssd": storage},
+		StorageOptions:       map[string]config.StorageOptions{},
+		IndexDBPath:          filepath.Join(root, "index.db"),
+		IndexIntervalMinutes: 60,
+		ThumbCacheDir:        filepath.Join(root, "thumbs"),
+		UploadChunkDir:       filepath.Join(root, "chunks"),
+		ReadDirWorkers:       4,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	driver := filesystem.NewLocalDriver(cfg.StorageMounts)
+	driver.SetWriteModes(cfg.UploadFileMode, cfg.UploadDirMode)
+	driver.SetSpaceMargin(cfg.MinFreeSpacePercent)
+	driver.SetReadDirWorkers(cfg.ReadDirWorkers)
+	s := NewFilesystemService(driver, cfg)
+	t.Cleanup(func() { s.db.Close() })
+	return s, storage
+}
+
+// writeFile creates root/rel with content, making parent folders
+func writeFile(t *testing.T, root, rel, content string) string {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return full
+}
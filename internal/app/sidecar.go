@@ -0,0 +1,38 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SidecarThumbnail looks next to a file for a thumbnail some other tool
+// already made (PREVIEW_SIDECARS, e.g. ".thumbnails/{name}.jpg" or
+// "{stem}.thumb.jpg"). Only one at least as new as the file is used, so an
+// edited photo doesn't show its old thumbnail. Symlinks, and folders that
+// resolve outside the file's own, are never followed, so a planted link can't
+// serve some other file. Returns the sidecar's path.
+func (s *FilesystemService) SidecarThumbnail(realPath string, modTime time.Time) (string, bool) {
+	dir, name := filepath.Split(realPath)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, pattern := range s.cfg.PreviewSidecars {
+		candidate := filepath.Join(dir, strings.NewReplacer("{name}", name, "{stem}", stem).Replace(pattern))
+		if candidate == realPath {
+			continue
+		}
+		info, err := os.Lstat(candidate)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(modTime) {
+			continue
+		}
+		if parent, err := filepath.EvalSymlinks(filepath.Dir(candidate)); err != nil || !within(realDir, parent) {
+			continue
+		}
+		return candidate, true
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"testing"
+	"time"
+)
+
+func sidecarService(t *testing.T) (*FilesystemService, string) {
+	return newTestService(t, func(cfg *config.Config) {
+		cfg.PreviewSidecars = []string{".thumbnails/{name}.jpg", "{stem}.thumb.jpg"}
+	})
+}
+
+func TestPresentSidecarTakesPrecedence(t *testing.T) {
+	s, root := sidecarService(t)
+	// Not a decodable image: only the sidecar can answer
+	photo := writeFile(t, root, "photo.jpg", "not a jpeg")
+	writeFile(t, root, "photo.thumb.jpg", "sidecar bytes")
+	info, err := os.Stat(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := s.Thumbnail("ssd", "photo.jpg", info.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Source != "sidecar" || string(thumb.Data) != "sidecar bytes" {
+		t.Errorf("thumbnail = %q from %s, want the sidecar", thumb.Data, thumb.Source)
+	}
+}
+
+func TestSidecarIgnoresStaleAndLinkedFiles(t *testing.T) {
+	s, root := sidecarService(t)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	link := writeFile(t, root, "a.jpg", "x")
+	if err := os.Symlink(outside, filepath.Join(root, "a.thumb.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := s.SidecarThumbnail(link, now.Add(-time.Hour)); ok {
+		t.Errorf("symlinked sidecar used: %s", got)
+	}
+
+	linkedDir := writeFile(t, root, "b.jpg", "x")
+	if err := os.Symlink(filepath.Dir(outside), filepath.Join(root, ".thumbnails")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(outside), "b.jpg.jpg"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := s.SidecarThumbnail(linkedDir, now.Add(-time.Hour)); ok {
+		t.Errorf("sidecar in a linked folder used: %s", got)
+	}
+
+	stale := writeFile(t, root, "c.jpg", "x")
+	writeFile(t, root, "c.thumb.jpg", "old")
+	if got, ok := s.SidecarThumbnail(stale, now.Add(time.Hour)); ok {
+		t.Errorf("sidecar older than the file used: %s", got)
+	}
+}
@@ -0,0 +1,21 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCheckSpaceMeasuresTargetFilesystem(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	// The target's folders don't exist yet; the nearest existing parent is measured
+	if err := s.checkSpace("ssd", "new/deep/file.bin", 1); err != nil {
+		t.Errorf("1 byte into a new folder: %v", err)
+	}
+	if err := s.checkSpace("ssd", "new/deep/file.bin", math.MaxInt64/2); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("huge write: err = %v, want ErrInsufficientSpace", err)
+	}
+	if err := s.checkSpace("ssd", "../outside", 1); err == nil {
+		t.Error("target outside the storage passed")
+	}
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"sort"
+	"storages-api/internal/domain"
+	"strings"
+)
+
+// Built-in categories; CATEGORY_<NAME> variables override or extend them
+var defaultCategories = map[string][]string{
+	"images":    {"jpg", "jpeg", "png", "gif", "webp", "heic", "bmp", "svg"},
+	"videos":    {"mp4", "m4v", "mkv", "webm", "mov", "avi"},
+	"audio":     {"mp3", "flac", "wav", "ogg", "m4a", "aac"},
+	"documents": {"pdf", "txt", "md", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "csv"},
+	"archives":  {"zip", "rar", "7z", "tar", "gz", "tgz", "bz2", "xz"},
+}
+
+// mergeCategories applies config overrides on top of the built-ins;
+// an override with no extensions removes the category
+func mergeCategories(overrides map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(defaultCategories)+len(overrides))
+	for name, exts := range defaultCategories {
+		merged[name] = exts
+	}
+	for name, exts := range overrides {
+		if len(exts) == 0 {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = exts
+	}
+	return merged
+}
+
+// Categories returns the server's category -> extensions mapping
+func (s *FilesystemService) Categories() map[string][]string {
+	out := make(map[string][]string, len(s.categories))
+	for name, exts := range s.categories {
+		out[name] = append([]string(nil), exts...)
+	}
+	return out
+}
+
+// CategoryExtensions resolves a category name case-insensitively; singular
+// and plural forms are interchangeable ("video" finds "videos")
+func (s *FilesystemService) CategoryExtensions(name string) (string, []string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, candidate := range []string{name, name + "s", strings.TrimSuffix(name, "s")} {
+		if exts, ok := s.categories[candidate]; ok {
+			return candidate, exts, true
+		}
+	}
+	return "", nil, false
+}
+
+type extTotals struct {
+	count int
+	size  int64
+}
+
+// extensionTotals groups the matching indexed files by extension in one query
+func (s *FilesystemService) extensionTotals(filter SearchFilter) (map[string]extTotals, error) {
+	totals := make(map[string]extTotals)
+	if s.db == nil {
+		return totals, nil
+	}
+
+	where, args := filter.where()
+	query := "SELECT COALESCE(extension, ''), COUNT(*), COALESCE(SUM(size), 0) FROM files WHERE " + where + " GROUP BY extension"
+	if s.cfg.HardlinkDedup {
+		// One row per content: hard links to the same inode count once
+		query = "SELECT COALESCE(extension, ''), COUNT(*), COALESCE(SUM(size), 0) FROM (SELECT extension, size FROM files WHERE " + where + " GROUP BY storage, " + contentKey + ") GROUP BY extension"
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ext string
+		var t extTotals
+		if err := rows.Scan(&ext, &t.count, &t.size); err == nil {
+			totals[ext] = t
+		}
+	}
+	return totals, rows.Err()
+}
+
+// CategoryStats counts indexed files per category for one storage, sorted by
+// count (then size). An extension listed in several categories counts in each.
+// The second return value is the storage's total file count.
+func (s *FilesystemService) CategoryStats(storage string, categories map[string][]string) ([]domain.CategoryStat, int, error) {
+	if categories == nil {
+		categories = s.categories
+	}
+
+	totals, err := s.extensionTotals(SearchFilter{Storages: []string{storage}})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := 0
+	for _, t := range totals {
+		total += t.count
+	}
+
+	stats := make([]domain.CategoryStat, 0, len(categories))
+	for name, exts := range categories {
+		stat := domain.CategoryStat{Name: name}
+		seen := make(map[string]bool)
+		for _, ext := range exts {
+			ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+			if seen[ext] {
+				continue
+			}
+			seen[ext] = true
+			stat.Count += totals[ext].count
+			stat.Size += totals[ext].size
+		}
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		if stats[i].Size != stats[j].Size {
+			return stats[i].Size > stats[j].Size
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, total, nil
+}
+
+// Composition breaks a storage down by MIME class (image, video, ... other)
+// from a single grouped index query. Every class is present, largest first.
+func (s *FilesystemService) Composition(storage string) ([]domain.CategoryStat, error) {
+	totals, err := s.extensionTotals(SearchFilter{Storages: []string{storage}})
+	if err != nil {
+		return nil, err
+	}
+
+	byClass := make(map[string]*domain.CategoryStat, len(domain.MimeClasses))
+	classes := make([]domain.CategoryStat, len(domain.MimeClasses))
+	for i, name := range domain.MimeClasses {
+		classes[i].Name = name
+		byClass[name] = &classes[i]
+	}
+	for ext, t := range totals {
+		stat := byClass[domain.MimeClassFor(ext)]
+		stat.Count += t.count
+		stat.Size += t.size
+	}
+
+	sort.SliceStable(classes, func(i, j int) bool {
+		return classes[i].Size > classes[j].Size
+	})
+	return classes, nil
+}
+
+// UncategorizedExtensions lists the top extensions not covered by any of the
+// given categories, most frequent first. Files without an extension report "".
+func (s *FilesystemService) UncategorizedExtensions(storage string, categories map[string][]string, top int) ([]domain.ExtensionCount, error) {
+	result := []domain.ExtensionCount{}
+	if s.db == nil {
+		return result, nil
+	}
+
+	var known []string
+	for _, exts := range categories {
+		known = append(known, exts...)
+	}
+
+	where, args := SearchFilter{Storages: []string{storage}}.where()
+	if len(known) > 0 {
+		placeholders := make([]string, len(known))
+		for i, ext := range known {
+			placeholders[i] = "?"
+			args = append(args, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		}
+		where += " AND COALESCE(extension, '') NOT IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	args = append(args, top)
+
+	rows, err := s.db.Query("SELECT COALESCE(extension, ''), COUNT(*) AS n FROM files WHERE "+where+" GROUP BY COALESCE(extension, '') ORDER BY n DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.ExtensionCount
+		if err := rows.Scan(&e.Extension, &e.Count); err == nil {
+			result = append(result, e)
+		}
+	}
+	return result, rows.Err()
+}
+
+// ListStoragesWithStats decorates each storage with its top categories
+func (s *FilesystemService) ListStoragesWithStats(top int) []domain.StorageInfo {
+	storages := s.ListStorages()
+	for i := range storages {
+		stats, _, err := s.CategoryStats(storages[i].Name, nil)
+		if err != nil {
+			continue
+		}
+		var dominant []domain.CategoryStat
+		for _, st := range stats {
+			if st.Count == 0 || len(dominant) == top {
+				break
+			}
+			dominant = append(dominant, st)
+		}
+		storages[i].Categories = dominant
+	}
+	return storages
+}
@@ -0,0 +1,268 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"storages-api/internal/config"
+	"storages-api/internal/domain"
+	"strings"
+)
+
+// Per-storage settings changed at runtime. STORAGE_<NAME>_* variables give
+// the defaults; an override stored here wins over them until it is cleared
+// (set to null), and survives restarts. Only the keys in settingKeys exist.
+
+const storageSettingsSchema = `
+	CREATE TABLE IF NOT EXISTS storage_settings (
+		storage TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		updated DATETIME,
+		PRIMARY KEY (storage, key)
+	);
+`
+
+const maxLabelBytes = 200
+
+// ErrInvalidSetting is returned for an unknown key or a value that fails validation
+var ErrInvalidSetting = errors.New("invalid_setting")
+
+// settingKeys maps each setting to the validator for its JSON value
+var settingKeys = map[string]func(json.RawMessage) error{
+	"label":          validateLabel,
+	"write_prefixes": validateWritePrefixes,
+	"hidden_regex":   validateHiddenRegex,
+	"junk_filter":    validateBool,
+	"searchable":     validateBool,
+	"read_only":      validateBool,
+}
+
+func validateLabel(raw json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("must be a string")
+	}
+	if len(v) > maxLabelBytes {
+		return fmt.Errorf("must be at most %d bytes", maxLabelBytes)
+	}
+	return nil
+}
+
+func validateWritePrefixes(raw json.RawMessage) error {
+	var v []string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("must be a list of folders")
+	}
+	for _, p := range v {
+		if strings.TrimSpace(p) == "" || strings.Contains(filepath.ToSlash(p), "..") {
+			return fmt.Errorf("invalid folder %q", p)
+		}
+	}
+	return nil
+}
+
+func validateHiddenRegex(raw json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("must be a string")
+	}
+	if _, err := regexp.Compile(v); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateBool(raw json.RawMessage) error {
+	var v bool
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}
+
+// applyOverrides layers stored values over the config defaults. Values were
+// validated when saved, so a row that no longer decodes is ignored.
+func applyOverrides(opts config.StorageOptions, overrides map[string]json.RawMessage) config.StorageOptions {
+	for key, raw := range overrides {
+		switch key {
+		case "label":
+			json.Unmarshal(raw, &opts.Label)
+		case "write_prefixes":
+			var v []string
+			if json.Unmarshal(raw, &v) == nil {
+				opts.WritePrefixes = v
+			}
+		case "hidden_regex":
+			json.Unmarshal(raw, &opts.HiddenRegex)
+		case "junk_filter":
+			var v bool
+			if json.Unmarshal(raw, &v) == nil {
+				opts.JunkFilter = &v
+			}
+		case "searchable":
+			var v bool
+			if json.Unmarshal(raw, &v) == nil {
+				opts.Searchable = &v
+			}
+		case "read_only":
+			json.Unmarshal(raw, &opts.ReadOnly)
+		}
+	}
+	return opts
+}
+
+// loadStorageSettings reads all stored overrides into memory
+func loadStorageSettings(db *sql.DB) (map[string]map[string]json.RawMessage, error) {
+	settings := make(map[string]map[string]json.RawMessage)
+	rows, err := db.Query("SELECT storage, key, value FROM storage_settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var storage, key, value string
+		if err := rows.Scan(&storage, &key, &value); err != nil {
+			return nil, err
+		}
+		if _, known := settingKeys[key]; !known {
+			continue
+		}
+		name := strings.ToLower(storage)
+		if settings[name] == nil {
+			settings[name] = make(map[string]json.RawMessage)
+		}
+		settings[name][key] = json.RawMessage(value)
+	}
+	return settings, rows.Err()
+}
+
+// storageName resolves a request's storage name to the registered mount name
+func (s *FilesystemService) storageName(name string) (string, bool) {
+	for _, existing := range s.driver.StorageNames() {
+		if strings.EqualFold(existing, name) {
+			return existing, true
+		}
+	}
+	return "", false
+}
+
+// StorageOptions returns the effective options of a storage: config
+// defaults with the runtime overrides applied
+func (s *FilesystemService) StorageOptions(name string) config.StorageOptions {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return applyOverrides(s.cfg.Storage(name), s.settings[strings.ToLower(name)])
+}
+
+func settingsView(opts config.StorageOptions) domain.StorageSettings {
+	view := domain.StorageSettings{
+		Label:         opts.Label,
+		WritePrefixes: opts.WritePrefixes,
+		HiddenRegex:   opts.HiddenRegex,
+		JunkFilter:    opts.JunkFilter == nil || *opts.JunkFilter,
+		Searchable:    opts.IsSearchable(),
+		ReadOnly:      opts.ReadOnly,
+	}
+	if view.WritePrefixes == nil {
+		view.WritePrefixes = []string{}
+	}
+	return view
+}
+
+// StorageSettings returns a storage's effective settings and the keys that
+// are currently overridden at runtime
+func (s *FilesystemService) StorageSettings(name string) (domain.StorageSettings, []string, error) {
+	realName, ok := s.storageName(name)
+	if !ok {
+		return domain.StorageSettings{}, nil, fmt.Errorf("%w: %s", ErrStorageNotFound, name)
+	}
+	s.settingsMu.RLock()
+	overridden := make([]string, 0, len(s.settings[strings.ToLower(realName)]))
+	for key := range s.settings[strings.ToLower(realName)] {
+		overridden = append(overridden, key)
+	}
+	s.settingsMu.RUnlock()
+	sort.Strings(overridden)
+	return settingsView(s.StorageOptions(realName)), overridden, nil
+}
+
+// UpdateStorageSettings stores the given overrides; a null value clears one
+// so the config default applies again. The whole patch is validated before
+// anything is saved.
+func (s *FilesystemService) UpdateStorageSettings(name string, patch map[string]json.RawMessage) error {
+	realName, ok := s.storageName(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStorageNotFound, name)
+	}
+	for key, raw := range patch {
+		validate, known := settingKeys[key]
+		if !known {
+			return fmt.Errorf("%w: unknown setting %q", ErrInvalidSetting, key)
+		}
+		if string(raw) == "null" {
+			continue
+		}
+		if err := validate(raw); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSetting, key, err)
+		}
+	}
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, raw := range patch {
+		if string(raw) == "null" {
+			_, err = tx.Exec("DELETE FROM storage_settings WHERE storage = ? AND key = ?", realName, key)
+		} else {
+			_, err = tx.Exec(`INSERT INTO storage_settings(storage, key, value, updated) VALUES(?, ?, ?, CURRENT_TIMESTAMP)
+				ON CONFLICT(storage, key) DO UPDATE SET value = excluded.value, updated = excluded.updated`,
+				realName, key, string(raw))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	lower := strings.ToLower(realName)
+	current := make(map[string]json.RawMessage, len(s.settings[lower])+len(patch))
+	for key, raw := range s.settings[lower] {
+		current[key] = raw
+	}
+	for key, raw := range patch {
+		if string(raw) == "null" {
+			delete(current, key)
+		} else {
+			current[key] = raw
+		}
+	}
+	s.settings[lower] = current
+
+	// Listings must pick up new hidden/junk rules right away; the index
+	// follows on its next scan
+	s.setFilterRules(realName, applyOverrides(s.cfg.Storage(realName), current))
+	s.invalidateStorage(realName)
+	return nil
+}
+
+// dropStorageSettings forgets the overrides of an unregistered storage
+func (s *FilesystemService) dropStorageSettings(name string) {
+	s.settingsMu.Lock()
+	delete(s.settings, strings.ToLower(name))
+	s.settingsMu.Unlock()
+	if _, err := s.db.Exec("DELETE FROM storage_settings WHERE storage = ?", name); err != nil {
+		fmt.Printf("Failed to drop settings for %s: %v\n", name, err)
+	}
+}
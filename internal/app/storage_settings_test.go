@@ -0,0 +1,103 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+// patch builds an UpdateStorageSettings body from a JSON object
+func patch(t *testing.T, body string) map[string]json.RawMessage {
+	t.Helper()
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestStorageSettingsPrecedence(t *testing.T) {
+	// Default: nothing set anywhere
+	s, _ := newTestService(t, nil)
+	got, overridden, err := s.StorageSettings("ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Label != "" || got.ReadOnly || !got.Searchable || !got.JunkFilter || len(overridden) != 0 {
+		t.Errorf("defaults = %+v, overridden %v", got, overridden)
+	}
+
+	// Environment over the defaults
+	t.Setenv("STORAGE_SSD_LABEL", "From env")
+	t.Setenv("STORAGE_SSD_READ_ONLY", "true")
+	t.Setenv("STORAGE_SSD_SEARCHABLE", "false")
+	s, _ = newTestService(t, func(cfg *config.Config) {
+		cfg.StorageOptions["ssd"] = config.LoadStorageOptions("ssd")
+	})
+	got, _, _ = s.StorageSettings("ssd")
+	if got.Label != "From env" || !got.ReadOnly || got.Searchable {
+		t.Errorf("env settings = %+v", got)
+	}
+	if err := s.CreateFolder("ssd", "/x"); !errors.Is(err, ErrWriteNotAllowed) {
+		t.Errorf("write to an env read-only storage: err = %v, want ErrWriteNotAllowed", err)
+	}
+
+	// Stored overrides over the environment
+	if err := s.UpdateStorageSettings("SSD", patch(t, `{"label": "From DB", "read_only": false}`)); err != nil {
+		t.Fatal(err)
+	}
+	got, overridden, _ = s.StorageSettings("ssd")
+	if got.Label != "From DB" || got.ReadOnly || got.Searchable {
+		t.Errorf("overridden settings = %+v", got)
+	}
+	if !slices.Equal(overridden, []string{"label", "read_only"}) {
+		t.Errorf("overridden keys = %v, want [label read_only]", overridden)
+	}
+	if err := s.CreateFolder("ssd", "/x"); err != nil {
+		t.Errorf("write after read_only was overridden to false: %v", err)
+	}
+
+	// Overrides survive a restart
+	restarted := NewFilesystemService(s.driver, s.cfg)
+	defer restarted.db.Close()
+	if got, _, _ := restarted.StorageSettings("ssd"); got.Label != "From DB" || got.ReadOnly {
+		t.Errorf("settings after restart = %+v", got)
+	}
+
+	// Clearing an override brings the environment value back
+	if err := restarted.UpdateStorageSettings("ssd", patch(t, `{"label": null}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, overridden, _ := restarted.StorageSettings("ssd"); got.Label != "From env" || !slices.Equal(overridden, []string{"read_only"}) {
+		t.Errorf("after clearing label: %+v, overridden %v", got, overridden)
+	}
+}
+
+func TestStorageSettingsValidation(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	invalid := []string{
+		`{"color": "red"}`,
+		`{"label": 5}`,
+		`{"label": "` + strings.Repeat("x", maxLabelBytes+1) + `"}`,
+		`{"write_prefixes": ["../up"]}`,
+		`{"write_prefixes": [" "]}`,
+		`{"hidden_regex": "("}`,
+		`{"read_only": "yes"}`,
+		// One bad key rejects the whole patch
+		`{"label": "fine", "searchable": 1}`,
+	}
+	for _, body := range invalid {
+		if err := s.UpdateStorageSettings("ssd", patch(t, body)); !errors.Is(err, ErrInvalidSetting) {
+			t.Errorf("%s: err = %v, want ErrInvalidSetting", body, err)
+		}
+	}
+	if got, overridden, _ := s.StorageSettings("ssd"); got.Label != "" || len(overridden) != 0 {
+		t.Errorf("rejected patches changed the settings: %+v, overridden %v", got, overridden)
+	}
+	if err := s.UpdateStorageSettings("nope", patch(t, `{"label": "x"}`)); !errors.Is(err, ErrStorageNotFound) {
+		t.Errorf("unknown storage: err = %v, want ErrStorageNotFound", err)
+	}
+}
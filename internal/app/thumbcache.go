@@ -0,0 +1,250 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"storages-api/internal/domain"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Thumbnails and posters are expensive to make (a full decode, or an ffmpeg
+// run) and cheap to keep, so they are stored on disk across restarts. Each
+// entry is one file named after a hash of storage, path, modification time
+// and variant: an edited file simply gets a new key, and its stale entry ages
+// out. Access times live in memory and are mirrored to the files' mtimes, so
+// the LRU order survives a restart.
+
+const thumbCacheExt = ".thumb"
+
+// Evicting down to this share of the cap leaves room for a burst of new
+// entries before the next sort
+const thumbCacheLowWater = 0.9
+
+type thumbCacheEntry struct {
+	size     int64
+	accessed time.Time
+}
+
+// ThumbnailCache is a size-capped directory of generated thumbnails with
+// least-recently-used eviction
+type ThumbnailCache struct {
+	dir      string
+	maxBytes int64 // 0 = no cap
+
+	mu      sync.Mutex
+	entries map[string]*thumbCacheEntry
+	total   int64
+
+	// One generation per key: concurrent misses wait for the first
+	generating singleflight.Group
+}
+
+// NewThumbnailCache opens (and creates) a cache directory and picks up the
+// entries already in it
+func NewThumbnailCache(dir string, maxBytes int64) *ThumbnailCache {
+	c := &ThumbnailCache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*thumbCacheEntry)}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("Thumbnail cache %s unavailable: %v\n", dir, err)
+		return c
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return c
+	}
+	for _, f := range files {
+		key, ok := strings.CutSuffix(f.Name(), thumbCacheExt)
+		if !ok || f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		c.entries[key] = &thumbCacheEntry{size: info.Size(), accessed: info.ModTime()}
+		c.total += info.Size()
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c
+}
+
+// Key names the entry for one variant (e.g. "poster", "img512") of a file
+// as it was at modTime
+func (c *ThumbnailCache) Key(storage, path string, modTime time.Time, variant string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d:%s", storage, path, modTime.UnixNano(), variant)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ThumbnailCache) file(key string) string {
+	return filepath.Join(c.dir, key+thumbCacheExt)
+}
+
+// Get returns a cached entry and marks it as just used
+func (c *ThumbnailCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.file(key))
+	if err != nil {
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+			c.total -= entry.size
+		}
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	entry.accessed = now
+	c.mu.Unlock()
+	os.Chtimes(c.file(key), now, now)
+	return data, true
+}
+
+// Put stores an entry (temp file + rename, so readers never see half of
+// one) and evicts the least recently used entries past the cap. A cache that
+// can't be written only costs the next request a regeneration.
+func (c *ThumbnailCache) Put(key string, data []byte) {
+	tmp, err := os.CreateTemp(c.dir, ".put-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.file(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.total -= old.size
+	}
+	c.entries[key] = &thumbCacheEntry{size: int64(len(data)), accessed: time.Now()}
+	c.total += int64(len(data))
+	c.evictLocked()
+}
+
+// GetOrCreate returns the cached entry for key, or runs generate and caches
+// its result. Requests missing the same key at once share one generate call.
+func (c *ThumbnailCache) GetOrCreate(key string, generate func() ([]byte, error)) ([]byte, bool, error) {
+	if data, ok := c.Get(key); ok {
+		return data, true, nil
+	}
+	v, err, _ := c.generating.Do(key, func() (interface{}, error) {
+		// A generation that finished between Get and Do already stored it
+		if data, ok := c.Get(key); ok {
+			return data, nil
+		}
+		data, err := generate()
+		if err != nil {
+			return nil, err
+		}
+		c.Put(key, data)
+		return data, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return v.([]byte), false, nil
+}
+
+func (c *ThumbnailCache) evictLocked() {
+	if c.maxBytes <= 0 || c.total <= c.maxBytes {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].accessed.Before(c.entries[keys[j]].accessed)
+	})
+	target := int64(float64(c.maxBytes) * thumbCacheLowWater)
+	for _, key := range keys {
+		if c.total <= target {
+			break
+		}
+		os.Remove(c.file(key))
+		c.total -= c.entries[key].size
+		delete(c.entries, key)
+	}
+}
+
+// ErrNoThumbnail is returned by Thumbnail for a file that is not an image or
+// video, or an image format the decoder doesn't know
+var ErrNoThumbnail = errors.New("no_thumbnail")
+
+// Thumbnail is a small image standing in for a file
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Source      string // "sidecar", "cache" or "generated"
+}
+
+// Thumbnail returns the thumbnail of an image or video as it was at modTime:
+// a sidecar when there is one, otherwise a JPEG downscaled to
+// PREVIEW_THUMB_MAX_PIXELS (images) or the first frame (videos), served
+// from the thumbnail cache when already made.
+func (s *FilesystemService) Thumbnail(storage, path string, modTime time.Time) (Thumbnail, error) {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return Thumbnail{}, err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	kind := domain.PreviewTypeFor(ext)
+	if kind != domain.PreviewImage && kind != domain.PreviewVideo {
+		return Thumbnail{}, ErrNoThumbnail
+	}
+
+	if sidecar, ok := s.SidecarThumbnail(realPath, modTime); ok {
+		if data, err := os.ReadFile(sidecar); err == nil {
+			return Thumbnail{Data: data, ContentType: domain.ContentTypeFor(filepath.Ext(sidecar)), Source: "sidecar"}, nil
+		}
+	}
+
+	var key string
+	var generate func() ([]byte, error)
+	if kind == domain.PreviewVideo {
+		key = s.thumbs.Key(storage, path, modTime, "poster")
+		generate = func() ([]byte, error) { return s.GetVideoThumbnail(realPath) }
+	} else {
+		maxPixels := s.cfg.PreviewThumbMaxPixels
+		key = s.thumbs.Key(storage, path, modTime, fmt.Sprintf("img%d", maxPixels))
+		generate = func() ([]byte, error) { return s.GetImageThumbnail(realPath, maxPixels) }
+	}
+	data, hit, err := s.thumbs.GetOrCreate(key, generate)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return Thumbnail{}, ErrNoThumbnail
+		}
+		return Thumbnail{}, err
+	}
+	source := "generated"
+	if hit {
+		source = "cache"
+	}
+	return Thumbnail{Data: data, ContentType: "image/jpeg", Source: source}, nil
+}
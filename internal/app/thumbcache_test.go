@@ -0,0 +1,37 @@
+package app
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThumbnailCacheGeneratesOncePerKey(t *testing.T) {
+	c := NewThumbnailCache(t.TempDir(), 0)
+	var calls atomic.Int32
+	generate := func() ([]byte, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond) // an ffmpeg run
+		return []byte("jpeg"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, _, err := c.GetOrCreate("key", generate)
+			if err != nil || string(data) != "jpeg" {
+				t.Errorf("GetOrCreate = %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("generate ran %d times for concurrent misses, want 1", n)
+	}
+	if _, hit, _ := c.GetOrCreate("key", generate); !hit {
+		t.Error("later request missed the cache")
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Server-side token state. Access tokens are JWTs that stay stateless except
+// for their jti, which logout puts on the revocation list until the token
+// would have expired anyway. Refresh tokens are opaque random strings; only
+// their SHA-256 is stored, and each one is single-use. A refresh token also
+// stores a binding to the account's password and the JWT secret, so it stops
+// working once either changes.
+//
+// Both tables live in the index database. Deleting it, or running with
+// INDEX_DB_PATH=:memory:, forgets every logout (revoked tokens work again
+// until they expire) and every refresh token.
+
+const tokensSchema = `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY,
+		expires DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		hash TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		role TEXT NOT NULL,
+		expires DATETIME NOT NULL,
+		binding TEXT
+	);
+`
+
+// ErrInvalidRefreshToken is returned for an unknown, used or expired refresh token
+var ErrInvalidRefreshToken = errors.New("invalid_refresh_token")
+
+// NewTokenID returns a random jti for a new access token
+func NewTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func refreshTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadRevokedTokens reads the revocation list, dropping entries whose token has expired
+func loadRevokedTokens(db *sql.DB) (map[string]time.Time, error) {
+	now := time.Now()
+	if _, err := db.Exec("DELETE FROM revoked_tokens WHERE expires < ?", now); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("DELETE FROM refresh_tokens WHERE expires < ?", now); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT jti, expires FROM revoked_tokens")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expires time.Time
+		if err := rows.Scan(&jti, &expires); err != nil {
+			return nil, err
+		}
+		revoked[jti] = expires
+	}
+	return revoked, rows.Err()
+}
+
+// TokenRevoked reports whether logout has invalidated the access token with this jti
+func (s *FilesystemService) TokenRevoked(jti string) bool {
+	s.revokedMu.RLock()
+	defer s.revokedMu.RUnlock()
+	_, ok := s.revoked[jti]
+	return ok
+}
+
+// RevokeToken invalidates an access token until expires, its own expiry
+func (s *FilesystemService) RevokeToken(jti string, expires time.Time) error {
+	if _, err := s.db.Exec("INSERT OR REPLACE INTO revoked_tokens (jti, expires) VALUES (?, ?)", jti, expires); err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+
+	now := time.Now()
+	s.revokedMu.Lock()
+	defer s.revokedMu.Unlock()
+	s.revoked[jti] = expires
+	for id, exp := range s.revoked {
+		if exp.Before(now) {
+			delete(s.revoked, id)
+		}
+	}
+	s.db.Exec("DELETE FROM revoked_tokens WHERE expires < ?", now)
+	return nil
+}
+
+// IssueRefreshToken stores a new refresh token for the account and returns it
+// with its expiry. binding identifies the credentials it was issued for.
+func (s *FilesystemService) IssueRefreshToken(username, role, binding string) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expires := time.Now().Add(time.Duration(s.cfg.RefreshTokenTTLHours) * time.Hour)
+	_, err := s.db.Exec("INSERT INTO refresh_tokens (hash, username, role, expires, binding) VALUES (?, ?, ?, ?, ?)",
+		refreshTokenHash(token), username, role, expires, binding)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("store refresh token: %w", err)
+	}
+	return token, expires, nil
+}
+
+// UseRefreshToken consumes a refresh token and returns the account it was
+// issued to and its binding, empty for tokens stored before bindings existed.
+// The caller compares the binding and issues a replacement.
+func (s *FilesystemService) UseRefreshToken(token string) (username, role, binding string, err error) {
+	var expires time.Time
+	var stored sql.NullString
+	hash := refreshTokenHash(token)
+	err = s.db.QueryRow("DELETE FROM refresh_tokens WHERE hash = ? RETURNING username, role, expires, binding", hash).
+		Scan(&username, &role, &expires, &stored)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && expires.Before(time.Now())) {
+		return "", "", "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("use refresh token: %w", err)
+	}
+	return username, role, stored.String, nil
+}
+
+// RevokeRefreshToken drops a refresh token; unknown tokens are ignored
+func (s *FilesystemService) RevokeRefreshToken(token string) error {
+	_, err := s.db.Exec("DELETE FROM refresh_tokens WHERE hash = ?", refreshTokenHash(token))
+	return err
+}
+
+// RevokeRefreshTokens drops every refresh token of an account
+func (s *FilesystemService) RevokeRefreshTokens(username string) error {
+	_, err := s.db.Exec("DELETE FROM refresh_tokens WHERE username = ?", username)
+	return err
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ErrToolUnavailable is returned instead of shelling out to a missing binary
+var ErrToolUnavailable = errors.New("tool_unavailable")
+
+// External binaries used for thumbnails and media metadata
+const (
+	ToolFFmpeg  = "ffmpeg"
+	ToolFFprobe = "ffprobe"
+)
+
+// probeTools resolves the external tools once at startup. Missing tools are
+// logged so operators know which features won't work.
+func (s *FilesystemService) probeTools() {
+	configured := map[string]string{
+		ToolFFmpeg:  s.cfg.FFmpegPath,
+		ToolFFprobe: s.cfg.FFprobePath,
+	}
+
+	s.tools = make(map[string]string)
+	for name, bin := range configured {
+		resolved, err := exec.LookPath(bin)
+		if err != nil {
+			fmt.Printf("Warning: %s not found (%s); video thumbnails and metadata are unavailable\n", name, bin)
+			continue
+		}
+		s.tools[name] = resolved
+	}
+}
+
+// toolPath returns the resolved binary, or ErrToolUnavailable
+func (s *FilesystemService) toolPath(name string) (string, error) {
+	if p, ok := s.tools[name]; ok {
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrToolUnavailable, name)
+}
+
+// Tools reports which external tools were found at startup (for /ping)
+func (s *FilesystemService) Tools() map[string]bool {
+	return map[string]bool{
+		ToolFFmpeg:  s.tools[ToolFFmpeg] != "",
+		ToolFFprobe: s.tools[ToolFFprobe] != "",
+	}
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// indexedModTime is the modtime stored in path's index row
+func indexedModTime(t *testing.T, s *FilesystemService, path string) time.Time {
+	t.Helper()
+	var modified sql.NullTime
+	if err := s.db.QueryRow("SELECT modified FROM files WHERE storage = 'ssd' AND path = ?", path).Scan(&modified); err != nil {
+		t.Fatalf("index row %s: %v", path, err)
+	}
+	return modified.Time
+}
+
+func TestTouchFile(t *testing.T) {
+	s, root := hashingService(t)
+	writeFile(t, root, "a.txt", "same")
+	writeFile(t, root, "b.txt", "same")
+	s.indexStorage("ssd", true)
+	sum := indexedSHA(t, s, "a.txt")
+	if sum == "" {
+		t.Fatal("a.txt was not hashed by the scan")
+	}
+
+	when := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+	touched, err := s.Touch("ssd", "/a.txt", when, false)
+	if err != nil || touched != 1 {
+		t.Fatalf("Touch = %d, %v; want 1, nil", touched, err)
+	}
+	info, err := os.Stat(filepath.Join(root, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(when) {
+		t.Errorf("file modtime = %v, want %v", info.ModTime(), when)
+	}
+	if got := indexedModTime(t, s, "a.txt"); !got.Equal(when) {
+		t.Errorf("indexed modtime = %v, want %v", got, when)
+	}
+	if got := indexedSHA(t, s, "a.txt"); got != sum {
+		t.Errorf("indexed sha256 after touch = %q, want %s", got, sum)
+	}
+}
+
+func TestTouchRecursive(t *testing.T) {
+	s, root := hashingService(t)
+	writeFile(t, root, "dir/a.txt", "same")
+	writeFile(t, root, "dir/sub/b.txt", "same")
+	writeFile(t, root, "other.txt", "other")
+	s.indexStorage("ssd", true)
+	sums := map[string]string{}
+	for _, p := range []string{"dir/a.txt", "dir/sub/b.txt"} {
+		if sums[p] = indexedSHA(t, s, p); sums[p] == "" {
+			t.Fatalf("%s was not hashed by the scan", p)
+		}
+	}
+	before, err := os.Stat(filepath.Join(root, "other.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+	touched, err := s.Touch("ssd", "/dir", when, true)
+	if err != nil || touched != 4 {
+		t.Fatalf("Touch = %d, %v; want 4, nil", touched, err)
+	}
+	for _, p := range []string{"dir", "dir/a.txt", "dir/sub", "dir/sub/b.txt"} {
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(when) {
+			t.Errorf("%s modtime = %v, want %v", p, info.ModTime(), when)
+		}
+		if got := indexedModTime(t, s, p); !got.Equal(when) {
+			t.Errorf("%s indexed modtime = %v, want %v", p, got, when)
+		}
+	}
+	for p, sum := range sums {
+		if got := indexedSHA(t, s, p); got != sum {
+			t.Errorf("%s indexed sha256 after touch = %q, want %s", p, got, sum)
+		}
+	}
+	after, err := os.Stat(filepath.Join(root, "other.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("other.txt modtime changed to %v", after.ModTime())
+	}
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"storages-api/internal/domain"
+	"time"
+)
+
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+// Deleted items are parked in a folder with this prefix next to them until
+// the whole transaction has succeeded, so a delete can be undone. Hidden, so
+// listings and the index skip it; a sibling, so parking is a plain rename on
+// the same filesystem and subject to the same write prefixes.
+const txStagingPrefix = ".txn-"
+
+// txStagingDir is the staging folder of delete step i
+func txStagingDir(staging string, i int, path string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf("%s-%d", staging, i))
+}
+
+// undo reverses one applied step
+type undoFunc func() error
+
+// RunTransaction applies the operations in order. If one fails, the steps
+// already applied are compensated in reverse order (moves are moved back,
+// copies and created folders removed, deleted items restored from staging).
+//
+// This is best effort, not a real filesystem transaction: other clients can
+// observe intermediate state, and an undo can itself fail (e.g. a path was
+// taken meanwhile). Each step reports whether it was rolled back.
+func (s *FilesystemService) RunTransaction(storage string, ops []domain.TransactionOp) (domain.TransactionResult, error) {
+	result := domain.TransactionResult{Failed: -1}
+
+	for i, op := range ops {
+		switch op.Op {
+		case domain.TxMkdir, domain.TxDelete:
+		case domain.TxMove, domain.TxCopy:
+			if op.Destination == "" {
+				return result, fmt.Errorf("%w: step %d: destination required for %s", ErrInvalidTransaction, i, op.Op)
+			}
+		default:
+			return result, fmt.Errorf("%w: step %d: unknown op %q", ErrInvalidTransaction, i, op.Op)
+		}
+		if op.Path == "" {
+			return result, fmt.Errorf("%w: step %d: path required", ErrInvalidTransaction, i)
+		}
+	}
+
+	staging := fmt.Sprintf("%s%d", txStagingPrefix, time.Now().UnixNano())
+	undos := make([]undoFunc, 0, len(ops))
+	result.Steps = make([]domain.TransactionStep, len(ops))
+
+	for i, op := range ops {
+		result.Steps[i].TransactionOp = op
+		undo, err := s.applyTxOp(storage, staging, i, op)
+		if err != nil {
+			result.Steps[i].Err = err
+			result.Failed = i
+			break
+		}
+		result.Steps[i].Applied = true
+		undos = append(undos, undo)
+	}
+
+	if result.Failed >= 0 {
+		for i := len(undos) - 1; i >= 0; i-- {
+			if err := undos[i](); err != nil {
+				result.Steps[i].RollbackErr = err
+				fmt.Printf("Transaction rollback of step %d failed: %v\n", i, err)
+				continue
+			}
+			result.Steps[i].RolledBack = true
+		}
+	}
+
+	// Committed deletes (or fully restored staging) leave nothing worth keeping
+	for i, op := range ops {
+		if op.Op != domain.TxDelete {
+			continue
+		}
+		dir := txStagingDir(staging, i, op.Path)
+		if found, err := s.exists(storage, dir); err == nil && found {
+			if err := s.driver.Delete(storage, dir); err != nil {
+				fmt.Printf("Transaction staging cleanup failed for %s: %v\n", dir, err)
+			}
+		}
+	}
+
+	s.invalidateStorage(storage)
+	result.Success = result.Failed < 0
+	return result, nil
+}
+
+func (s *FilesystemService) exists(storage, path string) (bool, error) {
+	realPath, err := s.driver.GetRealPath(storage, path)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Lstat(realPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// applyTxOp performs one step and returns how to undo it
+func (s *FilesystemService) applyTxOp(storage, staging string, i int, op domain.TransactionOp) (undoFunc, error) {
+	switch op.Op {
+	case domain.TxMkdir:
+		existed, err := s.exists(storage, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		// Parents the mkdir creates are undone with it
+		top := s.missingAncestor(storage, op.Path)
+		if err := s.CreateFolder(storage, op.Path); err != nil {
+			return nil, err
+		}
+		return func() error {
+			if existed {
+				return nil
+			}
+			// Only empty folders are removed, never content we didn't create
+			created := op.Path
+			for dir := op.Path; ; dir = filepath.Dir(dir) {
+				realPath, err := s.driver.GetRealPath(storage, dir)
+				if err != nil {
+					return err
+				}
+				if err := os.Remove(realPath); err != nil {
+					if dir == op.Path {
+						return err
+					}
+					break // filled meanwhile; keep it
+				}
+				created = dir
+				if top == "" || indexPath(dir) == indexPath(top) {
+					break
+				}
+			}
+			s.invalidateStorage(storage)
+			s.indexRemove(storage, created)
+			return nil
+		}, nil
+
+	case domain.TxMove, domain.TxCopy:
+		// Overwrites can't be undone, so they aren't allowed
+		taken, err := s.exists(storage, op.Destination)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, fmt.Errorf("%w: %s", ErrTargetExists, op.Destination)
+		}
+
+		if op.Op == domain.TxMove {
+			if err := s.RenameOrMove(storage, op.Path, op.Destination); err != nil {
+				return nil, err
+			}
+			return func() error {
+				return s.RenameOrMove(storage, op.Destination, op.Path)
+			}, nil
+		}
+		if err := s.Copy(storage, op.Path, op.Destination); err != nil {
+			return nil, err
+		}
+		return func() error {
+			return s.Delete(storage, op.Destination)
+		}, nil
+
+	case domain.TxDelete:
+		if err := s.checkWritable(storage, op.Path); err != nil {
+			return nil, err
+		}
+		if found, err := s.exists(storage, op.Path); err != nil || !found {
+			if err == nil {
+				err = os.ErrNotExist
+			}
+			return nil, err
+		}
+		// Park the item instead of removing it; the staging folder is
+		// dropped once the transaction is over
+		dir := txStagingDir(staging, i, op.Path)
+		if err := s.checkWritable(storage, dir); err != nil {
+			return nil, err
+		}
+		parked := filepath.Join(dir, filepath.Base(op.Path))
+		if err := s.driver.CreateFolder(storage, dir); err != nil {
+			return nil, err
+		}
+		if err := s.driver.Rename(storage, op.Path, parked); err != nil {
+			return nil, err
+		}
+		s.invalidateStorage(storage)
+		s.indexRemove(storage, op.Path)
+		return func() error {
+			if err := s.driver.Rename(storage, parked, op.Path); err != nil {
+				return err
+			}
+			s.invalidateStorage(storage)
+			s.indexUpsert(storage, op.Path)
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidTransaction, op.Op)
+}
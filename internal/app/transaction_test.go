@@ -0,0 +1,158 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"storages-api/internal/domain"
+	"strings"
+	"testing"
+)
+
+func TestTransactionRollsBackOnMidSequenceFailure(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "old/a.txt", "a")
+	writeFile(t, root, "old/b.txt", "b")
+
+	ops := []domain.TransactionOp{
+		{Op: domain.TxMkdir, Path: "/new"},
+		{Op: domain.TxMove, Path: "/old/a.txt", Destination: "/new/a.txt"},
+		{Op: domain.TxCopy, Path: "/old/b.txt", Destination: "/new/b.txt"},
+		{Op: domain.TxDelete, Path: "/old/b.txt"},
+		{Op: domain.TxMove, Path: "/old/missing.txt", Destination: "/new/missing.txt"},
+		{Op: domain.TxDelete, Path: "/old"},
+	}
+	res, err := s.RunTransaction("ssd", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Success || res.Failed != 4 {
+		t.Fatalf("success = %v, failed step = %d; want false, 4", res.Success, res.Failed)
+	}
+	for i, step := range res.Steps {
+		switch {
+		case i < 4:
+			if !step.Applied || !step.RolledBack || step.Err != nil || step.RollbackErr != nil {
+				t.Errorf("step %d = %+v, want applied and rolled back", i, step)
+			}
+		case i == 4:
+			if step.Applied || step.Err == nil || step.RolledBack {
+				t.Errorf("failing step = %+v, want an error and nothing applied", step)
+			}
+		default:
+			if step.Applied || step.RolledBack {
+				t.Errorf("step %d after the failure = %+v, want it untouched", i, step)
+			}
+		}
+	}
+
+	for rel, want := range map[string]string{"old/a.txt": "a", "old/b.txt": "b"} {
+		got, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q restored", rel, got, err, want)
+		}
+	}
+	assertNoStaging(t, root)
+	if _, err := os.Stat(filepath.Join(root, "new")); !os.IsNotExist(err) {
+		t.Errorf("created folder left behind after rollback: %v", err)
+	}
+}
+
+// assertNoStaging fails for any transaction staging folder under root
+func assertNoStaging(t *testing.T, root string) {
+	t.Helper()
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), txStagingPrefix) {
+			t.Errorf("staging folder %s left behind", path)
+		}
+		return nil
+	})
+}
+
+func TestTransactionRollsBackCreatedParents(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "keep/a.txt", "a")
+	res, err := s.RunTransaction("ssd", []domain.TransactionOp{
+		{Op: domain.TxMkdir, Path: "/keep/x/y/z"},
+		{Op: domain.TxMkdir, Path: "/new/deep"},
+		{Op: domain.TxDelete, Path: "/missing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Success || !res.Steps[0].RolledBack || !res.Steps[1].RolledBack {
+		t.Fatalf("result = %+v, want both mkdirs rolled back", res)
+	}
+	for _, rel := range []string{"keep/x", "new"} {
+		if _, err := os.Stat(filepath.Join(root, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after rollback: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "keep", "a.txt")); err != nil {
+		t.Errorf("existing folder removed by rollback: %v", err)
+	}
+}
+
+func TestTransactionRespectsWriteRestrictions(t *testing.T) {
+	s, root := newTestService(t, func(cfg *config.Config) {
+		cfg.StorageOptions["ssd"] = config.StorageOptions{WritePrefixes: []string{"inbox"}}
+	})
+	writeFile(t, root, "inbox/a.txt", "a")
+	writeFile(t, root, "other/b.txt", "b")
+
+	res, err := s.RunTransaction("ssd", []domain.TransactionOp{{Op: domain.TxDelete, Path: "/inbox/a.txt"}})
+	if err != nil || !res.Success {
+		t.Fatalf("delete inside the write prefix: %+v, %v", res, err)
+	}
+	for _, op := range []domain.TransactionOp{
+		{Op: domain.TxDelete, Path: "/other/b.txt"},
+		{Op: domain.TxMkdir, Path: "/other/new"},
+		{Op: domain.TxMove, Path: "/other/b.txt", Destination: "/inbox/b.txt"},
+		{Op: domain.TxCopy, Path: "/other/b.txt", Destination: "/other/c.txt"},
+	} {
+		res, err := s.RunTransaction("ssd", []domain.TransactionOp{op})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Success || !errors.Is(res.Steps[0].Err, ErrWriteNotAllowed) {
+			t.Errorf("%s %s: step = %+v, want ErrWriteNotAllowed", op.Op, op.Path, res.Steps[0])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "other", "b.txt")); err != nil {
+		t.Errorf("file outside the write prefix touched: %v", err)
+	}
+	assertNoStaging(t, root)
+
+	s.cfg.StorageOptions["ssd"] = config.StorageOptions{ReadOnly: true}
+	writeFile(t, root, "inbox/c.txt", "c")
+	res, _ = s.RunTransaction("ssd", []domain.TransactionOp{{Op: domain.TxDelete, Path: "/inbox/c.txt"}})
+	if res.Success || !errors.Is(res.Steps[0].Err, ErrWriteNotAllowed) {
+		t.Errorf("delete on a read-only storage: %+v", res.Steps[0])
+	}
+	assertNoStaging(t, root)
+}
+
+func TestTransactionCommits(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "old/a.txt", "a")
+	res, err := s.RunTransaction("ssd", []domain.TransactionOp{
+		{Op: domain.TxMkdir, Path: "/new"},
+		{Op: domain.TxMove, Path: "/old/a.txt", Destination: "/new/a.txt"},
+		{Op: domain.TxDelete, Path: "/old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || res.Failed != -1 {
+		t.Fatalf("success = %v, failed step = %d; want true, -1", res.Success, res.Failed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "new", "a.txt")); err != nil {
+		t.Errorf("moved file missing: %v", err)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 || entries[0].Name() != "new" {
+		t.Errorf("storage root after commit has %v, want only new", entries)
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"storages-api/internal/domain"
+	"storages-api/internal/infra/filesystem"
+)
+
+// ErrInTrash is returned for writes to the trash folder itself, which only
+// the trash endpoints may touch
+var ErrInTrash = errors.New("path_in_trash")
+
+// ErrInvalidTrashID is returned for a malformed trash id
+var ErrInvalidTrashID = filesystem.ErrInvalidTrashID
+
+// Trash moves a path into the storage's trash instead of deleting it and
+// returns the id to restore it with. Its index rows go, as on a delete.
+func (s *FilesystemService) Trash(storage, path string) (string, error) {
+	if err := s.checkWritable(storage, path); err != nil {
+		return "", err
+	}
+	id, err := s.driver.MoveToTrash(storage, path)
+	if err == nil {
+		s.invalidateStorage(storage)
+		s.indexRemove(storage, path)
+	}
+	return id, err
+}
+
+// ListTrash returns a storage's trash entries, newest first
+func (s *FilesystemService) ListTrash(storage string) ([]domain.TrashItem, error) {
+	return s.driver.ListTrash(storage)
+}
+
+// RestoreFromTrash moves a trash entry back to where it was deleted from
+// and returns that path
+func (s *FilesystemService) RestoreFromTrash(storage, trashID string) (string, error) {
+	original, err := s.driver.TrashedPath(storage, trashID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkWritable(storage, original); err != nil {
+		return "", err
+	}
+	created := original
+	if top := s.missingAncestor(storage, original); top != "" {
+		created = top
+	}
+	path, err := s.driver.RestoreFromTrash(storage, trashID)
+	if err == nil {
+		s.invalidateStorage(storage)
+		s.indexUpsert(storage, created)
+	}
+	return path, err
+}
+
+// PurgeTrash permanently deletes one trash entry, or every entry when
+// trashID is empty. On a storage with write prefixes emptying the trash only
+// drops the entries whose original path the caller may write.
+func (s *FilesystemService) PurgeTrash(storage, trashID string) error {
+	if trashID != "" {
+		original, err := s.driver.TrashedPath(storage, trashID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkWritable(storage, original); err != nil {
+			return err
+		}
+		return s.driver.PurgeTrash(storage, trashID)
+	}
+
+	opts := s.StorageOptions(storage)
+	if opts.ReadOnly {
+		return ErrWriteNotAllowed
+	}
+	if len(opts.WritePrefixes) == 0 {
+		return s.driver.PurgeTrash(storage, "")
+	}
+	items, err := s.driver.ListTrash(storage)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if s.checkWritable(storage, item.Path) != nil {
+			continue
+		}
+		if err := s.driver.PurgeTrash(storage, item.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
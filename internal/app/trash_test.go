@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestWritesInsideTrashAreRefused(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "a.txt", "a")
+	id, err := s.Trash("ssd", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := ".trash/" + id + ".json"
+
+	writes := map[string]func() error{
+		"folder":   func() error { return s.CreateFolder("ssd", ".trash/x") },
+		"file":     func() error { return s.CreateFile("ssd", ".trash/x.json") },
+		"rename":   func() error { return s.RenameOrMove("ssd", record, "b.json") },
+		"move in":  func() error { return s.RenameOrMove("ssd", "b.txt", ".trash/b.txt") },
+		"copy in":  func() error { return s.Copy("ssd", "b.txt", ".trash/b.txt") },
+		"delete":   func() error { return s.Delete("ssd", record) },
+		"trash it": func() error { _, err := s.Trash("ssd", ".trash"); return err },
+		"upload": func() error {
+			_, err := s.UploadFile("ssd", record, strings.NewReader("{}"), 2, ConflictOverwrite, "")
+			return err
+		},
+	}
+	writeFile(t, root, "b.txt", "b")
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrInTrash) {
+			t.Errorf("%s: err = %v, want ErrInTrash", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".trash", id+".json")); err != nil {
+		t.Errorf("trash record is gone: %v", err)
+	}
+}
+
+func TestPurgeTrashKeepsEntriesOutsideWritePrefixes(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "inbox/mine.txt", "x")
+	writeFile(t, root, "other/theirs.txt", "x")
+	if _, err := s.Trash("ssd", "inbox/mine.txt"); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.Trash("ssd", "other/theirs.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.cfg.StorageOptions = map[string]config.StorageOptions{"ssd": {WritePrefixes: []string{"inbox"}}}
+	if err := s.PurgeTrash("ssd", ""); err != nil {
+		t.Fatal(err)
+	}
+	items, err := s.ListTrash("ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != kept {
+		t.Errorf("trash after purge = %+v, want only %s", items, kept)
+	}
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"storages-api/internal/config"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadKeepsUmaskModeByDefault(t *testing.T) {
+	s, root := newTestService(t, nil)
+	if _, err := s.UploadFile("ssd", "up.txt", strings.NewReader("x"), 1, ConflictOverwrite, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Whatever the umask is, os.Create gets the same mode
+	f, err := os.Create(filepath.Join(root, "plain.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, want := filePerm(t, root, "up.txt"), filePerm(t, root, "plain.txt"); got != want {
+		t.Errorf("upload mode = %v, want %v like os.Create", got, want)
+	}
+}
+
+func TestCreateFileMode(t *testing.T) {
+	s, root := newTestService(t, nil)
+	if err := s.CreateFile("ssd", "default.txt"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(root, "plain.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, want := filePerm(t, root, "default.txt"), filePerm(t, root, "plain.txt"); got != want {
+		t.Errorf("default mode = %v, want %v like os.Create", got, want)
+	}
+
+	s.driver.SetWriteModes(0640, 0)
+	if err := s.CreateFile("ssd", "set.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := filePerm(t, root, "set.txt"); got != 0640 {
+		t.Errorf("configured mode = %v, want 0640", got)
+	}
+}
+
+func TestConfiguredWriteModes(t *testing.T) {
+	// 0664/0775 keep the group write bit a usual umask strips; 0600/0700 are
+	// tighter than any umask leaves
+	for _, modes := range [][2]os.FileMode{{0664, 0775}, {0600, 0700}} {
+		t.Run(modes[0].String(), func(t *testing.T) {
+			s, root := newTestService(t, func(cfg *config.Config) {
+				cfg.UploadFileMode, cfg.UploadDirMode = modes[0], modes[1]
+			})
+			if _, err := s.UploadFile("ssd", "new/sub/up.txt", strings.NewReader("x"), 1, ConflictOverwrite, ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.CreateFolder("ssd", "made"); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]os.FileMode{"new/sub/up.txt": modes[0], "new": modes[1], "new/sub": modes[1], "made": modes[1]}
+			for rel, mode := range want {
+				if got := filePerm(t, root, rel); got != mode {
+					t.Errorf("%s mode = %v, want %v", rel, got, mode)
+				}
+			}
+		})
+	}
+}
+
+// filePerm is the permission bits of root/rel
+func filePerm(t *testing.T, root, rel string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(root, rel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+// barrierReader waits on its first Read until every reader sharing started
+// has been read from
+type barrierReader struct {
+	r       io.Reader
+	started *sync.WaitGroup
+	once    sync.Once
+}
+
+func (b *barrierReader) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		b.started.Done()
+		b.started.Wait()
+	})
+	return b.r.Read(p)
+}
+
+func TestConcurrentUploadsNeverReplaceEachOther(t *testing.T) {
+	for _, policy := range []ConflictPolicy{ConflictSkip, ConflictRename} {
+		t.Run(string(policy), func(t *testing.T) {
+			s, root := newTestService(t, nil)
+			const uploads = 8
+			paths := make(chan string, uploads)
+			// Every upload is past its conflict check before any is placed
+			var started sync.WaitGroup
+			started.Add(uploads)
+			var wg sync.WaitGroup
+			for i := 0; i < uploads; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					content := fmt.Sprintf("upload %d", i)
+					src := &barrierReader{r: strings.NewReader(content), started: &started}
+					res, err := s.UploadFile("ssd", "same.txt", src, int64(len(content)), policy, "")
+					if errors.Is(err, ErrTargetExists) && policy == ConflictSkip {
+						return
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if data, err := os.ReadFile(filepath.Join(root, res.FilePath)); err != nil || string(data) != content {
+						t.Errorf("%s holds %q, want %q", res.FilePath, data, content)
+					}
+					paths <- res.FilePath
+				}()
+			}
+			wg.Wait()
+			close(paths)
+
+			seen := map[string]bool{}
+			for p := range paths {
+				if seen[p] {
+					t.Errorf("two uploads reported %s", p)
+				}
+				seen[p] = true
+			}
+			want := 1
+			if policy == ConflictRename {
+				want = uploads
+			}
+			if len(seen) != want {
+				t.Errorf("%d uploads saved, want %d", len(seen), want)
+			}
+		})
+	}
+}
+
+func TestUploadConflictBeforeSpaceCheck(t *testing.T) {
+	s, root := newTestService(t, nil)
+	writeFile(t, root, "big.bin", "x")
+	_, err := s.UploadFile("ssd", "big.bin", strings.NewReader(""), math.MaxInt64/2, ConflictSkip, "")
+	if !errors.Is(err, ErrTargetExists) {
+		t.Errorf("taken name on a full disk: err = %v, want ErrTargetExists", err)
+	}
+}
+
+// countingReader tracks how many readers are being read at once; each one
+// holds its slot until gate is closed
+type countingReader struct {
+	r      io.Reader
+	active *atomic.Int32
+	peak   *atomic.Int32
+	gate   <-chan struct{}
+	once   sync.Once
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.once.Do(func() {
+		n := c.active.Add(1)
+		for {
+			peak := c.peak.Load()
+			if n <= peak || c.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		<-c.gate
+	})
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		c.active.Add(-1)
+	}
+	return n, err
+}
+
+func TestUploadConcurrencyCap(t *testing.T) {
+	const uploads, limit = 12, 3
+	for _, queue := range []int{0, 10} {
+		t.Run(fmt.Sprintf("queue %ds", queue), func(t *testing.T) {
+			s, _ := newTestService(t, func(cfg *config.Config) {
+				cfg.UploadMaxConcurrent = limit
+				cfg.UploadQueueSeconds = queue
+			})
+			var active, peak atomic.Int32
+			gate := make(chan struct{})
+			var busy, done atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < uploads; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					src := &countingReader{r: strings.NewReader("data"), active: &active, peak: &peak, gate: gate}
+					_, err := s.UploadFile("ssd", fmt.Sprintf("f%d.txt", i), src, 4, ConflictOverwrite, "")
+					switch {
+					case errors.Is(err, ErrUploadBusy):
+						busy.Add(1)
+					case err != nil:
+						t.Error(err)
+					default:
+						done.Add(1)
+					}
+				}()
+			}
+			// Let the first uploads fill every slot before any finishes
+			deadline := time.Now().Add(5 * time.Second)
+			for active.Load() < limit && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if queue == 0 {
+				for busy.Load() < uploads-limit && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			close(gate)
+			wg.Wait()
+
+			if p := peak.Load(); p > limit {
+				t.Errorf("%d uploads ran at once, limit is %d", p, limit)
+			}
+			want := int32(uploads)
+			if queue == 0 {
+				want = limit
+			}
+			if done.Load() != want || busy.Load() != uploads-want {
+				t.Errorf("%d uploads done and %d busy, want %d and %d", done.Load(), busy.Load(), want, uploads-want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Storages are watched (inotify on Linux, one watch per folder) so files
+// added, changed or removed outside the API reach the index within seconds
+// instead of at the next scan. Events only mark paths; WATCH_DEBOUNCE_MS
+// after the last one (or at the latest watchMaxDelay times that, during a
+// steady stream like a large copy) the marked paths are rescanned in one
+// transaction. A watcher that fails is dropped after one catch-up scan, and
+// the storage is left to the periodic scans.
+
+// Upper bound of the debounce delay, in multiples of WATCH_DEBOUNCE_MS
+const watchMaxDelay = 10
+
+// startWatching watches a storage unless WATCH_ENABLED is off
+func (s *FilesystemService) startWatching(storage string) {
+	if !s.cfg.WatchEnabled {
+		return
+	}
+	rootPath, err := s.driver.GetRealPath(storage, "")
+	if err != nil {
+		return
+	}
+	go s.watchStorage(storage, rootPath)
+}
+
+// stopWatching closes a storage's watcher, if it has one
+func (s *FilesystemService) stopWatching(storage string) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if w, ok := s.watchers[strings.ToLower(storage)]; ok {
+		w.Close()
+		delete(s.watchers, strings.ToLower(storage))
+	}
+}
+
+// watching reports whether a storage has a live watcher
+func (s *FilesystemService) watching(storage string) bool {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	_, ok := s.watchers[strings.ToLower(storage)]
+	return ok
+}
+
+// watchStorage watches rootPath and every indexed folder below it until the
+// watcher is closed or fails
+func (s *FilesystemService) watchStorage(storage, rootPath string) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("Watcher for %s unavailable, relying on periodic scans: %v\n", storage, err)
+		return
+	}
+	if err := s.addWatches(w, storage, ""); err != nil {
+		w.Close()
+		fmt.Printf("Watcher for %s unavailable, relying on periodic scans: %v\n", storage, err)
+		return
+	}
+
+	key := strings.ToLower(storage)
+	s.watchMu.Lock()
+	if old, ok := s.watchers[key]; ok {
+		old.Close()
+	}
+	s.watchers[key] = w
+	s.watchMu.Unlock()
+	defer func() {
+		s.watchMu.Lock()
+		if s.watchers[key] == w {
+			delete(s.watchers, key)
+		}
+		s.watchMu.Unlock()
+	}()
+	fmt.Printf("Watching %s for changes\n", storage)
+
+	debounce := time.Duration(s.cfg.WatchDebounceMs) * time.Millisecond
+	pending := make(map[string]bool)
+	var first time.Time
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return // closed by stopWatching
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			rel, err := filepath.Rel(rootPath, event.Name)
+			if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			// New folders need watches of their own; files already in them
+			// are covered by the rescan of the folder
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() && s.driver.Indexable(storage, rel, true) {
+					if err := s.addWatches(w, storage, rel); err != nil {
+						fmt.Printf("Watcher for %s failed, relying on periodic scans: %v\n", storage, err)
+						w.Close()
+						go s.indexStorage(storage, false)
+						return
+					}
+				}
+			}
+			if len(pending) == 0 {
+				first = time.Now()
+			}
+			pending[rel] = true
+			timer.Reset(min(debounce, time.Until(first.Add(watchMaxDelay*debounce))))
+
+		case <-timer.C:
+			s.applyWatchEvents(storage, pending)
+			pending = make(map[string]bool)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			// Typically a queue overflow: events were lost, so catch up once
+			fmt.Printf("Watcher for %s failed, relying on periodic scans: %v\n", storage, err)
+			w.Close()
+			go s.indexStorage(storage, false)
+			return
+		}
+	}
+}
+
+// addWatches watches a folder and every indexed folder below it
+func (s *FilesystemService) addWatches(w *fsnotify.Watcher, storage, rel string) error {
+	dirs, err := s.driver.IndexedFolders(storage, rel)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// applyWatchEvents rescans the changed paths. Paths below another changed
+// folder are left to that folder's rescan.
+func (s *FilesystemService) applyWatchEvents(storage string, pending map[string]bool) {
+	var paths []string
+	for p := range pending {
+		covered := false
+		for dir := indexParent(p); dir != ""; dir = indexParent(dir) {
+			if pending[dir] {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+		// Gone paths always go through, to drop their rows
+		if realPath, err := s.driver.GetRealPath(storage, p); err == nil {
+			if info, err := os.Lstat(realPath); err == nil && !s.driver.Indexable(storage, p, info.IsDir()) {
+				continue
+			}
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	s.indexUpserts(storage, paths, nil)
+	s.invalidateStorage(storage)
+}
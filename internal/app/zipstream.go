@@ -0,0 +1,226 @@
+package app
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Streaming ZIP builder for downloads. zip.Writer must be fed one entry at a
+// time, so source files are read ahead by a few goroutines into small
+// per-file chunk queues and the writer drains them strictly in order. Memory
+// stays bounded by zipReadAhead * zipChunksPerFile * zipChunkSize whatever
+// the archive size, and the output is flushed after every entry so the
+// client sees progress.
+
+const (
+	zipReadAhead     = 4          // source files read concurrently
+	zipChunksPerFile = 4          // queued chunks per file before its reader waits
+	zipChunkSize     = 256 * 1024 // bytes per chunk
+)
+
+// ZipCompression chooses how entries are stored
+type ZipCompression string
+
+const (
+	ZipStore   ZipCompression = "store"   // no compression, cheapest on CPU
+	ZipDeflate ZipCompression = "deflate" // compress everything
+	// Deflate except formats that are already compressed (media, archives)
+	ZipAuto ZipCompression = "auto"
+)
+
+// ErrInvalidCompression is returned for an unknown compression parameter
+var ErrInvalidCompression = errors.New("invalid_compression")
+
+// ParseZipCompression reads the compression parameter ("" = auto)
+func ParseZipCompression(value string) (ZipCompression, error) {
+	switch c := ZipCompression(strings.ToLower(value)); c {
+	case "":
+		return ZipAuto, nil
+	case ZipStore, ZipDeflate, ZipAuto:
+		return c, nil
+	}
+	return "", fmt.Errorf("%w: use store, deflate or auto", ErrInvalidCompression)
+}
+
+// precompressedExts are stored as-is in auto mode: deflating them costs CPU
+// and saves next to nothing
+var precompressedExts = extensionSet([]string{
+	"jpg", "jpeg", "png", "gif", "webp", "heic", "avif",
+	"mp4", "m4v", "mkv", "webm", "mov", "avi",
+	"mp3", "m4a", "aac", "ogg", "oga", "opus", "flac",
+	"zip", "rar", "7z", "gz", "tgz", "bz2", "xz", "zst",
+	"pdf", "docx", "xlsx", "pptx",
+})
+
+func (c ZipCompression) method(name string) uint16 {
+	switch c {
+	case ZipStore:
+		return zip.Store
+	case ZipAuto:
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if precompressedExts[ext] {
+			return zip.Store
+		}
+	}
+	return zip.Deflate
+}
+
+// zipSource is one archive member: a file or folder on disk and its
+// slash-separated name inside the archive
+type zipSource struct {
+	name     string
+	fullPath string
+	info     os.FileInfo
+}
+
+type zipChunk struct {
+	data []byte
+	err  error
+}
+
+var zipChunkPool = sync.Pool{New: func() any { return make([]byte, zipChunkSize) }}
+
+// flusher is implemented by buffered response writers
+type flusher interface {
+	Flush() error
+}
+
+// ZipFolder streams a folder as a ZIP to w. Entries keep their paths
+// relative to the folder, under a top-level folder of the same name; hidden
+// entries are left out unless showHidden. Nothing is buffered beyond the
+// read-ahead chunks, so w sees data as soon as the first file is read.
+func (s *FilesystemService) ZipFolder(storage, path string, w io.Writer, showHidden bool, compression ZipCompression) error {
+	top := filepath.Base(filepath.Clean("/" + path))
+	if top == "/" {
+		top = storage
+	}
+	var sources []zipSource
+	err := s.driver.WalkTree(storage, path, showHidden, func(rel, fullPath string, info os.FileInfo) error {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil // sockets, devices, fifos
+		}
+		sources = append(sources, zipSource{
+			name:     top + "/" + filepath.ToSlash(rel),
+			fullPath: fullPath,
+			info:     info,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeZipStream(w, sources, compression)
+}
+
+// writeZipStream writes sources to w as a ZIP in the given order
+func writeZipStream(w io.Writer, sources []zipSource, compression ZipCompression) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	// One queue per source, filled by the read-ahead goroutines. They are
+	// started in order, so the entry being written always has its reader.
+	queues := make([]chan zipChunk, len(sources))
+	for i := range queues {
+		queues[i] = make(chan zipChunk, zipChunksPerFile)
+	}
+	go func() {
+		slots := make(chan struct{}, zipReadAhead)
+		for i, src := range sources {
+			if src.info.IsDir() {
+				close(queues[i])
+				continue
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(src zipSource, queue chan<- zipChunk) {
+				defer func() { <-slots }()
+				readZipSource(src, queue, done)
+			}(src, queues[i])
+		}
+	}()
+
+	zw := zip.NewWriter(w)
+	for i, src := range sources {
+		header, err := zip.FileInfoHeader(src.info)
+		if err != nil {
+			return err
+		}
+		header.Name = src.name
+		if src.info.IsDir() {
+			header.Name += "/"
+			header.Method = zip.Store
+		} else {
+			header.Method = compression.method(src.name)
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		for chunk := range queues[i] {
+			if chunk.err != nil {
+				return fmt.Errorf("%s: %w", src.name, chunk.err)
+			}
+			_, err := entry.Write(chunk.data)
+			zipChunkPool.Put(chunk.data[:zipChunkSize])
+			if err != nil {
+				return err
+			}
+		}
+		if err := zw.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// readZipSource feeds one file's content into its queue in chunks and
+// closes it; it gives up as soon as the writer is gone
+func readZipSource(src zipSource, queue chan<- zipChunk, done <-chan struct{}) {
+	defer close(queue)
+	send := func(chunk zipChunk) bool {
+		select {
+		case queue <- chunk:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	f, err := os.Open(src.fullPath)
+	if err != nil {
+		send(zipChunk{err: err})
+		return
+	}
+	defer f.Close()
+	for {
+		buf := zipChunkPool.Get().([]byte)
+		n, err := io.ReadFull(f, buf)
+		if n > 0 && !send(zipChunk{data: buf[:n]}) {
+			return
+		}
+		if n == 0 {
+			zipChunkPool.Put(buf)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		if err != nil {
+			send(zipChunk{err: err})
+			return
+		}
+	}
+}
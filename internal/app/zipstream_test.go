@@ -0,0 +1,107 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zipFixture writes n files of size bytes under a temp folder and returns
+// them as archive sources
+func zipFixture(tb testing.TB, n, size int) []zipSource {
+	tb.Helper()
+	dir := tb.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+	sources := make([]zipSource, 0, n)
+	for i := 0; i < n; i++ {
+		full := filepath.Join(dir, fmt.Sprintf("f%05d.txt", i))
+		if err := os.WriteFile(full, content, 0644); err != nil {
+			tb.Fatal(err)
+		}
+		info, err := os.Stat(full)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		sources = append(sources, zipSource{name: "top/" + info.Name(), fullPath: full, info: info})
+	}
+	return sources
+}
+
+// writeZipSequential is the naive builder: open, copy and close each file
+// in turn on the writer's goroutine
+func writeZipSequential(w io.Writer, sources []zipSource, compression ZipCompression) error {
+	zw := zip.NewWriter(w)
+	for _, src := range sources {
+		header, err := zip.FileInfoHeader(src.info)
+		if err != nil {
+			return err
+		}
+		header.Name = src.name
+		header.Method = compression.method(src.name)
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(src.fullPath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func TestWriteZipStreamKeepsOrderAndContent(t *testing.T) {
+	sources := zipFixture(t, 20, zipChunkSize+100) // every file spans two chunks
+	var buf bytes.Buffer
+	if err := writeZipStream(&buf, sources, ZipDeflate); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != len(sources) {
+		t.Fatalf("%d entries, want %d", len(zr.File), len(sources))
+	}
+	for i, f := range zr.File {
+		if f.Name != sources[i].name {
+			t.Errorf("entry %d is %s, want %s", i, f.Name, sources[i].name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		want, _ := os.ReadFile(sources[i].fullPath)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content differs", f.Name)
+		}
+	}
+}
+
+func BenchmarkWriteZipStream(b *testing.B) {
+	sources := zipFixture(b, 2000, 4096)
+	builders := map[string]func(io.Writer, []zipSource, ZipCompression) error{
+		"readahead":  writeZipStream,
+		"sequential": writeZipSequential,
+	}
+	for _, name := range []string{"readahead", "sequential"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := builders[name](io.Discard, sources, ZipStore); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,196 @@
 package config
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port          string
-	StorageMounts map[string]string // name -> path
-	Password      string
-	JwtSecret     string
+	Port string
+	// Unix socket path; when set it replaces the TCP listener
+	ListenSocket     string
+	ListenSocketMode os.FileMode
+	StorageMounts    map[string]string // name -> path
+	// JSON file holding runtime mount changes; when present it replaces
+	// STORAGE_MOUNTS (empty = runtime changes are not persisted)
+	MountsFile string
+	// Refuse to start when Validate finds problems instead of only warning
+	StrictConfig bool
+	// Per-storage options, read from STORAGE_<NAME>_* variables
+	StorageOptions map[string]StorageOptions
+	JwtSecret      string
+	// bcrypt hash of the admin password (PASSWORD_HASH, or PASSWORD hashed at startup)
+	PasswordHash []byte
+	// Same across restarts for as long as the admin password is; refresh
+	// tokens are bound to it (PASSWORD_HASH, or a SHA-256 of PASSWORD)
+	AdminPasswordID string
+	// Non-admin logins from USERS_FILE and USERS, keyed by username
+	Users *UserStore
+	// Lifetime of login JWTs and of the refresh tokens that renew them
+	TokenTTLHours        int
+	RefreshTokenTTLHours int
+	// Static read-only bearer token for public galleries (empty = disabled),
+	// limited to GuestStorages (empty = all)
+	GuestToken    string
+	GuestStorages []string
+	// Accept ?token= on GET requests without an Authorization header
+	QueryTokenEnabled bool
+
+	// Route groups that are not mounted at all (DISABLED_ENDPOINTS)
+	DisabledEndpoints map[string]bool
+
+	// Log only requests slower than this many ms (0 = log every request)
+	SlowRequestMs int
+
+	// Always send Server-Timing (otherwise only for ?trace=true)
+	ServerTimingEnabled bool
+
+	// Detect mount points via /proc/self/mountinfo (Linux) instead of
+	// comparing device IDs with the parent folder
+	MountInfoEnabled bool
+
+	// Category -> extensions overrides from CATEGORY_<NAME> variables;
+	// an empty list removes a built-in category
+	Categories map[string][]string
+
+	// Units for ?human=true sizes: KiB/MiB (binary) or KB/MB (decimal)
+	SizeUnitsBinary bool
+
+	// Refuse client paths ending in "/" instead of dropping the slash
+	// (PATH_TRAILING_SLASH=reject; default strip)
+	RejectTrailingSlash bool
+
+	// Hand file transfers to nginx via X-Accel-Redirect to this internal
+	// location prefix (empty = stream from Go)
+	AccelRedirectPrefix string
+
+	// Permissions for uploaded files and for folders created by uploads/mkdir
+	// (0 = defaults: 0666 files, 0755 folders, minus the umask)
+	UploadFileMode os.FileMode
+	UploadDirMode  os.FileMode
+	// Uploads, copies and extractions that would leave less than this share
+	// of the disk free are refused with 507
+	MinFreeSpacePercent int
+
+	// Name/path limits checked before writes (bytes; 0 = no check)
+	MaxNameBytes int
+	MaxPathBytes int
+
+	// Time budget for searches of a not-yet-indexed storage, which walk the
+	// disk; results found so far are returned as partial (0 = no budget)
+	LiveSearchBudgetMs int
+
+	// Requests per minute and user (per IP for guests) to the heavy
+	// endpoints; 0 = unlimited
+	RateReindexPerMin int
+	RateSearchPerMin  int
+	RateStatsPerMin   int
+
+	// Hard cap on entries returned by a single directory listing (0 = unlimited)
+	ListMaxEntries int
+	// Take folder item counts in listings from the index when still current
+	ListCountsFromIndex bool
+
+	// Upload concurrency: max in-flight uploads (0 = unlimited) and how long
+	// an upload may wait for a free slot before being rejected (0 = reject immediately)
+	UploadMaxConcurrent int
+	UploadQueueSeconds  int
+	// Chunked uploads: where parts are kept until completion, and how long
+	// an untouched session lives before it is swept
+	UploadChunkDir      string
+	UploadChunkTTLHours int
+	// Largest file a chunked upload may assemble, also the cap on the chunks
+	// kept for an upload without a declared size (0 = unlimited)
+	UploadChunkedMaxBytes int64
+
+	// Remote fetch (POST /api/fetch)
+	FetchMaxBytes       int64
+	FetchTimeoutSeconds int
+	FetchAllowPrivate   bool     // allow loopback/private/link-local targets
+	FetchAllowedHosts   []string // if set, only these hosts (and subdomains)
+	FetchDeniedHosts    []string
+
+	// Content hashing during indexing (enables instant duplicate search)
+	IndexHashEnabled  bool
+	IndexHashMaxBytes int64
+	// Default algorithm for /api/checksum when none is requested
+	ChecksumAlgorithm string
+
+	// VACUUM/ANALYZE the index every N hours (0 = only via POST /api/index/optimize)
+	IndexOptimizeHours int
+	// Spot-check DriftSampleSize random index rows per storage against the
+	// disk every N minutes (0 = off)
+	DriftCheckMinutes int
+	DriftSampleSize   int
+	// Watch storages for changes made outside the API; events are applied
+	// WatchDebounceMs after the last one
+	WatchEnabled    bool
+	WatchDebounceMs int
+	// SQLite index file (":memory:" = in-memory, lost on exit)
+	IndexDBPath string
+	// Background indexer: full pass every IndexIntervalMinutes; off skips the
+	// scans, watchers and drift checks (listings still work, search finds nothing new)
+	IndexEnabled         bool
+	IndexIntervalMinutes int
+	// Concurrent lstat calls per folder listing
+	ReadDirWorkers int
+
+	// External media tools, looked up in PATH at startup
+	FFmpegPath  string
+	FFprobePath string
+	// Concurrent ffmpeg/ffprobe runs (0 = unlimited) and their time limit
+	MediaMaxConcurrent  int
+	MediaTimeoutSeconds int
+
+	// Count hard-linked files once in sizes, duplicates and stats
+	HardlinkDedup bool
+
+	// Largest file GET /api/dataurl will inline
+	DataURLMaxBytes int64
+	// Decompressed size cap for a single archive entry (zip bomb guard)
+	ArchiveEntryMaxBytes int64
+	// Total decompressed bytes POST /api/extract may write from one archive
+	ExtractMaxBytes int64
+
+	// Inline preview policy (GET /api/preview)
+	PreviewImageInlineMaxBytes int64 // larger images get a thumbnail (0 = always inline)
+	PreviewThumbMaxPixels      int   // longest edge of generated image thumbnails
+	PreviewTextMaxLines        int   // text previews are cut after N lines (0 = whole file)
+	// Pre-generated thumbnail names tried before generating one, relative to
+	// the file's folder with {name} (file name) and {stem} (without extension)
+	PreviewSidecars []string
+	// Generated thumbnails and posters are kept here; the least recently used
+	// are deleted once the folder passes ThumbCacheMaxBytes (0 = no cap)
+	ThumbCacheDir      string
+	ThumbCacheMaxBytes int64
+}
+
+// StorageOptions holds optional per-mount settings. The mount name stays the
+// API identifier; these only change presentation and behavior.
+type StorageOptions struct {
+	Label string // display name, defaults to the mount name
+	// Writes are only allowed below these prefixes ("drop box" mounts).
+	// Empty means the whole storage is writable.
+	WritePrefixes []string
+	// Replaces the global hidden-name pattern for this storage (empty = global)
+	HiddenRegex string
+	// Whether code/project files are kept out of the index (nil = global default, on)
+	JunkFilter *bool
+	// Included in storage=all searches (nil = yes); direct queries always work
+	Searchable *bool
+	// Refuse every write to the storage
+	ReadOnly bool
+}
+
+// IsSearchable reports whether the storage takes part in storage=all searches
+func (o StorageOptions) IsSearchable() bool {
+	return o.Searchable == nil || *o.Searchable
 }
 
 func LoadConfig() *Config {
@@ -21,12 +199,121 @@ func LoadConfig() *Config {
 		log.Println("Warning: .env file not found, using environment variables")
 	}
 
+	mountsFile := getEnv("MOUNTS_FILE", "")
+	mounts := parseStorageMounts(getEnv("STORAGE_MOUNTS", ""))
+	if mountsFile != "" {
+		if saved, err := LoadMounts(mountsFile); err == nil {
+			mounts = saved
+		} else if !os.IsNotExist(err) {
+			log.Printf("Warning: ignoring %s: %v", mountsFile, err)
+		}
+	}
+	// Serving the world-writable /tmp is only a convenience for trying the API out
+	if len(mounts) == 0 && getEnvBool("STORAGE_DEFAULT_TMP", false) {
+		mounts = map[string]string{"default": os.TempDir()}
+	}
+
+	passwordHash, passwordID := adminPassword()
 	return &Config{
-		Port:          getEnv("APP_PORT", "3000"),
-		StorageMounts: parseStorageMounts(getEnv("STORAGE_MOUNTS", "default:/tmp")),
-		Password:      getEnv("PASSWORD", "admin"),
-		JwtSecret:     getEnv("JWT_SECRET", "default_secret"),
+		Port:             getEnv("APP_PORT", "3000"),
+		ListenSocket:     getEnv("LISTEN_SOCKET", ""),
+		ListenSocketMode: getEnvFileMode("LISTEN_SOCKET_MODE", 0660),
+		StorageMounts:    mounts,
+		MountsFile:       mountsFile,
+		StrictConfig:     getEnvBool("STRICT_CONFIG", false),
+		StorageOptions:   loadStorageOptions(mounts),
+		JwtSecret:        getEnv("JWT_SECRET", "default_secret"),
+		PasswordHash:     passwordHash,
+		AdminPasswordID:  passwordID,
+		Users:            loadUsers(getEnv("USERS_FILE", "users.json")),
+		GuestToken:       getEnv("GUEST_TOKEN", ""),
+		GuestStorages:    getEnvList("GUEST_STORAGES"),
+
+		TokenTTLHours:        getEnvInt("TOKEN_TTL_HOURS", 7*24),
+		RefreshTokenTTLHours: getEnvInt("REFRESH_TOKEN_TTL_HOURS", 30*24),
+
+		QueryTokenEnabled: getEnvBool("QUERY_TOKEN_ENABLED", false),
+		DisabledEndpoints: loadDisabledEndpoints(),
+
+		SlowRequestMs:       getEnvInt("SLOW_REQUEST_MS", 0),
+		ServerTimingEnabled: getEnvBool("SERVER_TIMING", false),
+
+		MountInfoEnabled: !strings.EqualFold(getEnv("MOUNT_DETECTION", "mountinfo"), "device"),
+
+		Categories: loadCategories(),
+
+		SizeUnitsBinary: !strings.EqualFold(getEnv("SIZE_UNITS", "binary"), "decimal"),
+
+		RejectTrailingSlash: strings.EqualFold(getEnv("PATH_TRAILING_SLASH", "strip"), "reject"),
+
+		AccelRedirectPrefix: getEnv("ACCEL_REDIRECT_PREFIX", ""),
+
+		UploadFileMode:      getEnvFileMode("UPLOAD_FILE_MODE", 0),
+		UploadDirMode:       getEnvFileMode("UPLOAD_DIR_MODE", 0),
+		MinFreeSpacePercent: getEnvIntBetween("MIN_FREE_SPACE_PERCENT", 1, 0, 99),
+		MaxNameBytes:        getEnvInt("MAX_NAME_BYTES", 255),
+		MaxPathBytes:        getEnvInt("MAX_PATH_BYTES", 4095),
+
+		LiveSearchBudgetMs:  getEnvInt("LIVE_SEARCH_BUDGET_MS", 3000),
+		RateReindexPerMin:   getEnvInt("RATE_REINDEX_PER_MIN", 5),
+		RateSearchPerMin:    getEnvInt("RATE_SEARCH_PER_MIN", 240),
+		RateStatsPerMin:     getEnvInt("RATE_STATS_PER_MIN", 30),
+		ListMaxEntries:      getEnvInt("LIST_MAX_ENTRIES", 10000),
+		ListCountsFromIndex: getEnvBool("LIST_COUNTS_FROM_INDEX", false),
+
+		UploadMaxConcurrent:   getEnvInt("UPLOAD_MAX_CONCURRENT", 0),
+		UploadQueueSeconds:    getEnvInt("UPLOAD_QUEUE_SECONDS", 0),
+		UploadChunkDir:        tempSubdir("UPLOAD_CHUNK_DIR", "storages-api-chunks"),
+		UploadChunkTTLHours:   getEnvInt("UPLOAD_CHUNK_TTL_HOURS", 24),
+		UploadChunkedMaxBytes: int64(getEnvInt("UPLOAD_CHUNKED_MAX_MB", 10240)) * 1024 * 1024,
+
+		FetchMaxBytes:       int64(getEnvInt("FETCH_MAX_MB", 1024)) * 1024 * 1024,
+		FetchTimeoutSeconds: getEnvInt("FETCH_TIMEOUT_SECONDS", 300),
+		FetchAllowPrivate:   getEnvBool("FETCH_ALLOW_PRIVATE", false),
+		FetchAllowedHosts:   getEnvList("FETCH_ALLOWED_HOSTS"),
+		FetchDeniedHosts:    getEnvList("FETCH_DENIED_HOSTS"),
+
+		FFmpegPath:  getEnv("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath: getEnv("FFPROBE_PATH", "ffprobe"),
+
+		MediaMaxConcurrent:  getEnvInt("MEDIA_MAX_CONCURRENT", 2),
+		MediaTimeoutSeconds: getEnvInt("MEDIA_TIMEOUT_SECONDS", 60),
+
+		HardlinkDedup: getEnvBool("HARDLINK_DEDUP", false),
+
+		DataURLMaxBytes:            int64(getEnvInt("DATAURL_MAX_KB", 64)) * 1024,
+		ArchiveEntryMaxBytes:       int64(getEnvInt("ARCHIVE_ENTRY_MAX_MB", 512)) * 1024 * 1024,
+		ExtractMaxBytes:            int64(getEnvInt("EXTRACT_MAX_MB", 10240)) * 1024 * 1024,
+		PreviewImageInlineMaxBytes: int64(getEnvInt("PREVIEW_IMAGE_INLINE_MAX_MB", 0)) * 1024 * 1024,
+		PreviewThumbMaxPixels:      getEnvInt("PREVIEW_THUMB_PX", 512),
+		PreviewTextMaxLines:        getEnvInt("PREVIEW_TEXT_MAX_LINES", 0),
+		PreviewSidecars:            loadSidecarPatterns(),
+		ThumbCacheDir:              tempSubdir("THUMB_CACHE_DIR", "storages-api-thumbs"),
+		ThumbCacheMaxBytes:         int64(getEnvInt("THUMB_CACHE_MAX_MB", 512)) * 1024 * 1024,
+
+		IndexHashEnabled:  getEnvBool("INDEX_HASH_ENABLED", false),
+		IndexHashMaxBytes: int64(getEnvInt("INDEX_HASH_MAX_MB", 512)) * 1024 * 1024,
+
+		IndexOptimizeHours:   getEnvInt("INDEX_OPTIMIZE_HOURS", 0),
+		DriftCheckMinutes:    getEnvInt("DRIFT_CHECK_MINUTES", 10),
+		DriftSampleSize:      getEnvInt("DRIFT_SAMPLE_SIZE", 200),
+		WatchEnabled:         getEnvBool("WATCH_ENABLED", true),
+		WatchDebounceMs:      getEnvInt("WATCH_DEBOUNCE_MS", 2000),
+		IndexDBPath:          getEnv("INDEX_DB_PATH", "storage_index.db"),
+		IndexEnabled:         getEnvBool("INDEX_ENABLED", true),
+		IndexIntervalMinutes: getEnvIntAtLeast("INDEX_INTERVAL_MINUTES", 30, 1),
+		ReadDirWorkers:       getEnvIntAtLeast("READDIR_WORKERS", 16, 1),
+		ChecksumAlgorithm:    getEnv("CHECKSUM_ALGORITHM", "sha256"),
+	}
+}
+
+// tempSubdir reads a folder setting; unset or empty means name inside the
+// system temp dir
+func tempSubdir(key, name string) string {
+	if dir := getEnv(key, ""); dir != "" {
+		return dir
 	}
+	return filepath.Join(os.TempDir(), name)
 }
 
 func getEnv(key, fallback string) string {
@@ -36,6 +323,251 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Warning: invalid integer for %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvIntAtLeast is getEnvInt for settings with a lower bound; smaller
+// values are logged and replaced by the fallback
+func getEnvIntAtLeast(key string, fallback, min int) int {
+	n := getEnvInt(key, fallback)
+	if n < min {
+		log.Printf("Warning: %s=%d is below %d, using %d", key, n, min, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvIntBetween is getEnvInt for settings with a range; values outside
+// min..max are logged and replaced by the fallback
+func getEnvIntBetween(key string, fallback, min, max int) int {
+	n := getEnvInt(key, fallback)
+	if n < min || n > max {
+		log.Printf("Warning: %s=%d is outside %d..%d, using %d", key, n, min, max, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Warning: invalid boolean for %s=%q, using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+// Like getEnvBool, but nil when the variable is unset, empty or invalid
+func getEnvOptionalBool(key string) *bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid boolean for %s=%q, using default", key, value)
+		return nil
+	}
+	return &b
+}
+
+// Parse an octal permission string like "0660"
+func getEnvFileMode(key string, fallback os.FileMode) os.FileMode {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	mode, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+	if err != nil || mode > 07777 {
+		log.Printf("Warning: invalid file mode for %s=%q, using %o", key, value, fallback)
+		return fallback
+	}
+	// Unix setuid/setgid/sticky digits map to os.FileMode flags, not raw bits
+	fm := os.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		fm |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		fm |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		fm |= os.ModeSticky
+	}
+	return fm
+}
+
+// Parse a comma separated list, dropping empty items
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Storage returns the options for a mount (names are case-insensitive)
+func (c *Config) Storage(name string) StorageOptions {
+	for key, opts := range c.StorageOptions {
+		if strings.EqualFold(key, name) {
+			return opts
+		}
+	}
+	return StorageOptions{}
+}
+
+// storageEnvKey builds STORAGE_<NAME>_<KEY>, e.g. "ssd-1" + "LABEL" -> STORAGE_SSD_1_LABEL
+func storageEnvKey(name, key string) string {
+	upper := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+	return "STORAGE_" + upper + "_" + key
+}
+
+func loadStorageOptions(mounts map[string]string) map[string]StorageOptions {
+	options := make(map[string]StorageOptions, len(mounts))
+	for name := range mounts {
+		options[name] = LoadStorageOptions(name)
+	}
+	return options
+}
+
+// LoadStorageOptions reads the STORAGE_<NAME>_* variables of one storage,
+// e.g. for a mount registered at runtime
+func LoadStorageOptions(name string) StorageOptions {
+	return StorageOptions{
+		Label:         getEnv(storageEnvKey(name, "LABEL"), ""),
+		WritePrefixes: getEnvList(storageEnvKey(name, "WRITE_PREFIXES")),
+		HiddenRegex:   getEnv(storageEnvKey(name, "HIDDEN_REGEX"), ""),
+		JunkFilter:    getEnvOptionalBool(storageEnvKey(name, "JUNK_FILTER")),
+		Searchable:    getEnvOptionalBool(storageEnvKey(name, "SEARCHABLE")),
+		ReadOnly:      getEnvBool(storageEnvKey(name, "READ_ONLY"), false),
+	}
+}
+
+// EndpointGroups are the route groups DISABLED_ENDPOINTS can switch off
+var EndpointGroups = []string{"write", "upload", "delete", "search", "reindex"}
+
+// loadDisabledEndpoints reads DISABLED_ENDPOINTS=upload,delete; unknown
+// group names are warned about and ignored
+func loadDisabledEndpoints() map[string]bool {
+	disabled := make(map[string]bool)
+	for _, group := range getEnvList("DISABLED_ENDPOINTS") {
+		group = strings.ToLower(group)
+		known := false
+		for _, g := range EndpointGroups {
+			known = known || g == group
+		}
+		if !known {
+			log.Printf("Warning: DISABLED_ENDPOINTS entry %q ignored, groups are %s", group, strings.Join(EndpointGroups, ", "))
+			continue
+		}
+		disabled[group] = true
+	}
+	return disabled
+}
+
+// EndpointEnabled reports whether a route group should be mounted
+func (c *Config) EndpointEnabled(group string) bool {
+	return !c.DisabledEndpoints[group]
+}
+
+// Sidecar thumbnail names written by common cameras, NAS and file managers
+var defaultSidecarPatterns = []string{".thumbnails/{name}.jpg", "{stem}.thumb.jpg", "{name}.thumb.jpg"}
+
+// loadSidecarPatterns reads PREVIEW_SIDECARS (unset = defaults, empty = off).
+// Patterns must stay inside the file's folder tree and name the file.
+func loadSidecarPatterns() []string {
+	value, ok := os.LookupEnv("PREVIEW_SIDECARS")
+	if !ok {
+		return defaultSidecarPatterns
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if strings.HasPrefix(pattern, "/") || strings.Contains(pattern, "..") ||
+			(!strings.Contains(pattern, "{name}") && !strings.Contains(pattern, "{stem}")) {
+			log.Printf("Warning: PREVIEW_SIDECARS entry %q ignored, it must be relative and contain {name} or {stem}", pattern)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// loadCategories collects CATEGORY_<NAME>=ext1,ext2 variables; the category
+// name is the lower-cased suffix (CATEGORY_RAW_PHOTOS -> "raw_photos")
+func loadCategories() map[string][]string {
+	categories := make(map[string][]string)
+	for _, kv := range os.Environ() {
+		key, _, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, "CATEGORY_") || key == "CATEGORY_" {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, "CATEGORY_"))
+		exts := []string{}
+		for _, ext := range getEnvList(key) {
+			exts = append(exts, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		}
+		categories[name] = exts
+	}
+	return categories
+}
+
+// LoadMounts reads a mounts file written by SaveMounts
+func LoadMounts(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make(map[string]string)
+	if err := json.Unmarshal(data, &mounts); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// SaveMounts atomically replaces the mounts file (empty path disables persistence)
+func SaveMounts(path string, mounts map[string]string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(mounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 // Parse "name1:path1,name2:path2" into a map
 func parseStorageMounts(mountsStr string) map[string]string {
 	mounts := make(map[string]string)
@@ -52,8 +584,10 @@ func parseStorageMounts(mountsStr string) map[string]string {
 			path := strings.TrimSpace(parts[1])
 			if name != "" && path != "" {
 				mounts[name] = path
+				continue
 			}
 		}
+		log.Printf("Warning: ignoring STORAGE_MOUNTS entry %q, expected name:path", pair)
 	}
 
 	return mounts
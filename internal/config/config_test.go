@@ -0,0 +1,12 @@
+package config
+
+import "testing"
+
+func TestGetEnvIntBetween(t *testing.T) {
+	for value, want := range map[string]int{"0": 0, "50": 50, "99": 99, "-5": 1, "100": 1, "250": 1, "x": 1} {
+		t.Setenv("MIN_FREE_SPACE_PERCENT", value)
+		if got := getEnvIntBetween("MIN_FREE_SPACE_PERCENT", 1, 0, 99); got != want {
+			t.Errorf("MIN_FREE_SPACE_PERCENT=%s: got %d, want %d", value, got, want)
+		}
+	}
+}
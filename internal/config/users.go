@@ -0,0 +1,302 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidUsername = errors.New("invalid_username")
+	ErrInvalidPassword = errors.New("invalid_password")
+	// ErrStorageForbidden is returned by CheckAccess for a storage the caller may not use
+	ErrStorageForbidden = errors.New("storage_forbidden")
+	// ErrStorageReadOnly is returned by CheckAccess for writes to a storage the caller may only read
+	ErrStorageReadOnly = errors.New("storage_read_only")
+)
+
+var usernameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// UserAccount is a non-admin login from USERS_FILE or USER_<NAME>_* variables
+type UserAccount struct {
+	// bcrypt hash; plaintext passwords are never kept
+	PasswordHash string `json:"password_hash"`
+	// Storages the user may use; empty means all of them
+	Storages []string `json:"storages,omitempty"`
+	// Storages the user may list and download from but not change. They are
+	// usable even when missing from Storages.
+	ReadOnlyStorages []string `json:"read_only_storages,omitempty"`
+}
+
+func containsFold(list []string, name string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the account may use the named storage
+func (a UserAccount) CanAccess(storage string) bool {
+	return len(a.Storages) == 0 || containsFold(a.Storages, storage) || containsFold(a.ReadOnlyStorages, storage)
+}
+
+// CanWrite reports whether the account may change the named storage
+func (a UserAccount) CanWrite(storage string) bool {
+	return a.CanAccess(storage) && !containsFold(a.ReadOnlyStorages, storage)
+}
+
+// CheckPassword reports whether password matches the account's hash
+func (a UserAccount) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) == nil
+}
+
+// HashPassword returns the bcrypt hash stored for a password
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("%w: password is empty", ErrInvalidPassword)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", fmt.Errorf("%w: password is longer than 72 bytes", ErrInvalidPassword)
+	}
+	return string(hash), err
+}
+
+// dummyHash is compared against for unknown usernames so a failed login takes
+// as long whether or not the user exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// UserStore holds the non-admin logins. Accounts added at runtime are written
+// to the users file, which wins over USERS for the same name.
+type UserStore struct {
+	mu   sync.RWMutex
+	path string
+	file map[string]UserAccount // from/persisted to path
+	env  map[string]UserAccount // from USERS, never written back
+	// Called with the name after Add changed an account
+	onChange func(name string)
+}
+
+// OnChange registers fn to run after Add creates or replaces an account, e.g.
+// to drop the refresh tokens issued for its old password
+func (s *UserStore) OnChange(fn func(name string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// NewUserStore returns a store persisting to path (empty = read-only) that
+// starts with the given accounts as if they came from USERS
+func NewUserStore(path string, accounts map[string]UserAccount) *UserStore {
+	env := make(map[string]UserAccount, len(accounts))
+	for name, a := range accounts {
+		env[name] = a
+	}
+	return &UserStore{path: path, file: make(map[string]UserAccount), env: env}
+}
+
+// Get looks up an account by username
+func (s *UserStore) Get(name string) (UserAccount, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.file[name]; ok {
+		return a, true
+	}
+	a, ok := s.env[name]
+	return a, ok
+}
+
+// Authenticate returns the account when name and password match
+func (s *UserStore) Authenticate(name, password string) (UserAccount, bool) {
+	a, ok := s.Get(name)
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return UserAccount{}, false
+	}
+	return a, a.CheckPassword(password)
+}
+
+// validUsername reports whether name may be used for a non-admin login: only
+// letters, digits, '.', '-' and '_', and not the reserved admin or guest
+func validUsername(name string) bool {
+	return usernameRegex.MatchString(name) && !strings.EqualFold(name, "admin") && !strings.EqualFold(name, "guest")
+}
+
+// Add creates an account, or replaces the password and storages of an
+// existing one, and persists it to the users file. created is false when the
+// name already existed.
+func (s *UserStore) Add(name, password string, storages, readOnlyStorages []string) (created bool, err error) {
+	if !validUsername(name) {
+		return false, fmt.Errorf("%w: use letters, digits, '.', '-' and '_'; admin and guest are reserved", ErrInvalidUsername)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, inFile := s.file[name]
+	_, inEnv := s.env[name]
+
+	users := make(map[string]UserAccount, len(s.file)+1)
+	for k, v := range s.file {
+		users[k] = v
+	}
+	users[name] = UserAccount{PasswordHash: hash, Storages: storages, ReadOnlyStorages: readOnlyStorages}
+	if err := saveUsers(s.path, users); err != nil {
+		return false, fmt.Errorf("persist users: %w", err)
+	}
+	s.file = users
+	if s.onChange != nil {
+		s.onChange(name)
+	}
+	return !inFile && !inEnv, nil
+}
+
+// adminPassword hashes PASSWORD, unless PASSWORD_HASH already holds a bcrypt
+// hash. id changes only when the password does: the hash is salted anew on
+// every start, so for PASSWORD it is a SHA-256 of the password instead.
+func adminPassword() (hash []byte, id string) {
+	if hash := getEnv("PASSWORD_HASH", ""); hash != "" {
+		if _, err := bcrypt.Cost([]byte(hash)); err == nil {
+			return []byte(hash), hash
+		}
+		// Falling back to PASSWORD would open the admin account with its
+		// default whenever the hash has a typo
+		log.Fatalf("PASSWORD_HASH is set but is not a bcrypt hash")
+	}
+	password := getEnv("PASSWORD", "admin")
+	hashed, err := HashPassword(password)
+	if err != nil {
+		log.Fatalf("PASSWORD: %v", err)
+	}
+	sum := sha256.Sum256([]byte(password))
+	return []byte(hashed), hex.EncodeToString(sum[:])
+}
+
+// userEnvKey builds USER_<NAME>_<KEY> the same way as storageEnvKey
+func userEnvKey(name, key string) string {
+	return "USER_" + strings.TrimPrefix(storageEnvKey(name, key), "STORAGE_")
+}
+
+// loadUsers reads the users file plus USERS=alice,bob with USER_<NAME>_PASSWORD
+// (or a bcrypt USER_<NAME>_PASSWORD_HASH) and the optional USER_<NAME>_STORAGES
+// and USER_<NAME>_READ_ONLY_STORAGES lists. Plaintext passwords are hashed
+// here; users without one are skipped.
+func loadUsers(path string) *UserStore {
+	store := NewUserStore(path, nil)
+	for _, name := range getEnvList("USERS") {
+		if !validUsername(name) {
+			log.Printf("Warning: USERS entry %q ignored, the name is invalid or reserved", name)
+			continue
+		}
+		hash := getEnv(userEnvKey(name, "PASSWORD_HASH"), "")
+		if _, err := bcrypt.Cost([]byte(hash)); hash != "" && err != nil {
+			log.Printf("Warning: user %q skipped, %s is not a bcrypt hash", name, userEnvKey(name, "PASSWORD_HASH"))
+			continue
+		}
+		if hash == "" {
+			password := getEnv(userEnvKey(name, "PASSWORD"), "")
+			if password == "" {
+				log.Printf("Warning: user %q has no %s, skipping", name, userEnvKey(name, "PASSWORD"))
+				continue
+			}
+			var err error
+			if hash, err = HashPassword(password); err != nil {
+				log.Printf("Warning: user %q skipped: %v", name, err)
+				continue
+			}
+		}
+		store.env[name] = UserAccount{
+			PasswordHash:     hash,
+			Storages:         getEnvList(userEnvKey(name, "STORAGES")),
+			ReadOnlyStorages: getEnvList(userEnvKey(name, "READ_ONLY_STORAGES")),
+		}
+	}
+
+	if path == "" {
+		return store
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: ignoring %s: %v", path, err)
+		}
+		return store
+	}
+	if err := json.Unmarshal(data, &store.file); err != nil {
+		log.Printf("Warning: ignoring %s: %v", path, err)
+		store.file = make(map[string]UserAccount)
+	}
+	for name := range store.file {
+		if !validUsername(name) {
+			log.Printf("Warning: %s entry %q ignored, the name is invalid or reserved", path, name)
+			delete(store.file, name)
+		}
+	}
+	return store
+}
+
+// saveUsers atomically replaces the users file; it holds password hashes, so
+// only the owner may read it
+func saveUsers(path string, users map[string]UserAccount) error {
+	if path == "" {
+		return errors.New("USERS_FILE is not set")
+	}
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// User looks up a non-admin account by username
+func (c *Config) User(name string) (UserAccount, bool) {
+	return c.Users.Get(name)
+}
+
+// CheckAccess reports whether username may use storage, and change it when
+// write is set. The admin may use everything; the guest token is limited to
+// GUEST_STORAGES and never writes.
+func (c *Config) CheckAccess(username, storage string, write bool) error {
+	var account UserAccount
+	switch username {
+	case "admin":
+		return nil
+	case "guest":
+		account = UserAccount{Storages: c.GuestStorages}
+		if write {
+			return ErrStorageReadOnly
+		}
+	default:
+		a, ok := c.User(username)
+		if !ok {
+			return ErrStorageForbidden
+		}
+		account = a
+	}
+
+	if !account.CanAccess(storage) {
+		return ErrStorageForbidden
+	}
+	if write && !account.CanWrite(storage) {
+		return ErrStorageReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadUsersSkipsInvalidAndReservedNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := `{
+		"alice": {"password_hash": "` + hash + `"},
+		"admin": {"password_hash": "` + hash + `"},
+		"Guest": {"password_hash": "` + hash + `"},
+		"bad name": {"password_hash": "` + hash + `"}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("USERS", "ADMIN,bob")
+	t.Setenv("USER_ADMIN_PASSWORD", "secret")
+	t.Setenv("USER_BOB_PASSWORD", "secret")
+
+	store := loadUsers(path)
+	for name, want := range map[string]bool{"alice": true, "bob": true, "admin": false, "ADMIN": false, "Guest": false, "bad name": false} {
+		if _, ok := store.Get(name); ok != want {
+			t.Errorf("Get(%q) found = %v, want %v", name, ok, want)
+		}
+	}
+}
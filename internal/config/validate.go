@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// Validate reports configuration problems that would leave the API unusable
+// or surprising: no mounts at all, or mount paths that are missing, not
+// folders, or not writable by this process.
+func (c *Config) Validate() []string {
+	if len(c.StorageMounts) == 0 {
+		return []string{"no storage mounts configured: set STORAGE_MOUNTS=name:/path[,name2:/path2] (or STORAGE_DEFAULT_TMP=true to serve the temp dir)"}
+	}
+
+	names := make([]string, 0, len(c.StorageMounts))
+	for name := range c.StorageMounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		path := c.StorageMounts[name]
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("storage %q: %s is not accessible: %v", name, path, err))
+		case !info.IsDir():
+			problems = append(problems, fmt.Sprintf("storage %q: %s is not a folder", name, path))
+		case !writable(path):
+			problems = append(problems, fmt.Sprintf("storage %q: %s is not writable by this process", name, path))
+		}
+	}
+	return problems
+}
+
+// CheckStartup logs the problems Validate finds as warnings. With
+// STRICT_CONFIG any problem is an error, on which main refuses to start.
+func (c *Config) CheckStartup() error {
+	problems := c.Validate()
+	for _, problem := range problems {
+		log.Printf("Warning: config: %s", problem)
+	}
+	if c.StrictConfig && len(problems) > 0 {
+		return fmt.Errorf("STRICT_CONFIG: refusing to start with %d configuration problem(s)", len(problems))
+	}
+	return nil
+}
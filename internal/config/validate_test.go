@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckStartupStrictMode(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		mounts map[string]string
+		ok     bool
+	}{
+		{"no mounts", map[string]string{}, false},
+		{"missing folder", map[string]string{"ssd": filepath.Join(dir, "missing")}, false},
+		{"file instead of folder", map[string]string{"ssd": file}, false},
+		{"one bad among good", map[string]string{"ssd": dir, "hdd": filepath.Join(dir, "missing")}, false},
+		{"good folder", map[string]string{"ssd": dir}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{StorageMounts: tt.mounts, StrictConfig: true}
+			if err := cfg.CheckStartup(); (err == nil) != tt.ok {
+				t.Errorf("strict: err = %v, want ok = %v", err, tt.ok)
+			}
+			if got := len(cfg.Validate()) == 0; got != tt.ok {
+				t.Errorf("Validate() = %v, want ok = %v", cfg.Validate(), tt.ok)
+			}
+			// Without STRICT_CONFIG the same problems are only warnings
+			cfg.StrictConfig = false
+			if err := cfg.CheckStartup(); err != nil {
+				t.Errorf("not strict: err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestDefaultTmpMountIsOptIn(t *testing.T) {
+	t.Setenv("STORAGE_MOUNTS", "")
+	t.Setenv("MOUNTS_FILE", "")
+	t.Setenv("USERS_FILE", filepath.Join(t.TempDir(), "users.json"))
+	t.Setenv("STORAGE_DEFAULT_TMP", "")
+	if mounts := LoadConfig().StorageMounts; len(mounts) != 0 {
+		t.Errorf("mounts without STORAGE_DEFAULT_TMP = %v, want none", mounts)
+	}
+	t.Setenv("STORAGE_DEFAULT_TMP", "true")
+	if mounts := LoadConfig().StorageMounts; mounts["default"] != os.TempDir() || len(mounts) != 1 {
+		t.Errorf("mounts with STORAGE_DEFAULT_TMP = %v, want only default:%s", mounts, os.TempDir())
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package config
+
+// Without access(2) writability is only discovered on the first write
+func writable(path string) bool {
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package config
+
+import "golang.org/x/sys/unix"
+
+// writable asks the kernel, so read-only mounts and permissions both count
+func writable(path string) bool {
+	return unix.Access(path, unix.W_OK) == nil
+}
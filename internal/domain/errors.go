@@ -0,0 +1,72 @@
+package domain
+
+// Stable error codes sent as {"error": {"code": ..., "message": ...}}. Clients
+// should switch on the code; messages are for people and may change.
+const (
+	CodeInvalidRequest       = "INVALID_REQUEST"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodePermissionDenied     = "PERMISSION_DENIED"
+	CodeNotFound             = "NOT_FOUND"
+	CodeStorageNotFound      = "STORAGE_NOT_FOUND"
+	CodePathOutsideRoot      = "PATH_OUTSIDE_ROOT"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeAlreadyExists        = "ALREADY_EXISTS"
+	CodeConflict             = "CONFLICT"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeRateLimited          = "RATE_LIMITED"
+	CodeInternal             = "INTERNAL"
+	CodeBadGateway           = "BAD_GATEWAY"
+	CodeUnavailable          = "UNAVAILABLE"
+	CodeTimeout              = "TIMEOUT"
+	CodeInsufficientStorage  = "INSUFFICIENT_STORAGE"
+)
+
+// statusCodes is the fallback code for errors without a more specific one
+var statusCodes = map[int]string{
+	400: CodeInvalidRequest,
+	401: CodeUnauthorized,
+	403: CodePermissionDenied,
+	404: CodeNotFound,
+	405: CodeMethodNotAllowed,
+	409: CodeConflict,
+	413: CodePayloadTooLarge,
+	415: CodeUnsupportedMediaType,
+	429: CodeRateLimited,
+	502: CodeBadGateway,
+	503: CodeUnavailable,
+	504: CodeTimeout,
+	507: CodeInsufficientStorage,
+}
+
+// APIError is the error object of every error response. Message must be safe
+// to show: no host paths, only storage-relative ones.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewAPIError builds an APIError; an empty code falls back to the generic
+// one for status
+func NewAPIError(status int, code, message string) *APIError {
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// CodeForStatus is the generic code for an HTTP status
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 400 && status < 500 {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
@@ -11,6 +11,17 @@ type FileInfo struct {
 	Extension string    `json:"extension"`
 	ItemCount int       `json:"item_count"`
 	Path      string    `json:"path"`
+	// Viewer hint: image, video, audio, pdf, text, archive, other (empty for folders)
+	PreviewType string `json:"preview_type,omitempty"`
+	// Formatted Size and ModTime relative to now ("3 hours ago"), only with ?human=true
+	SizeHuman    string `json:"size_human,omitempty"`
+	RelativeTime string `json:"relative_time,omitempty"`
+	// Free-text note set via PUT /api/describe
+	Description string `json:"description,omitempty"`
+	// Hard links to the content when there is more than one name for it
+	Links int `json:"links,omitempty"`
+	// "dev:ino" of hard-linked files, so they can be counted once (not exposed)
+	Inode string `json:"-"`
 }
 
 type CreateFolderRequest struct {
@@ -18,12 +29,86 @@ type CreateFolderRequest struct {
 	Path    string `json:"path"`
 }
 
+type CreateFileRequest struct {
+	Storage string `json:"storage"`
+	Path    string `json:"path"`
+}
+
 type RenameRequest struct {
 	Storage string `json:"storage"`
 	OldPath string `json:"old_path"`
 	NewPath string `json:"new_path"`
 }
 
+// ArchiveEntry is one member of a ZIP archive
+type ArchiveEntry struct {
+	Name           string    `json:"name"` // path inside the archive
+	Size           int64     `json:"size"` // uncompressed
+	CompressedSize int64     `json:"compressed_size"`
+	ModTime        time.Time `json:"mod_time"`
+	IsDir          bool      `json:"is_dir"`
+}
+
+// TouchRequest sets the modification time of a file or folder
+type TouchRequest struct {
+	Storage   string     `json:"storage"`
+	Path      string     `json:"path"`
+	ModTime   *time.Time `json:"mod_time"`  // RFC 3339; nil = now
+	Recursive bool       `json:"recursive"` // also everything below a folder
+}
+
+// ExtractRequest unpacks a ZIP archive into a folder
+type ExtractRequest struct {
+	Storage string `json:"storage"`
+	Path    string `json:"path"` // the archive
+	Dest    string `json:"dest"` // target folder, created if missing
+}
+
+// TrashItem is one entry of a storage's trash
+type TrashItem struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"` // where it was deleted from
+	DeletedAt time.Time `json:"deleted_at"`
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`
+}
+
+// TrashRestoreRequest moves a trash entry back to its original path
+type TrashRestoreRequest struct {
+	Storage string `json:"storage"`
+	ID      string `json:"id"`
+}
+
+// SwapRequest exchanges two existing paths
+type SwapRequest struct {
+	Storage string `json:"storage"`
+	PathA   string `json:"path_a"`
+	PathB   string `json:"path_b"`
+}
+
+// OptimizeResult reports an index VACUUM
+type OptimizeResult struct {
+	SizeBefore     int64 `json:"size_before"`
+	SizeAfter      int64 `json:"size_after"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	DurationMs     int64 `json:"duration_ms"`
+}
+
+// PrefetchResult summarizes a cache warm-up
+type PrefetchResult struct {
+	Folders     int  `json:"folders"`      // folders visited
+	Warmed      int  `json:"warmed"`       // read from disk and cached
+	AlreadyWarm int  `json:"already_warm"` // served from the cache
+	Failed      int  `json:"failed"`
+	Truncated   bool `json:"truncated"` // stopped at the folder limit
+}
+
+type DescribeRequest struct {
+	Storage     string `json:"storage"`
+	Path        string `json:"path"`
+	Description string `json:"description"` // empty removes the note
+}
+
 type DeleteRequest struct {
 	Storage string `json:"storage"`
 	Path    string `json:"path"`
@@ -33,13 +118,214 @@ type UploadResponse struct {
 	Success  bool   `json:"success"`
 	Message  string `json:"message"`
 	FilePath string `json:"file_path"`
+	// Bytes written and their hex SHA-256, to compare with the client's copy
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ChunkedUploadInitRequest starts a chunked upload of one file
+type ChunkedUploadInitRequest struct {
+	Storage string `json:"storage"`
+	Path    string `json:"path"` // final file path, including the name
+	Size    int64  `json:"size"` // expected total bytes, checked on complete (0 = unknown)
+}
+
+// ChunkedUploadStatus reports the chunks a chunked upload has received
+type ChunkedUploadStatus struct {
+	ID            string `json:"id"`
+	Storage       string `json:"storage"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	Received      []int  `json:"received"` // chunk indexes, ascending
+	ReceivedBytes int64  `json:"received_bytes"`
+}
+
+type MoveRequest struct {
+	Storage     string   `json:"storage"`
+	Paths       []string `json:"paths"`
+	Destination string   `json:"destination"` // target folder
+	OnConflict  string   `json:"on_conflict"` // rename (default), skip or overwrite
+}
+
+// DeleteBatchRequest deletes several paths of one storage
+type DeleteBatchRequest struct {
+	Storage string   `json:"storage"`
+	Paths   []string `json:"paths"`
+}
+
+// EstimateRequest asks what a copy or move of paths to destination would take
+type EstimateRequest struct {
+	Operation   string   `json:"operation"` // copy or move
+	Storage     string   `json:"storage"`
+	Paths       []string `json:"paths"`
+	Destination string   `json:"destination"`
+}
+
+// EstimateResult is the space and scale of a planned copy or move
+type EstimateResult struct {
+	TotalBytes int64 `json:"total_bytes"` // hard links count once with HARDLINK_DEDUP
+	FileCount  int   `json:"file_count"`
+	// Folders below the sources, not counting the sources themselves
+	FolderCount int `json:"folder_count"`
+	// Bytes the destination filesystem must take: the total for a copy or a
+	// move across filesystems, 0 for a move that is a rename
+	RequiredBytes    int64  `json:"required_bytes"`
+	FreeBytes        uint64 `json:"free_bytes"`
+	WouldExceedSpace bool   `json:"would_exceed_space"`
+}
+
+// BatchResult reports the outcome of one item in a multi-item operation.
+// Err is filled by the service; handlers turn it into Code and Error.
+type BatchResult struct {
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	Success     bool   `json:"success"`
+	Code        string `json:"code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Err         error  `json:"-"`
+}
+
+type FetchRequest struct {
+	Storage string `json:"storage"`
+	Path    string `json:"path"` // destination folder
+	URL     string `json:"url"`
+	Name    string `json:"name"` // optional file name, defaults to the URL's last segment
+	// skip (default), rename or overwrite, as for uploads
+	OnConflict string `json:"on_conflict"`
+}
+
+type FetchResponse struct {
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+	FilePath    string `json:"file_path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+type DuplicateGroup struct {
+	SHA256 string   `json:"sha256"`
+	Size   int64    `json:"size"`
+	Count  int      `json:"count"`
+	Paths  []string `json:"paths"`
+}
+
+type IndexStatus struct {
+	Storage     string     `json:"storage"`
+	Indexed     bool       `json:"indexed"`
+	RowCount    int        `json:"row_count"`
+	LastIndexed *time.Time `json:"last_indexed"`
+	Scanning    bool       `json:"scanning"`
+	Watching    bool       `json:"watching"` // changes on disk are picked up as they happen
+	// Code and message of the last failed scan
+	LastErrorCode string `json:"last_error_code,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErr       error  `json:"-"`
+	// Latest drift check, if one ran
+	Drift *DriftResult `json:"drift,omitempty"`
+}
+
+// DriftResult is one spot check of index rows against the disk
+type DriftResult struct {
+	CheckedAt   time.Time `json:"checked_at"`
+	Checked     int       `json:"checked"`
+	Phantoms    int       `json:"phantoms"`     // rows for missing files, removed
+	Stale       int       `json:"stale"`        // rows with outdated size/mtime, refreshed
+	ChangedDirs int       `json:"changed_dirs"` // folders changed since indexed; left for the next scan
+	Drift       float64   `json:"drift"`        // share of checked rows that were off
+}
+
+// StorageSettings are a storage's effective options: the STORAGE_<NAME>_*
+// defaults with any runtime overrides from PUT /api/storages/:name/settings
+type StorageSettings struct {
+	Label         string   `json:"label"`
+	WritePrefixes []string `json:"write_prefixes"` // empty = whole storage writable
+	HiddenRegex   string   `json:"hidden_regex"`   // empty = global hidden rules
+	JunkFilter    bool     `json:"junk_filter"`
+	Searchable    bool     `json:"searchable"`
+	ReadOnly      bool     `json:"read_only"`
 }
 
 type StorageInfo struct {
-	Name      string `json:"name"`
+	Name      string `json:"name"`  // API identifier used in requests
+	Label     string `json:"label"` // human display name
 	Path      string `json:"path"`
 	TotalSize uint64 `json:"total_size"`
 	UsedSize  uint64 `json:"used_size"`
-	FreeSize  uint64 `json:"free_size"`
-	IsMounted bool   `json:"is_mounted"`
+	FreeSize  uint64 `json:"free_size"` // includes the blocks reserved for root
+	// What a normal user can still write (free_size minus the reserve)
+	AvailableSize uint64 `json:"available_size"`
+	IsMounted     bool   `json:"is_mounted"`
+	FsType        string `json:"fs_type,omitempty"` // from mountinfo (Linux), e.g. ext4, btrfs, overlay
+	// Included in storage=all searches
+	Searchable bool `json:"searchable"`
+
+	// Formatted sizes, only with ?human=true
+	TotalSizeHuman     string `json:"total_size_human,omitempty"`
+	UsedSizeHuman      string `json:"used_size_human,omitempty"`
+	FreeSizeHuman      string `json:"free_size_human,omitempty"`
+	AvailableSizeHuman string `json:"available_size_human,omitempty"`
+
+	// Dominant categories from the index, only with ?with_stats=true
+	Categories []CategoryStat `json:"categories,omitempty"`
+}
+
+// Transaction operation kinds
+const (
+	TxMkdir  = "mkdir"
+	TxMove   = "move"
+	TxCopy   = "copy"
+	TxDelete = "delete"
+)
+
+// TransactionOp is one step of POST /api/transaction. Destination is the
+// full target path for move and copy.
+type TransactionOp struct {
+	Op          string `json:"op"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+}
+
+type TransactionRequest struct {
+	Storage    string          `json:"storage"`
+	Operations []TransactionOp `json:"operations"`
+}
+
+// TransactionStep reports what happened to one operation, including its
+// undo. Err and RollbackErr are filled by the service; handlers turn them
+// into the codes and messages.
+type TransactionStep struct {
+	TransactionOp
+	Applied       bool   `json:"applied"`
+	Code          string `json:"code,omitempty"`
+	Error         string `json:"error,omitempty"`
+	RolledBack    bool   `json:"rolled_back"`
+	RollbackCode  string `json:"rollback_code,omitempty"`
+	RollbackError string `json:"rollback_error,omitempty"`
+	Err           error  `json:"-"`
+	RollbackErr   error  `json:"-"`
+}
+
+type TransactionResult struct {
+	Success bool              `json:"success"`
+	Failed  int               `json:"failed_step"` // index of the failing op, -1 on success
+	Steps   []TransactionStep `json:"steps"`
+}
+
+// ExtensionCount is one row of the uncategorized-extension breakdown
+type ExtensionCount struct {
+	Extension string `json:"extension"`
+	Count     int    `json:"count"`
+}
+
+// AddStorageRequest registers a mount at runtime
+type AddStorageRequest struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// CategoryStat aggregates indexed files of one category
+type CategoryStat struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
 }
@@ -0,0 +1,143 @@
+package domain
+
+import "strings"
+
+// Content types served for known extensions (lowercase, with dot)
+var contentTypes = map[string]string{
+	// Images
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	// Video containers - each reports its own type so browsers pick the right demuxer
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".avi":  "video/x-msvideo",
+	// Audio - players need the exact type to seek within the stream via Range
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	// Documents
+	".pdf": "application/pdf",
+	".txt": "text/plain",
+}
+
+// Preview hints telling clients which viewer to use
+const (
+	PreviewImage   = "image"
+	PreviewVideo   = "video"
+	PreviewAudio   = "audio"
+	PreviewPDF     = "pdf"
+	PreviewText    = "text"
+	PreviewArchive = "archive"
+	PreviewOther   = "other"
+)
+
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".csv": true, ".log": true, ".srt": true,
+	".json": true, ".xml": true, ".yaml": true, ".yml": true, ".ini": true,
+}
+
+var archiveExtensions = map[string]bool{
+	".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true,
+	".tgz": true, ".bz2": true, ".xz": true,
+}
+
+// Accepts "jpg" (index form) as well as ".jpg"
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && ext[0] != '.' {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// ContentTypeFor returns the MIME type for an extension, or application/octet-stream
+func ContentTypeFor(ext string) string {
+	if ct, ok := contentTypes[normalizeExt(ext)]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// PreviewTypeFor classifies a file by extension for the preview handler and listings
+func PreviewTypeFor(ext string) string {
+	ext = normalizeExt(ext)
+	ct := ContentTypeFor(ext)
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		return PreviewImage
+	case strings.HasPrefix(ct, "video/"):
+		return PreviewVideo
+	case strings.HasPrefix(ct, "audio/"):
+		return PreviewAudio
+	case ct == "application/pdf":
+		return PreviewPDF
+	case textExtensions[ext]:
+		return PreviewText
+	case archiveExtensions[ext]:
+		return PreviewArchive
+	}
+	return PreviewOther
+}
+
+// High-level classes for the storage composition breakdown
+const (
+	ClassImage    = "image"
+	ClassVideo    = "video"
+	ClassAudio    = "audio"
+	ClassDocument = "document"
+	ClassArchive  = "archive"
+	ClassCode     = "code"
+	ClassOther    = "other"
+)
+
+// MimeClasses lists every class, in display order
+var MimeClasses = []string{ClassImage, ClassVideo, ClassAudio, ClassDocument, ClassArchive, ClassCode, ClassOther}
+
+// Extensions whose class the served content types don't tell
+var classExtensions = map[string]string{
+	".heic": ClassImage, ".heif": ClassImage, ".avif": ClassImage, ".bmp": ClassImage, ".svg": ClassImage,
+	".tif": ClassImage, ".tiff": ClassImage, ".dng": ClassImage, ".cr2": ClassImage, ".nef": ClassImage, ".arw": ClassImage,
+	".wmv": ClassVideo, ".flv": ClassVideo, ".mpg": ClassVideo, ".mpeg": ClassVideo, ".ts": ClassVideo, ".3gp": ClassVideo,
+	".flac": ClassAudio, ".wav": ClassAudio, ".ogg": ClassAudio, ".m4a": ClassAudio, ".aac": ClassAudio, ".opus": ClassAudio, ".wma": ClassAudio,
+	".pdf": ClassDocument, ".txt": ClassDocument, ".md": ClassDocument, ".doc": ClassDocument, ".docx": ClassDocument,
+	".xls": ClassDocument, ".xlsx": ClassDocument, ".ppt": ClassDocument, ".pptx": ClassDocument, ".odt": ClassDocument,
+	".ods": ClassDocument, ".odp": ClassDocument, ".rtf": ClassDocument, ".csv": ClassDocument, ".epub": ClassDocument,
+	".iso": ClassArchive,
+	".go":  ClassCode, ".py": ClassCode, ".js": ClassCode, ".jsx": ClassCode, ".tsx": ClassCode, ".c": ClassCode,
+	".cpp": ClassCode, ".h": ClassCode, ".hpp": ClassCode, ".cs": ClassCode, ".java": ClassCode, ".kt": ClassCode,
+	".rs": ClassCode, ".rb": ClassCode, ".php": ClassCode, ".swift": ClassCode, ".sh": ClassCode, ".sql": ClassCode,
+	".html": ClassCode, ".css": ClassCode, ".json": ClassCode, ".xml": ClassCode, ".yaml": ClassCode, ".yml": ClassCode,
+	".toml": ClassCode,
+}
+
+// MimeClassFor maps an extension to its composition class
+func MimeClassFor(ext string) string {
+	ext = normalizeExt(ext)
+	if class, ok := classExtensions[ext]; ok {
+		return class
+	}
+	switch PreviewTypeFor(ext) {
+	case PreviewImage:
+		return ClassImage
+	case PreviewVideo:
+		return ClassVideo
+	case PreviewAudio:
+		return ClassAudio
+	case PreviewPDF, PreviewText:
+		return ClassDocument
+	case PreviewArchive:
+		return ClassArchive
+	}
+	return ClassOther
+}
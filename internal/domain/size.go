@@ -0,0 +1,36 @@
+package domain
+
+import "fmt"
+
+var (
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	decimalUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+)
+
+// FormatSize renders a byte count as "1.4 GiB" (binary, base 1024) or
+// "1.5 GB" (decimal, base 1000) with one decimal; plain bytes stay integral.
+func FormatSize(bytes int64, binary bool) string {
+	base, units := 1000.0, decimalUnits
+	if binary {
+		base, units = 1024.0, binaryUnits
+	}
+	if bytes < 0 {
+		return "-" + FormatSize(-bytes, binary)
+	}
+	if float64(bytes) < base {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes)
+	unit := 0
+	for value >= base && unit < len(units)-1 {
+		value /= base
+		unit++
+	}
+	// 1023.96 KiB would print as "1024.0 KiB"; move up a unit instead
+	if value >= base-0.05 && unit < len(units)-1 {
+		value /= base
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
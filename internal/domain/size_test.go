@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes  int64
+		binary bool
+		want   string
+	}{
+		{0, true, "0 B"},
+		{1023, true, "1023 B"},
+		{1024, true, "1.0 KiB"},
+		{1536, true, "1.5 KiB"},
+		{1048524, true, "1023.9 KiB"},
+		{1048575, true, "1.0 MiB"},
+		{1 << 20, true, "1.0 MiB"},
+		{1<<30 - 1, true, "1.0 GiB"},
+		{1 << 30, true, "1.0 GiB"},
+		{1 << 40, true, "1.0 TiB"},
+		{math.MaxInt64, true, "8.0 EiB"},
+		{-1536, true, "-1.5 KiB"},
+		{999, false, "999 B"},
+		{1000, false, "1.0 KB"},
+		{1024, false, "1.0 KB"},
+		{999_940, false, "999.9 KB"},
+		{999_960, false, "1.0 MB"},
+		{1_000_000, false, "1.0 MB"},
+		{1_500_000_000, false, "1.5 GB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.bytes, tt.binary); got != tt.want {
+			t.Errorf("FormatSize(%d, binary=%v) = %q, want %q", tt.bytes, tt.binary, got, tt.want)
+		}
+	}
+}
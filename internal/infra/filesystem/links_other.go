@@ -0,0 +1,16 @@
+//go:build !unix
+
+package filesystem
+
+import "os"
+
+// Without inode numbers hard links can't be told apart; every file counts
+func linkInfo(info os.FileInfo) (inode string, links int) {
+	return "", 0
+}
+
+// Without device ids paths inside one storage are taken to share its
+// filesystem
+func sameDevice(a, b os.FileInfo) bool {
+	return true
+}
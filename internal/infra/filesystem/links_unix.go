@@ -0,0 +1,31 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// linkInfo identifies a regular file's inode ("dev:ino") and its hard link
+// count. Only files with more than one link get an identity; folders and
+// single-link files return "" and their count.
+func linkInfo(info os.FileInfo) (inode string, links int) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() {
+		return "", 0
+	}
+	links = int(st.Nlink)
+	if links > 1 {
+		inode = strconv.FormatUint(uint64(st.Dev), 10) + ":" + strconv.FormatUint(uint64(st.Ino), 10)
+	}
+	return inode, links
+}
+
+// sameDevice reports whether two files are on the same filesystem
+func sameDevice(a, b os.FileInfo) bool {
+	stA, okA := a.Sys().(*syscall.Stat_t)
+	stB, okB := b.Sys().(*syscall.Stat_t)
+	return okA && okB && stA.Dev == stB.Dev
+}
@@ -1,15 +1,22 @@
 package filesystem
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"storages-api/internal/domain"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // Comprehensive hidden/system/junk file filter
@@ -60,23 +67,245 @@ func isProjectJunk(name string) bool {
 	return false
 }
 
+// FilterRules are the effective hidden/junk rules of one storage. The zero
+// value means the global defaults.
+type FilterRules struct {
+	Hidden     *regexp.Regexp // replaces hiddenFileRegex when set
+	SkipJunk   bool           // drop project/code files from the index
+	customJunk bool           // SkipJunk was set explicitly
+}
+
+// NewFilterRules builds storage rules; nil keeps the default for that rule
+func NewFilterRules(hidden *regexp.Regexp, skipJunk *bool) FilterRules {
+	rules := FilterRules{Hidden: hidden}
+	if skipJunk != nil {
+		rules.SkipJunk = *skipJunk
+		rules.customJunk = true
+	}
+	return rules
+}
+
+func (r FilterRules) IsHidden(name string) bool {
+	if r.Hidden == nil {
+		return isHiddenFile(name)
+	}
+	return r.Hidden.MatchString(name)
+}
+
+// listed reports whether ReadDir shows an entry: upload temp files and the
+// root's trash folder never, hidden names only with showHidden
+func (r FilterRules) listed(name string, atRoot, showHidden bool) bool {
+	if IsUploadTemp(name) || (atRoot && name == TrashDir) {
+		return false
+	}
+	return showHidden || !r.IsHidden(name)
+}
+
+func (r FilterRules) IsJunk(name string) bool {
+	if r.customJunk && !r.SkipJunk {
+		return false
+	}
+	return isProjectJunk(name)
+}
+
+// hiddenPath reports whether any component of a root-relative path is hidden
+func (r FilterRules) hiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		if r.IsHidden(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func previewType(name string, isDir bool) string {
+	if isDir {
+		return ""
+	}
+	return domain.PreviewTypeFor(filepath.Ext(name))
+}
+
 type LocalDriver struct {
+	// Mounts can change at runtime (POST/DELETE /api/storages), guarded by mu
+	mu     sync.RWMutex
 	Mounts map[string]string // storage name -> path
+	// Per-storage hidden/junk overrides; storages without an entry use the globals
+	rules map[string]FilterRules
+	// Prefer /proc/self/mountinfo over the device ID heuristic where available
+	useMountInfo bool
+	// Modes for uploaded files and the folders writes create (0 = defaults)
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	// Percent of each filesystem HasSpaceFor keeps free
+	spaceMargin int
+	// Goroutines stat'ing the entries of one listing (0 = 16)
+	readDirWorkers int
+}
+
+// SetWriteModes fixes the permissions of uploaded files and of folders created
+// by uploads and mkdir, independent of the process umask. Zero keeps the
+// defaults (0666 files, 0755 folders, minus the umask).
+func (d *LocalDriver) SetWriteModes(file, dir os.FileMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fileMode = file
+	d.dirMode = dir
+}
+
+// SetSpaceMargin makes HasSpaceFor keep percent of a filesystem free, so
+// writes that would take its last few percent are refused up front
+func (d *LocalDriver) SetSpaceMargin(percent int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.spaceMargin = percent
+}
+
+// SetReadDirWorkers sets how many entries of a folder listing are stat'ed in
+// parallel; more hides HDD/network latency, fewer spares small machines
+func (d *LocalDriver) SetReadDirWorkers(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.readDirWorkers = n
+}
+
+func (d *LocalDriver) workerCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.readDirWorkers < 1 {
+		return 16 // Tuned for HDD latency masking
+	}
+	return d.readDirWorkers
+}
+
+// writeModes returns the configured file and folder modes; 0 means none
+func (d *LocalDriver) writeModes() (os.FileMode, os.FileMode) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.fileMode, d.dirMode
+}
+
+// makeDirs creates dir and its missing parents. With a configured folder mode
+// each folder it creates is chmod'ed, since Mkdir applies the umask.
+func (d *LocalDriver) makeDirs(dir string) error {
+	_, dirMode := d.writeModes()
+	if dirMode == 0 {
+		return os.MkdirAll(dir, 0755)
+	}
+
+	var missing []string
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], dirMode); err != nil {
+			if os.IsExist(err) {
+				continue // created concurrently; leave its mode alone
+			}
+			return err
+		}
+		if err := os.Chmod(missing[i], dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountEntry is the mount containing a storage path
+type mountEntry struct {
+	MountPoint   string
+	FsType       string
+	Source       string
+	IsMountPoint bool // the path itself is the mount point
 }
 
 func NewLocalDriver(mounts map[string]string) *LocalDriver {
-	return &LocalDriver{Mounts: mounts}
+	own := make(map[string]string, len(mounts))
+	for name, path := range mounts {
+		own[name] = path
+	}
+	return &LocalDriver{Mounts: own, rules: make(map[string]FilterRules)}
+}
+
+// SetMountInfo switches mount detection to /proc/self/mountinfo (Linux);
+// elsewhere, or if it can't be read, the device ID heuristic is kept
+func (d *LocalDriver) SetMountInfo(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.useMountInfo = enabled
+}
+
+// SetFilterRules overrides the hidden/junk rules of one storage
+func (d *LocalDriver) SetFilterRules(storageName string, rules FilterRules) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rules[strings.ToLower(storageName)] = rules
+}
+
+// filterRules resolves the effective rules of a storage (case insensitive)
+func (d *LocalDriver) filterRules(storageName string) FilterRules {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.rules[strings.ToLower(storageName)]
+}
+
+// MountsSnapshot returns a copy of the current name -> path mounts
+func (d *LocalDriver) MountsSnapshot() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	mounts := make(map[string]string, len(d.Mounts))
+	for name, path := range d.Mounts {
+		mounts[name] = path
+	}
+	return mounts
+}
+
+// AddMount registers a mount; the caller validates name and path
+func (d *LocalDriver) AddMount(name, path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Mounts[name] = path
+}
+
+// RemoveMount unregisters a mount (case-insensitive) and returns its real name.
+// Nothing on disk is touched.
+func (d *LocalDriver) RemoveMount(storageName string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name := range d.Mounts {
+		if strings.EqualFold(name, storageName) {
+			delete(d.Mounts, name)
+			return name, true
+		}
+	}
+	return "", false
 }
 
 // Resolve storage name to root path (Case Insensitive)
+var (
+	// ErrStorageNotFound is returned for a storage name that isn't mounted
+	ErrStorageNotFound = errors.New("storage_not_found")
+	// ErrPathOutsideRoot is returned for a path that escapes its storage
+	ErrPathOutsideRoot = errors.New("path_outside_root")
+)
+
 func (d *LocalDriver) getStorageRoot(storageName string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	storageName = strings.ToLower(storageName)
 	for name, path := range d.Mounts {
 		if strings.ToLower(name) == storageName {
 			return filepath.Clean(path), nil
 		}
 	}
-	return "", fmt.Errorf("storage '%s' not found", storageName)
+	return "", fmt.Errorf("%w: %s", ErrStorageNotFound, storageName)
 }
 
 // Validate path to ensure it doesn't escape the root
@@ -93,29 +322,62 @@ func (d *LocalDriver) validatePath(storageName, subPath string) (string, error)
 	// Security: Ensure the cleanPath is still within rootPath
 	rel, err := filepath.Rel(rootPath, cleanPath)
 	if err != nil || strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("invalid path: access outside root (rel:%s)", rel)
+		return "", fmt.Errorf("%w: %s", ErrPathOutsideRoot, subPath)
 	}
 
 	return cleanPath, nil
 }
 
+// StorageNames lists mount names without touching the disks
+func (d *LocalDriver) StorageNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	names := make([]string, 0, len(d.Mounts))
+	for name := range d.Mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (d *LocalDriver) ListStorages() []domain.StorageInfo {
-	storages := make([]domain.StorageInfo, 0, len(d.Mounts))
-	for name, path := range d.Mounts {
-		total, used, free := d.getDiskUsage(path)
-		isMounted := d.checkIfMounted(path)
+	mounts := d.MountsSnapshot()
+	storages := make([]domain.StorageInfo, 0, len(mounts))
+	for name, path := range mounts {
+		usage := d.getDiskUsage(path)
+		isMounted, fsType := d.mountStatus(path)
 		storages = append(storages, domain.StorageInfo{
-			Name:      name,
-			Path:      path,
-			TotalSize: total,
-			UsedSize:  used,
-			FreeSize:  free,
-			IsMounted: isMounted,
+			Name:          name,
+			Path:          path,
+			TotalSize:     usage.total,
+			UsedSize:      usage.used,
+			FreeSize:      usage.free,
+			AvailableSize: usage.available,
+			IsMounted:     isMounted,
+			FsType:        fsType,
 		})
 	}
 	return storages
 }
 
+// mountStatus reports whether path is a mount point and, when mountinfo is
+// used, the filesystem type behind it
+func (d *LocalDriver) mountStatus(path string) (bool, string) {
+	d.mu.RLock()
+	useMountInfo := d.useMountInfo
+	d.mu.RUnlock()
+
+	if useMountInfo {
+		if _, err := os.Stat(path); err != nil {
+			return false, ""
+		}
+		if m, err := lookupMount(path); err == nil {
+			return m.IsMountPoint, m.FsType
+		}
+	}
+	return d.checkIfMounted(path), ""
+}
+
 func (d *LocalDriver) checkIfMounted(path string) bool {
 	stat, err := os.Lstat(path)
 	if err != nil {
@@ -132,27 +394,175 @@ func (d *LocalDriver) checkIfMounted(path string) bool {
 	return stat.Sys().(*syscall.Stat_t).Dev != parentStat.Sys().(*syscall.Stat_t).Dev
 }
 
-func (d *LocalDriver) getDiskUsage(path string) (total, used, free uint64) {
+// diskUsage is the space of one filesystem, in bytes
+type diskUsage struct {
+	total     uint64
+	used      uint64 // total - free
+	free      uint64 // includes the blocks reserved for root
+	available uint64 // what an unprivileged user can still write
+}
+
+func statDisk(path string) (diskUsage, error) {
 	var stat syscall.Statfs_t
-	err := syscall.Statfs(path, &stat)
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return diskUsage{}, err
+	}
+	bsize := uint64(stat.Bsize)
+	return diskUsage{
+		total:     stat.Blocks * bsize,
+		used:      (stat.Blocks - stat.Bfree) * bsize,
+		free:      stat.Bfree * bsize,
+		available: stat.Bavail * bsize,
+	}, nil
+}
+
+func (d *LocalDriver) getDiskUsage(path string) diskUsage {
+	usage, err := statDisk(path)
 	if err != nil {
 		fmt.Printf("Error getting disk usage for %s: %v\n", path, err)
-		return 0, 0, 0
 	}
+	return usage
+}
 
-	// Total bytes
-	fmt.Printf("DEBUG: Raw Statfs for %s: Blocks=%d, Bsize=%d\n", path, stat.Blocks, stat.Bsize)
-	total = stat.Blocks * uint64(stat.Bsize)
-	// Free bytes
-	free = stat.Bfree * uint64(stat.Bsize)
-	// Used bytes
-	used = total - free
+// DirUsage is the size of a file or subtree
+type DirUsage struct {
+	Bytes         int64 // a file with several hard links counts once
+	ApparentBytes int64 // every name counts, as a copy would need
+	Files         int   // regular files, by name
+	Folders       int   // below the start path
+}
 
-	return total, used, free
+// DirSize totals the regular files at or below a path without following
+// symlinks. A single file counts as one file of its own size.
+func (d *LocalDriver) DirSize(storageName, subPath string) (DirUsage, error) {
+	var usage DirUsage
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return usage, err
+	}
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != fullPath {
+				usage.Folders++
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil // removed while walking
+		}
+		usage.Files++
+		usage.ApparentBytes += info.Size()
+		if inode, _ := linkInfo(info); inode != "" {
+			if seen[inode] {
+				return nil
+			}
+			seen[inode] = true
+		}
+		usage.Bytes += info.Size()
+		return nil
+	})
+	return usage, err
+}
+
+// linksShown reports a link count only when it is worth showing (> 1)
+func linksShown(links int) int {
+	if links > 1 {
+		return links
+	}
+	return 0
+}
+
+// existingAncestor returns path or its nearest parent that exists, e.g. the
+// folder a not-yet-created copy destination will land in
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// FreeSpace reports the bytes this process can still write to the filesystem
+// a path (or, when it doesn't exist yet, its nearest existing parent) lives
+// on; blocks reserved for root don't count
+func (d *LocalDriver) FreeSpace(storageName, subPath string) (uint64, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return 0, err
+	}
+	return d.getDiskUsage(existingAncestor(fullPath)).available, nil
+}
+
+// HasSpaceFor reports whether bytes more fit on the filesystem subPath (or
+// its nearest existing parent) lives on while leaving the SetSpaceMargin
+// share of it free; a mount nested in the storage is measured on its own
+func (d *LocalDriver) HasSpaceFor(storageName, subPath string, bytes int64) (bool, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return false, err
+	}
+	usage, err := statDisk(existingAncestor(fullPath))
+	if err != nil {
+		return false, err
+	}
+	d.mu.RLock()
+	margin := usage.total / 100 * uint64(d.spaceMargin)
+	d.mu.RUnlock()
+	return bytes <= 0 || usage.available >= uint64(bytes)+margin, nil
+}
+
+// SameDevice reports whether two paths (or their nearest existing parents)
+// are on the same filesystem, i.e. whether a move between them is a rename
+func (d *LocalDriver) SameDevice(storageName, pathA, pathB string) (bool, error) {
+	fullA, err := d.validatePath(storageName, pathA)
+	if err != nil {
+		return false, err
+	}
+	fullB, err := d.validatePath(storageName, pathB)
+	if err != nil {
+		return false, err
+	}
+	statA, err := os.Stat(existingAncestor(fullA))
+	if err != nil {
+		return false, err
+	}
+	statB, err := os.Stat(existingAncestor(fullB))
+	if err != nil {
+		return false, err
+	}
+	return sameDevice(statA, statB), nil
+}
+
+// KnownCount is a directory's child count from an earlier scan, valid while
+// the directory's modification time is unchanged
+type KnownCount struct {
+	Count   int
+	ModTime time.Time
 }
 
 // READ: List directory contents
 func (d *LocalDriver) ReadDir(storageName, subPath string, showHidden bool) ([]domain.FileInfo, error) {
+	return d.ReadDirWithCounts(storageName, subPath, showHidden, "", nil)
+}
+
+// ReadDirWithCounts lists a directory, taking subdirectory item counts from
+// known (keyed by name) when still current instead of reading each one.
+// A non-empty glob (filepath.Match syntax, checked by the caller) keeps only
+// matching names; the rest are skipped before they are stat'ed.
+func (d *LocalDriver) ReadDirWithCounts(storageName, subPath string, showHidden bool, glob string, known map[string]KnownCount) ([]domain.FileInfo, error) {
 	fullPath, err := d.validatePath(storageName, subPath)
 	if err != nil {
 		return nil, err
@@ -163,13 +573,17 @@ func (d *LocalDriver) ReadDir(storageName, subPath string, showHidden bool) ([]d
 		return nil, err
 	}
 
+	rules := d.filterRules(storageName)
+	rootPath, _ := d.getStorageRoot(storageName)
+	atRoot := fullPath == rootPath
+
 	// Parallel processing for file info stats
 	type fileResult struct {
 		info domain.FileInfo
 		err  error
 	}
 
-	maxWorkers := 16 // Tuned for HDD latency masking
+	maxWorkers := d.workerCount()
 	jobs := make(chan os.DirEntry, len(entries))
 	results := make(chan fileResult, len(entries))
 	var wg sync.WaitGroup
@@ -181,13 +595,16 @@ func (d *LocalDriver) ReadDir(storageName, subPath string, showHidden bool) ([]d
 			defer wg.Done()
 			for entry := range jobs {
 				name := entry.Name()
-				// Filter hidden files
-				// Regex: Start with non-alphabetic characters (dots, numbers, symbols, etc)
-				// Unless it's just alphanumeric start, we consider it hidden if showHidden is false
-				if !showHidden && isHiddenFile(name) {
+				if !rules.listed(name, atRoot, showHidden) {
 					results <- fileResult{err: fmt.Errorf("skipped")} // Skip signal
 					continue
 				}
+				if glob != "" {
+					if ok, _ := filepath.Match(glob, name); !ok {
+						results <- fileResult{err: fmt.Errorf("skipped")}
+						continue
+					}
+				}
 
 				info, err := entry.Info()
 				if err != nil {
@@ -199,21 +616,31 @@ func (d *LocalDriver) ReadDir(storageName, subPath string, showHidden bool) ([]d
 				isDir := info.IsDir()
 				itemCount := 0
 				if isDir {
-					// Quick count of immediate children (not recursive)
-					subEntries, _ := os.ReadDir(filepath.Join(fullPath, name))
-					itemCount = len(subEntries)
+					// Adding or removing an entry bumps the folder's mtime,
+					// so a matching mtime means the known count still holds
+					if k, ok := known[name]; ok && k.ModTime.Equal(info.ModTime()) {
+						itemCount = k.Count
+					} else {
+						// Quick count of immediate children (not recursive)
+						subEntries, _ := os.ReadDir(filepath.Join(fullPath, name))
+						itemCount = len(subEntries)
+					}
 				}
 
+				inode, links := linkInfo(info)
 				results <- fileResult{
 					info: domain.FileInfo{
-						Name:      name,
-						Size:      info.Size(),
-						Mode:      info.Mode().String(),
-						ModTime:   info.ModTime(),
-						IsDir:     isDir,
-						Extension: filepath.Ext(name),
-						ItemCount: itemCount,
-						Path:      relPath,
+						Name:        name,
+						Size:        info.Size(),
+						Mode:        info.Mode().String(),
+						ModTime:     info.ModTime(),
+						IsDir:       isDir,
+						Extension:   filepath.Ext(name),
+						ItemCount:   itemCount,
+						Path:        relPath,
+						PreviewType: previewType(name, isDir),
+						Links:       linksShown(links),
+						Inode:       inode,
 					},
 				}
 			}
@@ -243,85 +670,353 @@ func (d *LocalDriver) ReadDir(storageName, subPath string, showHidden bool) ([]d
 	return files, nil
 }
 
+// Exists reports whether a path exists and whether it is a folder, without
+// following a final symlink. A missing path (or one below a file) is not an
+// error; permission errors are.
+func (d *LocalDriver) Exists(storageName, subPath string) (exists, isDir bool, err error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return false, false, err
+	}
+	info, err := os.Lstat(fullPath)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, info.IsDir(), nil
+}
+
+// STAT: Metadata for a single file or folder
+func (d *LocalDriver) Stat(storageName, subPath string) (domain.FileInfo, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return domain.FileInfo{}, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return domain.FileInfo{}, err
+	}
+
+	itemCount := 0
+	if info.IsDir() {
+		// Immediate children only, counting what ReadDir lists by default
+		rules := d.filterRules(storageName)
+		rootPath, _ := d.getStorageRoot(storageName)
+		subEntries, _ := os.ReadDir(fullPath)
+		for _, entry := range subEntries {
+			if rules.listed(entry.Name(), fullPath == rootPath, false) {
+				itemCount++
+			}
+		}
+	}
+
+	inode, links := linkInfo(info)
+	return domain.FileInfo{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		Mode:        info.Mode().String(),
+		ModTime:     info.ModTime(),
+		IsDir:       info.IsDir(),
+		Extension:   filepath.Ext(info.Name()),
+		ItemCount:   itemCount,
+		Path:        subPath,
+		PreviewType: previewType(info.Name(), info.IsDir()),
+		Links:       linksShown(links),
+		Inode:       inode,
+	}, nil
+}
+
+// ItemCount returns a folder's immediate child count, taken before any
+// filtering like the index scan counts it, and its modification time
+func (d *LocalDriver) ItemCount(storageName, subPath string) (int, time.Time, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return len(entries), info.ModTime(), nil
+}
+
 // ReadDirRecursive: Recursive scan for all files (Used by indexer)
 func (d *LocalDriver) ReadDirRecursive(storageName string, showHidden bool) ([]domain.FileInfo, error) {
 	fmt.Printf("SCAN: Starting recursive scan for %s...\n", storageName)
+	return d.ReadDirRecursiveFrom(storageName, "", showHidden)
+}
+
+// ReadDirRecursiveFrom scans a single file or subtree. The start path itself is
+// included (unless it is the storage root) and paths stay relative to the root.
+func (d *LocalDriver) ReadDirRecursiveFrom(storageName, subPath string, showHidden bool) ([]domain.FileInfo, error) {
 	rootPath, err := d.getStorageRoot(storageName)
 	if err != nil {
 		return nil, err
 	}
+	startPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := d.filterRules(storageName)
 
 	var allFiles []domain.FileInfo
-	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	// Immediate children per folder (rel path), counted before any filtering
+	// so item_count matches what a live listing reports
+	childCounts := make(map[string]int)
+	err = filepath.Walk(startPath, func(path string, info os.FileInfo, err error) error {
+		if path == rootPath {
 			return nil
 		}
-		if path == rootPath {
+		rel, _ := filepath.Rel(rootPath, path)
+		if path != startPath {
+			childCounts[filepath.Dir(rel)]++
+		}
+		if err != nil {
 			return nil
 		}
 
 		name := info.Name()
-		rel, _ := filepath.Rel(rootPath, path)
+		if rel == TrashDir {
+			return filepath.SkipDir
+		}
 
 		// Hidden check
-		if !showHidden {
-			parts := strings.Split(rel, string(os.PathSeparator))
-			for _, part := range parts {
-				if isHiddenFile(part) {
-					if info.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
-				}
+		if !showHidden && rules.hiddenPath(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
-		// Filter Project/Code Junk from Index
-		if !info.IsDir() && isProjectJunk(name) {
+		// Filter Project/Code Junk from Index, and unfinished uploads
+		if !info.IsDir() && (rules.IsJunk(name) || IsUploadTemp(name)) {
 			return nil
 		}
 
-		allFiles = append(allFiles, domain.FileInfo{
-			Name:      name,
-			Size:      info.Size(),
-			Mode:      info.Mode().String(),
-			ModTime:   info.ModTime(),
-			IsDir:     info.IsDir(),
-			Extension: filepath.Ext(name),
-			Path:      rel,
-		})
+		allFiles = append(allFiles, scannedFile(rel, info))
 		return nil
 	})
 
+	for i := range allFiles {
+		if allFiles[i].IsDir {
+			allFiles[i].ItemCount = childCounts[allFiles[i].Path]
+		}
+	}
 	return allFiles, err
 }
 
-// SEARCH: Search files recursively with filter and pagination
-func (d *LocalDriver) SearchFiles(storageName string, extensions []string, limit, offset int, showHidden bool) ([]domain.FileInfo, int, error) {
+// scannedFile is the index entry of one walked file or folder
+func scannedFile(rel string, info os.FileInfo) domain.FileInfo {
+	name := info.Name()
+	inode, links := linkInfo(info)
+	return domain.FileInfo{
+		Name:        name,
+		Size:        info.Size(),
+		Mode:        info.Mode().String(),
+		ModTime:     info.ModTime(),
+		IsDir:       info.IsDir(),
+		Extension:   filepath.Ext(name),
+		Path:        rel,
+		PreviewType: previewType(name, info.IsDir()),
+		Links:       linksShown(links),
+		Inode:       inode,
+	}
+}
+
+// ScanChanged walks a storage like ReadDirRecursive, but asks unchanged about
+// every folder first. When it returns true, with the names of the folder's
+// subfolders, the folder itself is not read: only its own entry is returned
+// (ItemCount 0) and the walk continues into the named subfolders. The
+// returned skipped set holds the rel paths of the folders skipped that way,
+// unread those of folders whose listing failed (ItemCount 0, contents
+// possibly incomplete). An unreadable root fails the whole scan.
+func (d *LocalDriver) ScanChanged(storageName string, unchanged func(rel string, modTime time.Time) ([]string, bool)) (files []domain.FileInfo, skipped, unread map[string]bool, err error) {
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rules := d.filterRules(storageName)
+
+	var allFiles []domain.FileInfo
+	skipped = make(map[string]bool)
+	unread = make(map[string]bool)
+
+	var readFolder func(dir, rel string) (int, error)
+	var visit func(fullPath, rel string, info os.FileInfo)
+	// readFolder visits the children of a folder and returns how many there
+	// are, counted before any filtering like ReadDirRecursiveFrom does. The
+	// entries read before a ReadDir error are still visited.
+	readFolder = func(dir, rel string) (int, error) {
+		entries, err := os.ReadDir(dir)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			visit(filepath.Join(dir, entry.Name()), filepath.Join(rel, entry.Name()), info)
+		}
+		return len(entries), err
+	}
+	visit = func(fullPath, rel string, info os.FileInfo) {
+		if rel == TrashDir || rules.hiddenPath(rel) {
+			return
+		}
+		if !info.IsDir() {
+			if !rules.IsJunk(info.Name()) && !IsUploadTemp(info.Name()) {
+				allFiles = append(allFiles, scannedFile(rel, info))
+			}
+			return
+		}
+
+		i := len(allFiles)
+		allFiles = append(allFiles, scannedFile(rel, info))
+		if subdirs, ok := unchanged(rel, info.ModTime()); ok {
+			skipped[rel] = true
+			for _, name := range subdirs {
+				if sub, err := os.Lstat(filepath.Join(fullPath, name)); err == nil && sub.IsDir() {
+					visit(filepath.Join(fullPath, name), filepath.Join(rel, name), sub)
+				}
+			}
+			return
+		}
+		count, err := readFolder(fullPath, rel)
+		if err != nil {
+			unread[rel] = true
+			return
+		}
+		allFiles[i].ItemCount = count
+	}
+
+	if _, err := readFolder(rootPath, ""); err != nil {
+		return nil, nil, nil, err
+	}
+	return allFiles, skipped, unread, nil
+}
+
+// WalkTree calls fn for every file and folder below subPath (not subPath
+// itself), with rel relative to subPath. Hidden entries are skipped unless
+// showHidden, and so are symlinks, upload temp files and the trash.
+func (d *LocalDriver) WalkTree(storageName, subPath string, showHidden bool, fn func(rel, fullPath string, info os.FileInfo) error) error {
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return err
+	}
+	startPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return err
+	}
+	rules := d.filterRules(storageName)
+	trashPath := filepath.Join(rootPath, TrashDir)
+
+	return filepath.Walk(startPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == startPath {
+			return nil
+		}
+		if info.IsDir() && path == trashPath {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(startPath, path)
+		if !showHidden && rules.hiddenPath(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 || IsUploadTemp(info.Name()) {
+			return nil
+		}
+		return fn(rel, path, info)
+	})
+}
+
+// IndexedFolders returns the full paths of subPath and of every folder below
+// it that a scan would index. Folders that can't be read are skipped.
+func (d *LocalDriver) IndexedFolders(storageName, subPath string) ([]string, error) {
 	rootPath, err := d.getStorageRoot(storageName)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	startPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return nil, err
+	}
+	rules := d.filterRules(storageName)
+
+	var dirs []string
+	err = filepath.WalkDir(startPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == startPath {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if rel, _ := filepath.Rel(rootPath, path); rel != "." && (rel == TrashDir || rules.hiddenPath(rel)) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
+
+// Indexable reports whether a scan would index a root-relative path: not in
+// the trash, not hidden, and for files neither junk nor an unfinished upload
+func (d *LocalDriver) Indexable(storageName, rel string, isDir bool) bool {
+	if InTrash(rel) {
+		return false
+	}
+	rules := d.filterRules(storageName)
+	if rules.hiddenPath(rel) {
+		return false
 	}
+	name := filepath.Base(rel)
+	return isDir || (!rules.IsJunk(name) && !IsUploadTemp(name))
+}
 
-	// Prepare map for fast lookup
-	extMap := make(map[string]bool)
-	for _, ext := range extensions {
-		extMap[strings.ToLower(ext)] = true
+// SEARCH: Search files recursively with filter and pagination.
+// match decides which files count (nil = all). A non-zero deadline bounds the
+// walk: once passed, the walk stops and partial reports that results were cut short.
+func (d *LocalDriver) SearchFiles(storageName string, match func(name string, info os.FileInfo) bool, limit, offset int, showHidden bool, deadline time.Time) (results []domain.FileInfo, totalMatches int, partial bool, err error) {
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return nil, 0, false, err
 	}
 
-	var results []domain.FileInfo
-	totalMatches := 0
+	rules := d.filterRules(storageName)
+
 	skipped := 0
+	trashPath := filepath.Join(rootPath, TrashDir)
 
 	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			partial = true
+			return filepath.SkipAll
+		}
 		if err != nil {
 			return nil
 		}
 
-		// 1. Skip Root
+		// 1. Skip Root and the trash
 		if path == rootPath {
 			return nil
 		}
+		if info.IsDir() && path == trashPath {
+			return filepath.SkipDir
+		}
 
 		name := info.Name()
 
@@ -329,29 +1024,24 @@ func (d *LocalDriver) SearchFiles(storageName string, extensions []string, limit
 		if !showHidden {
 			// Check if any part of path is hidden
 			rel, _ := filepath.Rel(rootPath, path)
-			parts := strings.Split(rel, string(os.PathSeparator))
-			for _, part := range parts {
-				if isHiddenFile(part) {
-					if info.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
+			if rules.hiddenPath(rel) {
+				if info.IsDir() {
+					return filepath.SkipDir
 				}
+				return nil
 			}
 		}
 
 		if info.IsDir() {
 			return nil // Continue walking but don't add folders to result
 		}
-
-		// 3. Extension Filter
-		ext := strings.ToLower(filepath.Ext(name))
-		// Remove dot for comparison if needed, but usually Ext keeps dot
-		if len(ext) > 0 && ext[0] == '.' {
-			ext = ext[1:]
+		// Same files the index would hold
+		if IsUploadTemp(name) || rules.IsJunk(name) {
+			return nil
 		}
 
-		if len(extensions) > 0 && !extMap[ext] {
+		// 3. Caller's filter (extensions, dates, name)
+		if match != nil && !match(name, info) {
 			return nil
 		}
 
@@ -384,13 +1074,14 @@ func (d *LocalDriver) SearchFiles(storageName string, extensions []string, limit
 		relPath = filepath.ToSlash(relPath)
 
 		results = append(results, domain.FileInfo{
-			Name:      name,
-			Size:      info.Size(),
-			Mode:      info.Mode().String(),
-			ModTime:   info.ModTime(),
-			IsDir:     false,
-			Extension: filepath.Ext(name),
-			Path:      relPath,
+			Name:        name,
+			Size:        info.Size(),
+			Mode:        info.Mode().String(),
+			ModTime:     info.ModTime(),
+			IsDir:       false,
+			Extension:   filepath.Ext(name),
+			Path:        relPath,
+			PreviewType: previewType(name, false),
 		})
 
 		return nil
@@ -401,7 +1092,7 @@ func (d *LocalDriver) SearchFiles(storageName string, extensions []string, limit
 		results = results[:limit]
 	}
 
-	return results, totalMatches, err
+	return results, totalMatches, partial, err
 }
 
 // COUNT Stats: Fast recursive count by extension
@@ -411,6 +1102,8 @@ func (d *LocalDriver) CountByExtensions(storageName string, extGroups map[string
 		return nil, err
 	}
 
+	rules := d.filterRules(storageName)
+
 	stats := make(map[string]int)
 	// Invert map for O(1) lookup: "jpg" -> "images"
 	extToGroup := make(map[string]string)
@@ -421,6 +1114,7 @@ func (d *LocalDriver) CountByExtensions(storageName string, extGroups map[string
 		}
 	}
 
+	trashPath := filepath.Join(rootPath, TrashDir)
 	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
@@ -429,17 +1123,20 @@ func (d *LocalDriver) CountByExtensions(storageName string, extGroups map[string
 			if path == rootPath {
 				return nil
 			}
-			if !showHidden && isHiddenFile(info.Name()) {
+			if path == trashPath || (!showHidden && rules.IsHidden(info.Name())) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
+		if IsUploadTemp(info.Name()) {
+			return nil
+		}
 		if !showHidden {
 			// Optimization: Check only file name if parent was already checked?
 			// filepath.Walk descends, so if parent was hidden we skipped dir.
 			// So only check file name here.
-			if isHiddenFile(info.Name()) {
+			if rules.IsHidden(info.Name()) {
 				return nil
 			}
 		}
@@ -463,27 +1160,160 @@ func (d *LocalDriver) CreateFolder(storageName, subPath string) error {
 	if err != nil {
 		return err
 	}
-	return os.MkdirAll(fullPath, 0755)
+	return d.makeDirs(fullPath)
 }
 
-func (d *LocalDriver) SaveFile(storageName, subPath string, src io.Reader) error {
+// CreateFile creates an empty file with the upload file mode, creating
+// missing parent folders like uploads do. An existing file or folder fails
+// with os.ErrExist (O_EXCL), so nothing is ever truncated.
+func (d *LocalDriver) CreateFile(storageName, subPath string) error {
 	fullPath, err := d.validatePath(storageName, subPath)
 	if err != nil {
 		return err
 	}
-	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := d.makeDirs(filepath.Dir(fullPath)); err != nil {
 		return err
 	}
-	dst, err := os.Create(fullPath)
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
-	_, err = io.Copy(dst, src)
+	// OpenFile's mode is masked by the umask; a configured mode overrides it
+	// on the handle, so a name swapped in meanwhile isn't touched
+	if fileMode, _ := d.writeModes(); fileMode != 0 {
+		if err := f.Chmod(fileMode); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func (d *LocalDriver) SaveFile(storageName, subPath string, src io.Reader) error {
+	_, _, err := d.SaveFileVerified(storageName, subPath, src, "")
 	return err
 }
 
+// ErrChecksumMismatch is returned when an upload's SHA-256 differs from the expected one
+var ErrChecksumMismatch = errors.New("checksum_mismatch")
+
+// SaveFileVerified writes src like SaveFile and returns the bytes written and
+// their hex SHA-256. With a non-empty expectedSHA a different hash discards
+// the upload before it replaces anything.
+func (d *LocalDriver) SaveFileVerified(storageName, subPath string, src io.Reader, expectedSHA string) (int64, string, error) {
+	upload, err := d.StageUpload(storageName, subPath, src, expectedSHA)
+	if err != nil {
+		if upload != nil {
+			return upload.Size, upload.SHA256, err
+		}
+		return 0, "", err
+	}
+	if err := upload.Place(subPath, true); err != nil {
+		upload.Discard()
+		return 0, "", err
+	}
+	return upload.Size, upload.SHA256, nil
+}
+
+// StagedUpload is a complete upload in a hidden temp file, waiting to be
+// placed under its final name in the same folder
+type StagedUpload struct {
+	d       *LocalDriver
+	storage string
+	tmpPath string
+	Size    int64
+	SHA256  string
+}
+
+// StageUpload writes src next to subPath (creating missing folders) without
+// touching subPath itself. On a checksum mismatch the temp file is already
+// gone and the returned upload only reports the size and hash received.
+func (d *LocalDriver) StageUpload(storageName, subPath string, src io.Reader, expectedSHA string) (*StagedUpload, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(fullPath)
+	if err := d.makeDirs(dir); err != nil {
+		return nil, err
+	}
+
+	// Write next to the target, then rename over it: readers see either the
+	// old file or the complete new one, never a partial upload
+	tmp, err := createUploadTemp(dir, filepath.Base(fullPath), 0666)
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	hash := sha256.New()
+	written, err := io.Copy(tmp, io.TeeReader(src, hash))
+	if err == nil {
+		// The open mode was masked by the umask; a configured mode overrides it
+		if fileMode, _ := d.writeModes(); fileMode != 0 {
+			err = tmp.Chmod(fileMode)
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	upload := &StagedUpload{d: d, storage: storageName, tmpPath: tmpPath, Size: written, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if expectedSHA != "" && !strings.EqualFold(upload.SHA256, expectedSHA) {
+		os.Remove(tmpPath)
+		return upload, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, strings.ToLower(expectedSHA), upload.SHA256)
+	}
+	return upload, nil
+}
+
+// Place gives the upload its final name, which must be in the folder it was
+// staged in. With replace an existing file is swapped out atomically;
+// without it a taken name fails with os.ErrExist and is left untouched, even
+// when another upload claims it at the same moment. The upload stays staged
+// after an error.
+func (u *StagedUpload) Place(subPath string, replace bool) error {
+	fullPath, err := u.d.validatePath(u.storage, subPath)
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(fullPath) != filepath.Dir(u.tmpPath) {
+		return fmt.Errorf("place %s: not in the staging folder", subPath)
+	}
+	if replace {
+		return os.Rename(u.tmpPath, fullPath)
+	}
+	// A hard link never replaces its target
+	err = os.Link(u.tmpPath, fullPath)
+	if err == nil {
+		os.Remove(u.tmpPath)
+		return nil
+	}
+	if errors.Is(err, os.ErrExist) {
+		return err
+	}
+	// No hard links on this filesystem: claim the name first, then rename
+	// over the (empty) claim
+	claim, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	claim.Close()
+	if err := os.Rename(u.tmpPath, fullPath); err != nil {
+		os.Remove(fullPath)
+		return err
+	}
+	return nil
+}
+
+// Discard deletes a staged upload that won't be placed
+func (u *StagedUpload) Discard() {
+	os.Remove(u.tmpPath)
+}
+
 func (d *LocalDriver) GetRealPath(storageName, subPath string) (string, error) {
 	return d.validatePath(storageName, subPath)
 }
@@ -508,11 +1338,75 @@ func (d *LocalDriver) Rename(storageName, oldPath, newPath string) error {
 	return os.Rename(oldFullPath, newFullPath)
 }
 
+// Replace moves oldPath to newPath, replacing whatever is there, file or
+// folder. The old target is parked under an upload temp name first and only
+// deleted once the move succeeded; if the move fails it is put back.
+func (d *LocalDriver) Replace(storageName, oldPath, newPath string) error {
+	oldFullPath, err := d.validatePath(storageName, oldPath)
+	if err != nil {
+		return err
+	}
+	newFullPath, err := d.validatePath(storageName, newPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(newFullPath); os.IsNotExist(err) {
+		return os.Rename(oldFullPath, newFullPath)
+	}
+
+	parked := filepath.Join(filepath.Dir(newFullPath), tempName(filepath.Base(newFullPath), strconv.FormatInt(time.Now().UnixNano(), 10)))
+	if err := os.Rename(newFullPath, parked); err != nil {
+		return err
+	}
+	if err := os.Rename(oldFullPath, newFullPath); err != nil {
+		os.Rename(parked, newFullPath)
+		return err
+	}
+	return os.RemoveAll(parked)
+}
+
+// Touch sets the access and modification times of a path, and with
+// recursive of everything below a folder. Symlinks are skipped rather than
+// followed. Returns how many entries were changed.
+func (d *LocalDriver) Touch(storageName, subPath string, t time.Time, recursive bool) (int, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return 0, err
+	}
+	if !recursive {
+		if err := os.Chtimes(fullPath, t, t); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	touched := 0
+	err = filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if err := os.Chtimes(path, t, t); err != nil {
+			return err
+		}
+		touched++
+		return nil
+	})
+	return touched, err
+}
+
 func (d *LocalDriver) Delete(storageName, subPath string) error {
 	fullPath, err := d.validatePath(storageName, subPath)
 	if err != nil {
 		return err
 	}
+	// RemoveAll succeeds on a missing path; report it like the other
+	// operations. Lstat so dangling symlinks can still be removed.
+	if _, err := os.Lstat(fullPath); err != nil {
+		return err
+	}
 	return os.RemoveAll(fullPath)
 }
 
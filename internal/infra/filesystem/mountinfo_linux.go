@@ -0,0 +1,101 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lookupMount finds the mount that contains path by parsing
+// /proc/self/mountinfo, which (unlike comparing device IDs with the parent)
+// sees bind mounts, overlays and btrfs subvolumes.
+func lookupMount(path string) (mountEntry, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return mountEntry{}, err
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return mountEntry{}, err
+	}
+	defer f.Close()
+
+	// Later lines shadow earlier ones on the same point, so the last longest match wins
+	var best mountEntry
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e, ok := parseMountInfoLine(scanner.Text())
+		if !ok || !mountContains(e.MountPoint, resolved) {
+			continue
+		}
+		if !found || len(e.MountPoint) >= len(best.MountPoint) {
+			best, found = e, true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return mountEntry{}, err
+	}
+	if !found {
+		return mountEntry{}, os.ErrNotExist
+	}
+	best.IsMountPoint = best.MountPoint == resolved
+	return best, nil
+}
+
+// A line looks like:
+// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+// Optional fields end at the "-" separator, followed by fstype and source.
+func parseMountInfoLine(line string) (mountEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return mountEntry{}, false
+	}
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 || sep+2 >= len(fields) {
+		return mountEntry{}, false
+	}
+	return mountEntry{
+		MountPoint: unescapeMountInfo(fields[4]),
+		FsType:     fields[sep+1],
+		Source:     unescapeMountInfo(fields[sep+2]),
+	}, true
+}
+
+// Spaces, tabs, newlines and backslashes are written as octal escapes (\040)
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountContains reports whether p is the mount point or below it
+func mountContains(root, p string) bool {
+	if root == "/" || root == p {
+		return true
+	}
+	return strings.HasPrefix(p, root+"/")
+}
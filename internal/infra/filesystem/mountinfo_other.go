@@ -0,0 +1,10 @@
+//go:build !linux
+
+package filesystem
+
+import "errors"
+
+// Without /proc/self/mountinfo the device ID heuristic is used
+func lookupMount(path string) (mountEntry, error) {
+	return mountEntry{}, errors.New("mountinfo not supported on this platform")
+}
@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearchFilesStopsAtDeadline(t *testing.T) {
+	root := t.TempDir()
+	const files = 100
+	for i := 0; i < files; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("f%03d.txt", i)), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := NewLocalDriver(map[string]string{"ssd": root})
+	// Every file takes 5ms to look at, so the whole walk needs 500ms
+	slow := func(name string, info os.FileInfo) bool {
+		time.Sleep(5 * time.Millisecond)
+		return true
+	}
+
+	start := time.Now()
+	results, total, partial, err := d.SearchFiles("ssd", slow, 0, 0, false, start.Add(50*time.Millisecond))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partial {
+		t.Error("walk past its deadline not flagged partial")
+	}
+	if total == 0 || total >= files || len(results) != total {
+		t.Errorf("partial walk found %d (%d results), want some but not all of %d", total, len(results), files)
+	}
+	if elapsed > 250*time.Millisecond {
+		t.Errorf("walk took %v, want it cut off near the 50ms budget", elapsed)
+	}
+
+	results, total, partial, err = d.SearchFiles("ssd", slow, 0, 0, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial || total != files || len(results) != files {
+		t.Errorf("walk without a deadline: partial = %v, %d found; want false, %d", partial, total, files)
+	}
+}
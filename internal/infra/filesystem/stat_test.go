@@ -0,0 +1,45 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatCountsListedChildren(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{
+		"docs/a.txt",
+		"docs/.notes.txt",
+		"docs/sub/b.txt",
+		TrashDir + "/old.txt",
+		"top.txt",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An upload in progress next to the listed files
+	if err := os.WriteFile(filepath.Join(root, "docs", tempName("c.txt", "123")), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewLocalDriver(map[string]string{"ssd": root})
+
+	for _, path := range []string{"/", "/docs"} {
+		listed, err := d.ReadDir("ssd", path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := d.Stat("ssd", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ItemCount != len(listed) {
+			t.Errorf("Stat(%s).ItemCount = %d, want the %d entries ReadDir lists", path, info.ItemCount, len(listed))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Swap exchanges two existing paths of a storage. atomic reports whether the
+// kernel did it in one step (renameat2 RENAME_EXCHANGE); otherwise it was a
+// three-way rename through a hidden temp name.
+func (d *LocalDriver) Swap(storageName, pathA, pathB string) (bool, error) {
+	fullA, err := d.validatePath(storageName, pathA)
+	if err != nil {
+		return false, err
+	}
+	fullB, err := d.validatePath(storageName, pathB)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(fullA); err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(fullB); err != nil {
+		return false, err
+	}
+	return exchangePaths(fullA, fullB)
+}
+
+// swapByRename moves a aside, b onto a, then the parked a onto b, undoing
+// the completed steps if a later one fails. The temp name uses the upload
+// temp form so listings never show it.
+func swapByRename(a, b string) error {
+	tmp := filepath.Join(filepath.Dir(a), tempName(filepath.Base(a), strconv.FormatInt(time.Now().UnixNano(), 10)))
+	if err := os.Rename(a, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(b, a); err != nil {
+		os.Rename(tmp, a)
+		return err
+	}
+	if err := os.Rename(tmp, b); err != nil {
+		os.Rename(a, b)
+		os.Rename(tmp, a)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchangePaths swaps a and b in one renameat2 call, falling back to renames
+// on kernels or filesystems without RENAME_EXCHANGE
+func exchangePaths(a, b string) (bool, error) {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return false, swapByRename(a, b)
+	}
+	if err != nil {
+		return false, &os.LinkError{Op: "renameat2", Old: a, New: b, Err: err}
+	}
+	return true, nil
+}
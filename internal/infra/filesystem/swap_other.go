@@ -0,0 +1,8 @@
+//go:build !linux
+
+package filesystem
+
+// Without renameat2 the swap is a three-way rename
+func exchangePaths(a, b string) (bool, error) {
+	return false, swapByRename(a, b)
+}
@@ -0,0 +1,67 @@
+package filesystem
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Uploads are written to a hidden sibling ".<name>.tmp-<digits>" and renamed
+// over the final name once complete, so a partial file is never visible under
+// its real name. Listings, search and the index skip these names even with
+// show_hidden, so nobody can see or act on an unfinished upload.
+const uploadTempInfix = ".tmp-"
+
+// maxTempNameBytes is the name limit of the usual Linux filesystems
+const maxTempNameBytes = 255
+
+// tempName is the hidden temp name ".<name>.tmp-<suffix>". A name near the
+// limit is cut short (on a rune boundary) so that a file which may exist
+// under name can also be staged.
+func tempName(name, suffix string) string {
+	if keep := maxTempNameBytes - 1 - len(uploadTempInfix) - len(suffix); len(name) > keep {
+		for keep > 0 && !utf8.RuneStart(name[keep]) {
+			keep--
+		}
+		name = name[:keep]
+	}
+	return "." + name + uploadTempInfix + suffix
+}
+
+// createUploadTemp creates the temp file for an upload of name in dir. Unlike
+// os.CreateTemp's fixed 0600 it opens with mode, so the umask applies to it
+// the same way it does to os.Create.
+func createUploadTemp(dir, name string, mode os.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		tmpPath := filepath.Join(dir, tempName(name, strconv.FormatUint(uint64(rand.Uint32()), 10)))
+		f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// IsUploadTemp reports whether name is an in-progress upload's temp file
+func IsUploadTemp(name string) bool {
+	if !strings.HasPrefix(name, ".") {
+		return false
+	}
+	i := strings.LastIndex(name, uploadTempInfix)
+	if i < 1 {
+		return false
+	}
+	suffix := name[i+len(uploadTempInfix):]
+	if suffix == "" {
+		return false
+	}
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
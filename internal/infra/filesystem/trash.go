@@ -0,0 +1,249 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"storages-api/internal/domain"
+	"strings"
+	"time"
+)
+
+// Deleting with trash moves the item to <root>/.trash/<id>/<original path>,
+// so a restore only has to rename it back. <id>.json next to that folder
+// records what was trashed and when. The trash folder is skipped by listings,
+// search and the index even with show_hidden. The service refuses writes
+// inside it except through the trash methods; reads by explicit path still
+// work like anywhere else in the storage.
+const TrashDir = ".trash"
+
+const trashIDLayout = "20060102T150405.000000000"
+
+var trashIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}$`)
+
+// ErrInvalidTrashID is returned for an id that was not made by MoveToTrash
+var ErrInvalidTrashID = errors.New("invalid_trash_id")
+
+// trashRecord is the <id>.json written next to a trashed item
+type trashRecord struct {
+	Path      string    `json:"path"`
+	DeletedAt time.Time `json:"deleted_at"`
+	IsDir     bool      `json:"is_dir"`
+	Size      int64     `json:"size"`
+}
+
+// InTrash reports whether a storage-relative path is the trash folder or inside it
+func InTrash(subPath string) bool {
+	p := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+subPath)), "/")
+	return p == TrashDir || strings.HasPrefix(p, TrashDir+"/")
+}
+
+// trashItemPaths returns the trashed item's folder and record file
+func (d *LocalDriver) trashItemPaths(storageName, id string) (string, string, error) {
+	if !trashIDPattern.MatchString(id) {
+		return "", "", ErrInvalidTrashID
+	}
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(rootPath, TrashDir, id)
+	return dir, dir + ".json", nil
+}
+
+// MoveToTrash moves a path into a new trash entry and returns its id
+func (d *LocalDriver) MoveToTrash(storageName, subPath string) (string, error) {
+	fullPath, err := d.validatePath(storageName, subPath)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return "", err
+	}
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(rootPath, fullPath)
+	if err != nil || rel == "." {
+		return "", fmt.Errorf("cannot trash the storage root")
+	}
+
+	trashRoot := filepath.Join(rootPath, TrashDir)
+	if err := d.makeDirs(trashRoot); err != nil {
+		return "", err
+	}
+	// Ids are timestamps; two deletes in the same nanosecond take the next one
+	now := time.Now().UTC()
+	var id, entryDir string
+	for {
+		id = now.Format(trashIDLayout)
+		entryDir = filepath.Join(trashRoot, id)
+		err = os.Mkdir(entryDir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		now = now.Add(time.Nanosecond)
+	}
+
+	record := trashRecord{
+		Path:      "/" + filepath.ToSlash(rel),
+		DeletedAt: now,
+		IsDir:     info.IsDir(),
+		Size:      info.Size(),
+	}
+	if info.IsDir() {
+		if usage, err := d.DirSize(storageName, subPath); err == nil {
+			record.Size = usage.ApparentBytes
+		}
+	}
+
+	target := filepath.Join(entryDir, rel)
+	if err := d.makeDirs(filepath.Dir(target)); err != nil {
+		os.RemoveAll(entryDir)
+		return "", err
+	}
+	if err := os.Rename(fullPath, target); err != nil {
+		os.RemoveAll(entryDir)
+		return "", err
+	}
+	data, _ := json.Marshal(record)
+	if err := os.WriteFile(entryDir+".json", data, 0644); err != nil {
+		// The item is safe in the trash but could not be restored without
+		// its record, so put it back
+		os.Rename(target, fullPath)
+		os.RemoveAll(entryDir)
+		return "", err
+	}
+	return id, nil
+}
+
+// readTrashRecord loads the record of one trash entry
+func readTrashRecord(recordPath string) (trashRecord, error) {
+	var record trashRecord
+	data, err := os.ReadFile(recordPath)
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+// TrashedPath returns the original path of a trash entry
+func (d *LocalDriver) TrashedPath(storageName, id string) (string, error) {
+	_, recordPath, err := d.trashItemPaths(storageName, id)
+	if err != nil {
+		return "", err
+	}
+	record, err := readTrashRecord(recordPath)
+	if err != nil {
+		return "", err
+	}
+	return record.Path, nil
+}
+
+// ListTrash returns the trash entries of a storage, newest first
+func (d *LocalDriver) ListTrash(storageName string) ([]domain.TrashItem, error) {
+	rootPath, err := d.getStorageRoot(storageName)
+	if err != nil {
+		return nil, err
+	}
+	trashRoot := filepath.Join(rootPath, TrashDir)
+	entries, err := os.ReadDir(trashRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []domain.TrashItem{}, nil
+		}
+		return nil, err
+	}
+
+	items := []domain.TrashItem{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !trashIDPattern.MatchString(entry.Name()) {
+			continue
+		}
+		record, err := readTrashRecord(filepath.Join(trashRoot, entry.Name()+".json"))
+		if err != nil {
+			continue // not finished, or damaged; leave it alone
+		}
+		items = append(items, domain.TrashItem{
+			ID:        entry.Name(),
+			Path:      record.Path,
+			DeletedAt: record.DeletedAt,
+			IsDir:     record.IsDir,
+			Size:      record.Size,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID > items[j].ID })
+	return items, nil
+}
+
+// RestoreFromTrash moves a trashed item back to its original path and
+// returns that path. Missing parent folders are recreated; an existing item
+// at the original path is never overwritten (os.ErrExist).
+func (d *LocalDriver) RestoreFromTrash(storageName, id string) (string, error) {
+	entryDir, recordPath, err := d.trashItemPaths(storageName, id)
+	if err != nil {
+		return "", err
+	}
+	record, err := readTrashRecord(recordPath)
+	if err != nil {
+		return "", err
+	}
+	fullPath, err := d.validatePath(storageName, record.Path)
+	if err != nil {
+		return "", err
+	}
+	if InTrash(record.Path) {
+		return "", ErrInvalidTrashID
+	}
+	if _, err := os.Lstat(fullPath); err == nil {
+		return "", fmt.Errorf("%s: %w", record.Path, os.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	source := filepath.Join(entryDir, filepath.FromSlash(strings.TrimPrefix(record.Path, "/")))
+	if err := d.makeDirs(filepath.Dir(fullPath)); err != nil {
+		return "", err
+	}
+	if err := os.Rename(source, fullPath); err != nil {
+		return "", err
+	}
+	os.RemoveAll(entryDir)
+	os.Remove(recordPath)
+	return record.Path, nil
+}
+
+// PurgeTrash permanently removes one trash entry, or with an empty id the
+// whole trash of the storage
+func (d *LocalDriver) PurgeTrash(storageName, id string) error {
+	if id == "" {
+		rootPath, err := d.getStorageRoot(storageName)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(filepath.Join(rootPath, TrashDir))
+	}
+	entryDir, recordPath, err := d.trashItemPaths(storageName, id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(recordPath); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(entryDir); err != nil {
+		return err
+	}
+	return os.Remove(recordPath)
+}
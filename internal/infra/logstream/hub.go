@@ -0,0 +1,174 @@
+package logstream
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels in increasing severity
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	level   int
+}
+
+// ParseLevel maps a level name to its severity (unknown names mean debug)
+func ParseLevel(name string) int {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return LevelDebug
+}
+
+// The app logs with plain Printf, so the level is inferred from the usual markers
+func inferLevel(line string) int {
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.Contains(upper, "ERROR") || strings.Contains(upper, "CRITICAL") || strings.Contains(upper, "FATAL"):
+		return LevelError
+	case strings.Contains(upper, "WARN"):
+		return LevelWarn
+	case strings.HasPrefix(upper, "DEBUG"):
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+type subscriber struct {
+	ch       chan Entry
+	minLevel int
+}
+
+// Hub keeps a ring buffer of recent log lines and fans new ones out to subscribers.
+// Publishing never blocks: a subscriber whose buffer is full misses lines.
+type Hub struct {
+	mu      sync.Mutex
+	ring    []Entry
+	next    int
+	full    bool
+	subs    map[*subscriber]struct{}
+	partial []byte
+}
+
+func NewHub(size int) *Hub {
+	return &Hub{
+		ring: make([]Entry, size),
+		subs: make(map[*subscriber]struct{}),
+	}
+}
+
+// Write implements io.Writer, splitting the stream into lines
+func (h *Hub) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	h.partial = append(h.partial, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(h.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(bytes.TrimRight(h.partial[:i], "\r")))
+		h.partial = h.partial[i+1:]
+	}
+	h.mu.Unlock()
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			h.publish(line)
+		}
+	}
+	return len(p), nil
+}
+
+func (h *Hub) publish(line string) {
+	level := inferLevel(line)
+	entry := Entry{Time: time.Now(), Level: levelNames[level], Message: line, level: level}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring[h.next] = entry
+	h.next = (h.next + 1) % len(h.ring)
+	if h.next == 0 {
+		h.full = true
+	}
+	for sub := range h.subs {
+		if level < sub.minLevel {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default: // slow consumer, drop
+		}
+	}
+}
+
+// Recent returns buffered entries at or above minLevel, oldest first
+func (h *Hub) Recent(minLevel int) []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var ordered []Entry
+	if h.full {
+		ordered = append(ordered, h.ring[h.next:]...)
+	}
+	ordered = append(ordered, h.ring[:h.next]...)
+
+	entries := make([]Entry, 0, len(ordered))
+	for _, e := range ordered {
+		if e.level >= minLevel {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Subscribe registers a live listener; call the returned func to unsubscribe
+func (h *Hub) Subscribe(minLevel int) (<-chan Entry, func()) {
+	sub := &subscriber{ch: make(chan Entry, 256), minLevel: minLevel}
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, sub)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// CaptureStdout routes everything printed to stdout (fmt.Printf included) and
+// the standard logger through the hub, while still writing to the terminal.
+func CaptureStdout(h *Hub) error {
+	original := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout = w
+	log.SetOutput(io.MultiWriter(os.Stderr, h))
+
+	go func() {
+		io.Copy(io.MultiWriter(original, h), r)
+	}()
+	return nil
+}
@@ -1,64 +1,252 @@
 package handlers
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"storages-api/internal/app"
 	"storages-api/internal/config"
+	"storages-api/internal/infra/transport/http/middleware"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	cfg *config.Config
+	cfg     *config.Config
+	service *app.FilesystemService // refresh tokens and the revocation list
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{cfg: cfg}
+func NewAuthHandler(cfg *config.Config, service *app.FilesystemService) *AuthHandler {
+	return &AuthHandler{cfg: cfg, service: service}
 }
 
 type LoginRequest struct {
+	Username string `json:"username"` // empty or "admin" = the PASSWORD account
 	Password string `json:"password"`
 }
 
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token"`
-	Message string `json:"message"`
+	Success   bool   `json:"success"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"` // unix seconds
+	// Single-use, longer-lived token for POST /api/refresh
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at,omitempty"`
+	Message          string `json:"message"`
 }
 
 // POST /api/login
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+		return badRequest(c, "invalid request body")
 	}
 
-	// Validate password only (username is ignored)
-	if req.Password != h.cfg.Password {
-		return c.Status(401).JSON(fiber.Map{
-			"error": "invalid password",
-		})
+	// The admin logs in with PASSWORD; other users come from USERS_FILE/USERS.
+	// Both are checked against bcrypt hashes.
+	username, role := "admin", middleware.RoleAdmin
+	if req.Username != "" && req.Username != "admin" {
+		if _, ok := h.cfg.Users.Authenticate(req.Username, req.Password); !ok {
+			return apiError(c, 401, "INVALID_CREDENTIALS", "invalid username or password")
+		}
+		username, role = req.Username, middleware.RoleUser
+	} else if bcrypt.CompareHashAndPassword(h.cfg.PasswordHash, []byte(req.Password)) != nil {
+		return apiError(c, 401, "INVALID_CREDENTIALS", "invalid password")
 	}
 
-	// Generate JWT token (valid for 7 days)
+	resp, err := h.issueTokens(username, role, true)
+	if err != nil {
+		return apiError(c, 500, "", "failed to generate token")
+	}
+	resp.Message = "login successful"
+	return c.JSON(resp)
+}
+
+// issueTokens signs an access token with a fresh jti and expiry and, when
+// withRefresh is set, stores a refresh token for the account
+func (h *AuthHandler) issueTokens(username, role string, withRefresh bool) (LoginResponse, error) {
+	jti, err := app.NewTokenID()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	now := time.Now()
+	expires := now.Add(time.Duration(h.cfg.TokenTTLHours) * time.Hour)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": "admin",
-		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(), // Extended to 7 days for less frequent login
-		"iat":      time.Now().Unix(),
+		"username": username,
+		"role":     role,
+		"jti":      jti,
+		"exp":      expires.Unix(),
+		"iat":      now.Unix(),
 	})
-
 	tokenString, err := token.SignedString([]byte(h.cfg.JwtSecret))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to generate token",
-		})
+		return LoginResponse{}, err
+	}
+
+	resp := LoginResponse{Success: true, Token: tokenString, ExpiresAt: expires.Unix()}
+	if withRefresh {
+		binding, _ := h.tokenBinding(username, role)
+		refresh, refreshExpires, err := h.service.IssueRefreshToken(username, role, binding)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		resp.RefreshToken = refresh
+		resp.RefreshExpiresAt = refreshExpires.Unix()
+	}
+	return resp, nil
+}
+
+// tokenBinding ties refresh tokens to the account's current password and the
+// JWT secret; ok is false for accounts that no longer exist, so removed users
+// can't refresh their way back in
+func (h *AuthHandler) tokenBinding(username, role string) (binding string, ok bool) {
+	credential := h.cfg.AdminPasswordID
+	if role != middleware.RoleAdmin {
+		account, ok := h.cfg.User(username)
+		if !ok {
+			return "", false
+		}
+		credential = account.PasswordHash
+	}
+	mac := hmac.New(sha256.New, []byte(h.cfg.JwtSecret))
+	mac.Write([]byte(username + "\x00" + credential))
+	return hex.EncodeToString(mac.Sum(nil)), true
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// POST /api/refresh - a refresh token in the body is swapped for a new
+// access + refresh token pair; otherwise the valid bearer token is replaced
+// by one with a fresh expiry and stops working itself
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return badRequest(c, "invalid request body")
+		}
+	}
+
+	if req.RefreshToken != "" {
+		username, role, binding, err := h.service.UseRefreshToken(req.RefreshToken)
+		if err == nil {
+			// A changed password or JWT secret invalidates the token
+			current, ok := h.tokenBinding(username, role)
+			if !ok || !hmac.Equal([]byte(current), []byte(binding)) {
+				err = app.ErrInvalidRefreshToken
+			}
+		}
+		if err != nil {
+			return sendError(c, 500, err)
+		}
+		resp, err := h.issueTokens(username, role, true)
+		if err != nil {
+			return apiError(c, 500, "", "failed to generate token")
+		}
+		resp.Message = "token refreshed"
+		return c.JSON(resp)
+	}
+
+	tokenString, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok {
+		return apiError(c, 401, "", "send a refresh_token or an Authorization: Bearer <token> header")
+	}
+	claims, ok := middleware.ParseToken(h.cfg, tokenString)
+	jti, _ := claims["jti"].(string)
+	if !ok || (jti != "" && h.service.TokenRevoked(jti)) {
+		return apiError(c, 401, "INVALID_TOKEN", "invalid or expired token")
+	}
+	username, role := "admin", middleware.RoleAdmin
+	if u, ok := claims["username"].(string); ok && u != "" {
+		username = u
+	}
+	if r, ok := claims["role"].(string); ok && r != "" {
+		role = r
+	}
+	if _, ok := h.tokenBinding(username, role); !ok {
+		return apiError(c, 401, "INVALID_TOKEN", "invalid or expired token")
 	}
 
-	return c.JSON(LoginResponse{
-		Success: true,
-		Token:   tokenString,
-		Message: "login successful",
+	resp, err := h.issueTokens(username, role, false)
+	if err != nil {
+		return apiError(c, 500, "", "failed to generate token")
+	}
+	if exp, err := claims.GetExpirationTime(); jti != "" && err == nil && exp != nil {
+		if err := h.service.RevokeToken(jti, exp.Time); err != nil {
+			return sendError(c, 500, err)
+		}
+	}
+	resp.Message = "token refreshed"
+	return c.JSON(resp)
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"` // optional, dropped as well
+}
+
+// POST /api/logout - revoke the bearer token (and a refresh token if given)
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return badRequest(c, "invalid request body")
+		}
+	}
+
+	claims, _ := c.Locals("claims").(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return apiError(c, 400, "TOKEN_NOT_REVOCABLE", "token has no id or expiry and can't be revoked")
+	}
+	if err := h.service.RevokeToken(jti, exp.Time); err != nil {
+		return sendError(c, 500, err)
+	}
+	if req.RefreshToken != "" {
+		if err := h.service.RevokeRefreshToken(req.RefreshToken); err != nil {
+			return sendError(c, 500, err)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "logged out",
+	})
+}
+
+type AddUserRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Storages []string `json:"storages"` // empty = all storages
+	// Storages the user may read but not change
+	ReadOnlyStorages []string `json:"read_only_storages"`
+}
+
+// POST /api/admin/users
+func (h *AuthHandler) AddUser(c *fiber.Ctx) error {
+	var req AddUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	created, err := h.cfg.Users.Add(req.Username, req.Password, req.Storages, req.ReadOnlyStorages)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	status := 200
+	if created {
+		status = 201
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success":            true,
+		"username":           req.Username,
+		"created":            created,
+		"storages":           req.Storages,
+		"read_only_storages": req.ReadOnlyStorages,
 	})
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+// login posts credentials and returns the refresh token
+func login(t *testing.T, e *testEnv, username, password string) string {
+	t.Helper()
+	return loginResponse(t, e, username, password).RefreshToken
+}
+
+// loginResponse posts credentials and returns the whole response
+func loginResponse(t *testing.T, e *testEnv, username, password string) LoginResponse {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, body := e.do(t, req)
+	if resp.StatusCode != 200 {
+		t.Fatalf("login %s: status %d: %s", username, resp.StatusCode, body)
+	}
+	var lr LoginResponse
+	if err := json.Unmarshal(body, &lr); err != nil {
+		t.Fatal(err)
+	}
+	return lr
+}
+
+// refresh swaps a refresh token; it returns the new one, or "" and the error code
+func refresh(t *testing.T, e *testEnv, token string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, body := e.do(t, req)
+	if resp.StatusCode != 200 {
+		return "", bodyCode(body)
+	}
+	var lr LoginResponse
+	json.Unmarshal(body, &lr)
+	return lr.RefreshToken, ""
+}
+
+func newAuthEnv(t *testing.T) *testEnv {
+	e := newTestEnv(t, nil)
+	auth := NewAuthHandler(e.cfg, e.service)
+	e.app.Post("/api/login", auth.Login)
+	e.app.Post("/api/refresh", auth.Refresh)
+	e.cfg.Users.OnChange(func(name string) { e.service.RevokeRefreshTokens(name) })
+	if _, err := e.cfg.Users.Add("bob", "first password", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	e := newAuthEnv(t)
+	first := login(t, e, "bob", "first password")
+	second, code := refresh(t, e, first)
+	if code != "" {
+		t.Fatalf("refresh failed with %s", code)
+	}
+	if _, code := refresh(t, e, first); code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("reused refresh token: code %q, want INVALID_REFRESH_TOKEN", code)
+	}
+	if _, code := refresh(t, e, second); code != "" {
+		t.Errorf("rotated refresh token refused with %s", code)
+	}
+}
+
+func TestPasswordResetRevokesRefreshTokens(t *testing.T) {
+	e := newAuthEnv(t)
+	token := login(t, e, "bob", "first password")
+	if _, err := e.cfg.Users.Add("bob", "second password", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := refresh(t, e, token); code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("refresh after password reset: code %q, want INVALID_REFRESH_TOKEN", code)
+	}
+}
+
+func TestRefreshTokenBoundToPasswordHash(t *testing.T) {
+	e := newAuthEnv(t)
+	token := login(t, e, "bob", "first password")
+	// Without the OnChange hook only the binding notices the new hash
+	e.cfg.Users.OnChange(nil)
+	if _, err := e.cfg.Users.Add("bob", "second password", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := refresh(t, e, token); code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("refresh with an old password's token: code %q, want INVALID_REFRESH_TOKEN", code)
+	}
+}
+
+func TestRefreshTokenBoundToSecret(t *testing.T) {
+	e := newAuthEnv(t)
+	token := login(t, e, "bob", "first password")
+	e.cfg.JwtSecret = "rotated-secret"
+	if _, code := refresh(t, e, token); code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("refresh after JWT_SECRET rotation: code %q, want INVALID_REFRESH_TOKEN", code)
+	}
+}
+
+func TestAdminRefreshTokenBoundToPassword(t *testing.T) {
+	e := newAuthEnv(t)
+	hash, err := config.HashPassword("admin password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.cfg.PasswordHash = []byte(hash)
+	e.cfg.AdminPasswordID = "first"
+	token := login(t, e, "admin", "admin password")
+	e.cfg.AdminPasswordID = "second"
+	if _, code := refresh(t, e, token); code != "INVALID_REFRESH_TOKEN" {
+		t.Errorf("refresh after admin password change: code %q, want INVALID_REFRESH_TOKEN", code)
+	}
+}
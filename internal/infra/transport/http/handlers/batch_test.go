@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// post sends a JSON body and decodes the JSON answer into out
+func (e *testEnv) post(t *testing.T, method, url, body string, out any) {
+	t.Helper()
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	_, respBody := e.do(t, req)
+	if err := json.Unmarshal(respBody, out); err != nil {
+		t.Fatalf("%s %s: %v: %s", method, url, err, respBody)
+	}
+	if strings.Contains(string(respBody), e.root) {
+		t.Errorf("%s %s leaks the storage path: %s", method, url, respBody)
+	}
+}
+
+type itemError struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+func TestItemErrorsAreMapped(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.app.Post("/api/move", e.files.MoveFiles)
+	e.app.Post("/api/delete/batch", e.files.DeleteBatch)
+	e.app.Post("/api/transaction", e.files.Transaction)
+	e.app.Get("/api/index/status", e.files.IndexStatus)
+	e.writeFile(t, "dir/a.txt", "a")
+	e.writeFile(t, "b.txt", "b")
+
+	var deleted struct{ Results []itemError }
+	e.post(t, "POST", "/api/delete/batch", `{"storage":"ssd","paths":["/missing.txt","/"]}`, &deleted)
+	want := []itemError{{"NOT_FOUND", "file not found"}, {"WRITE_NOT_ALLOWED", "writes to this storage are not allowed: cannot delete the storage root"}}
+	if len(deleted.Results) != 2 || deleted.Results[0] != want[0] || deleted.Results[1] != want[1] {
+		t.Errorf("delete batch results = %+v, want %+v", deleted.Results, want)
+	}
+
+	var moved struct{ Results []itemError }
+	e.post(t, "POST", "/api/move", `{"storage":"ssd","paths":["/dir/a.txt","/dir"],"destination":"/dir"}`, &moved)
+	if len(moved.Results) != 2 || moved.Results[0].Code != "ALREADY_IN_DESTINATION" || moved.Results[1].Code != "INVALID_DESTINATION" {
+		t.Errorf("move results = %+v", moved.Results)
+	}
+
+	var tx struct{ Steps []itemError }
+	e.post(t, "POST", "/api/transaction", `{"storage":"ssd","operations":[
+		{"op":"copy","path":"/b.txt","destination":"/dir/a.txt"},
+		{"op":"move","path":"/missing.txt","destination":"/c.txt"}]}`, &tx)
+	if len(tx.Steps) != 2 || tx.Steps[0].Code != "TARGET_EXISTS" || tx.Steps[1].Code != "" {
+		t.Errorf("transaction steps = %+v, want TARGET_EXISTS on the first", tx.Steps)
+	}
+	e.post(t, "POST", "/api/transaction", `{"storage":"ssd","operations":[{"op":"move","path":"/missing.txt","destination":"/c.txt"}]}`, &tx)
+	if len(tx.Steps) != 1 || tx.Steps[0] != (itemError{"NOT_FOUND", "file not found"}) {
+		t.Errorf("transaction steps = %+v, want NOT_FOUND", tx.Steps)
+	}
+
+	if err := os.RemoveAll(e.root); err != nil {
+		t.Fatal(err)
+	}
+	e.service.ReindexAll(true)
+	var status struct {
+		Storages []struct {
+			Code  string `json:"last_error_code"`
+			Error string `json:"last_error"`
+		}
+	}
+	e.post(t, "GET", "/api/index/status", "", &status)
+	if len(status.Storages) != 1 || status.Storages[0].Code != "NOT_FOUND" || status.Storages[0].Error != "file not found" {
+		t.Errorf("index status = %+v, want NOT_FOUND", status.Storages)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fileETag identifies a file version by modtime and size. Downloads and the
+// metadata endpoint share it so clients can correlate the two.
+func fileETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+}
+
+// etagMatches reports whether an If-None-Match header matches the given ETag
+// (weak comparison, as RFC 7232 requires for If-None-Match)
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag and answers 304 when the client's copy is current
+func notModified(c *fiber.Ctx, etag string) bool {
+	c.Set("ETag", etag)
+	if etagMatches(c.Get("If-None-Match"), etag) {
+		c.Status(fiber.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifRangeMatches evaluates an If-Range validator: an ETag must match strongly,
+// a date must equal the file's Last-Modified (second precision)
+func ifRangeMatches(header, etag string, modTime time.Time) bool {
+	header = strings.TrimSpace(header)
+	if strings.HasPrefix(header, "W/") {
+		return false
+	}
+	if strings.HasPrefix(header, `"`) {
+		return header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && t.Equal(modTime.UTC().Truncate(time.Second))
+}
+
+// prepareRange advertises byte ranges and, when If-Range no longer matches the
+// file, drops the Range header so the whole file is sent instead of a stale slice
+func prepareRange(c *fiber.Ctx, etag string, modTime time.Time) {
+	c.Set("Accept-Ranges", "bytes")
+	ifRange := c.Get("If-Range")
+	if ifRange == "" || c.Get("Range") == "" {
+		return
+	}
+	if !ifRangeMatches(ifRange, etag, modTime) {
+		c.Request().Header.Del("Range")
+	}
+}
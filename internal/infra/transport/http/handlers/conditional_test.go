@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// conditionalEnv mounts the routes that answer conditional requests
+func conditionalEnv(t *testing.T) *testEnv {
+	e := newTestEnv(t, nil)
+	e.app.Get("/api/stat", e.files.Stat)
+	e.app.Get("/api/download", e.files.DownloadFile)
+	return e
+}
+
+func TestStatNotModified(t *testing.T) {
+	e := conditionalEnv(t)
+	e.writeFile(t, "a.txt", "first")
+	const url = "/api/stat?storage=ssd&path=/a.txt"
+
+	resp, body := e.do(t, httptest.NewRequest("GET", url, nil))
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || etag == "" {
+		t.Fatalf("status = %d, ETag = %q: %s", resp.StatusCode, etag, body)
+	}
+
+	// The download of the same version carries the same ETag
+	dl, _ := e.do(t, httptest.NewRequest("GET", "/api/download?storage=ssd&path=/a.txt", nil))
+	if got := dl.Header.Get("ETag"); got != etag {
+		t.Errorf("download ETag = %q, want the metadata one %q", got, etag)
+	}
+
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("If-None-Match", header)
+		resp, body := e.do(t, req)
+		if resp.StatusCode != 304 || len(body) != 0 {
+			t.Errorf("If-None-Match %s: status = %d, body %q; want 304 and no body", header, resp.StatusCode, body)
+		}
+	}
+
+	e.writeFile(t, "a.txt", "changed")
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, body = e.do(t, req)
+	if resp.StatusCode != 200 {
+		t.Fatalf("changed file: status = %d, want 200: %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Errorf("changed file kept the ETag %s", etag)
+	}
+}
+
+func TestDownloadIfRange(t *testing.T) {
+	e := conditionalEnv(t)
+	full := e.writeFile(t, "a.bin", "0123456789")
+	modTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(full, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	const url = "/api/download?storage=ssd&path=/a.bin"
+	resp, _ := e.do(t, httptest.NewRequest("GET", url, nil))
+	etag := resp.Header.Get("ETag")
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", resp.Header.Get("Accept-Ranges"))
+	}
+
+	tests := []struct {
+		name    string
+		ifRange string
+		status  int
+		body    string
+	}{
+		{"matching etag", etag, 206, "2345"},
+		{"other etag", `"stale"`, 200, "0123456789"},
+		{"weak etag", "W/" + etag, 200, "0123456789"},
+		{"matching date", modTime.Format(http.TimeFormat), 206, "2345"},
+		{"older date", modTime.Add(-time.Hour).Format(http.TimeFormat), 200, "0123456789"},
+		{"unparsable", "yesterday", 200, "0123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set("Range", "bytes=2-5")
+			req.Header.Set("If-Range", tt.ifRange)
+			resp, body := e.do(t, req)
+			if resp.StatusCode != tt.status || string(body) != tt.body {
+				t.Errorf("status %d, body %q; want %d, %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+		})
+	}
+}
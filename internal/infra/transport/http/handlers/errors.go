@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"storages-api/internal/app"
+	"storages-api/internal/config"
+	"storages-api/internal/domain"
+	"storages-api/internal/infra/transport/http/middleware"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorCode gives a known error its stable code, HTTP status and message.
+// Entries are checked in order with errors.Is, so specific errors come
+// before the os.Err* ones they may wrap.
+type errorCode struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+var errorCodes = []errorCode{
+	{app.ErrStorageNotFound, 404, domain.CodeStorageNotFound, "storage not found"},
+	{app.ErrPathOutsideRoot, 400, domain.CodePathOutsideRoot, "path is outside the storage"},
+	{errInvalidPath, 400, "INVALID_PATH", "'..' segments are not allowed"},
+	{app.ErrWriteNotAllowed, 403, "WRITE_NOT_ALLOWED", "writes to this storage are not allowed"},
+	{app.ErrUploadBusy, 503, "UPLOAD_BUSY", "too many concurrent uploads, retry later"},
+	{app.ErrInvalidDestination, 400, "INVALID_DESTINATION", "destination is the source or inside it"},
+	{app.ErrNotAFolder, 400, "NOT_A_FOLDER", "destination is not a folder"},
+	{app.ErrAlreadyInDestination, 409, "ALREADY_IN_DESTINATION", "already in destination"},
+	{app.ErrNameTooLong, 400, "NAME_TOO_LONG", "name or path is too long"},
+	{app.ErrInvalidChecksum, 400, "INVALID_CHECKSUM", "checksum must be 64 hex characters"},
+	{app.ErrChecksumMismatch, 422, "CHECKSUM_MISMATCH", "checksum does not match"},
+	{app.ErrInsufficientSpace, 507, domain.CodeInsufficientStorage, "not enough free space on the storage"},
+	{app.ErrTargetExists, 409, "TARGET_EXISTS", "target already exists"},
+	{app.ErrInTrash, 400, "PATH_IN_TRASH", "path is inside the trash"},
+	{app.ErrInvalidTrashID, 400, "INVALID_TRASH_ID", "invalid trash id"},
+	{app.ErrInvalidMount, 400, "INVALID_MOUNT", "invalid mount"},
+	{app.ErrStorageExists, 409, "STORAGE_EXISTS", "storage already exists"},
+	{app.ErrInvalidSetting, 400, "INVALID_SETTING", "invalid setting"},
+	{app.ErrInvalidGlob, 400, "INVALID_GLOB", "invalid glob"},
+	{app.ErrInvalidSort, 400, "INVALID_SORT", "invalid sort"},
+	{app.ErrInvalidConflict, 400, "INVALID_ON_CONFLICT", "invalid on_conflict"},
+	{app.ErrUploadNotFound, 404, "UPLOAD_NOT_FOUND", "upload not found"},
+	{app.ErrInvalidChunk, 400, "INVALID_CHUNK", "invalid chunk"},
+	{app.ErrUploadIncomplete, 409, "UPLOAD_INCOMPLETE", "upload is incomplete"},
+	{app.ErrUploadTooLarge, 413, "UPLOAD_TOO_LARGE", "upload is too large"},
+	{app.ErrFetchBlocked, 403, "FETCH_BLOCKED", "fetch target not allowed"},
+	{app.ErrRemoteStatus, 502, "REMOTE_STATUS", "remote server returned"},
+	{app.ErrFetchTooLarge, 413, domain.CodePayloadTooLarge, "remote file exceeds size limit"},
+	{app.ErrToolUnavailable, 503, "TOOL_UNAVAILABLE", "required tool is not installed"},
+	{app.ErrNoThumbnail, 415, "NO_THUMBNAIL", "no thumbnail for this file type"},
+	{app.ErrUnsupportedHash, 400, "UNSUPPORTED_HASH_ALGORITHM", "unsupported hash algorithm"},
+	{app.ErrNotImage, 415, "UNSUPPORTED_IMAGE_FORMAT", "unsupported image format"},
+	{app.ErrDataURLTooLarge, 413, "FILE_TOO_LARGE", "file is too large"},
+	{app.ErrNotArchive, 415, "UNSUPPORTED_ARCHIVE", "unsupported archive"},
+	{app.ErrEntryNotFound, 404, "ENTRY_NOT_FOUND", "archive entry not found"},
+	{app.ErrEntryTooLarge, 413, "ENTRY_TOO_LARGE", "archive entry is too large"},
+	{app.ErrUnsafeEntry, 400, "UNSAFE_ENTRY", "archive entry escapes the destination"},
+	{app.ErrInvalidCursor, 400, "INVALID_CURSOR", "invalid cursor"},
+	{app.ErrOptimizeRunning, 409, "OPTIMIZE_RUNNING", "index optimize already running"},
+	{app.ErrDescriptionTooLong, 400, "DESCRIPTION_TOO_LONG", "description is too long"},
+	{app.ErrInvalidOperation, 400, "INVALID_OPERATION", "invalid operation"},
+	{app.ErrInvalidTransaction, 400, "INVALID_TRANSACTION", "invalid transaction"},
+	{app.ErrInvalidCompression, 400, "INVALID_COMPRESSION", "invalid compression"},
+	{app.ErrInvalidRefreshToken, 401, "INVALID_REFRESH_TOKEN", "invalid or expired refresh token"},
+	{config.ErrInvalidUsername, 400, "INVALID_USERNAME", "invalid username"},
+	{config.ErrInvalidPassword, 400, "INVALID_PASSWORD", "invalid password"},
+	{os.ErrNotExist, 404, domain.CodeNotFound, "file not found"},
+	{os.ErrExist, 409, domain.CodeAlreadyExists, "already exists"},
+	{os.ErrPermission, 403, domain.CodePermissionDenied, "permission denied"},
+}
+
+// lookupError finds the errorCodes entry for err
+func lookupError(err error) (errorCode, bool) {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e, true
+		}
+	}
+	return errorCode{}, false
+}
+
+// httpStatusForError is the status err answers with: 404 for missing files,
+// 403 for permission errors, 400 for paths escaping their storage, the
+// table's status for other known errors and 500 for the rest
+func httpStatusForError(err error) int {
+	var apiErr *domain.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	if e, ok := lookupError(err); ok {
+		return e.status
+	}
+	return 500
+}
+
+// toAPIError maps err to its code and status; unknown errors get status and
+// the generic code for it, and known is false for them. Host paths are
+// stripped from the message.
+func toAPIError(status int, err error) (apiErr *domain.APIError, known bool) {
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	msg := safeMessage(err)
+	if e, ok := lookupError(err); ok {
+		switch {
+		case msg == e.err.Error():
+			msg = e.message
+		case strings.HasPrefix(msg, e.err.Error()+": "):
+			// "checksum_mismatch: expected ..." -> "checksum does not match: expected ..."
+			msg = e.message + msg[len(e.err.Error()):]
+		case e.code == domain.CodeNotFound, e.status >= 500:
+			// os errors say little beyond the (redacted) file name, and
+			// whatever wraps a server-side error stays in the log
+			msg = e.message
+		}
+		return domain.NewAPIError(httpStatusForError(err), e.code, msg), true
+	}
+	return domain.NewAPIError(status, "", msg), false
+}
+
+// safeMessage is err's text with the absolute paths of *fs.PathError and
+// *os.LinkError cut down to their base name
+func safeMessage(err error) string {
+	msg := err.Error()
+	redact := func(p string) {
+		if filepath.IsAbs(p) {
+			msg = strings.ReplaceAll(msg, p, filepath.Base(p))
+		}
+	}
+	for queue := []error{err}; len(queue) > 0; queue = queue[1:] {
+		switch e := queue[0].(type) {
+		case *fs.PathError:
+			redact(e.Path)
+		case *os.LinkError:
+			redact(e.Old)
+			redact(e.New)
+		}
+		switch u := queue[0].(type) {
+		case interface{ Unwrap() error }:
+			if next := u.Unwrap(); next != nil {
+				queue = append(queue, next)
+			}
+		case interface{ Unwrap() []error }:
+			queue = append(queue, u.Unwrap()...)
+		}
+	}
+	return msg
+}
+
+// sendError answers with err mapped to its code; status applies to errors
+// without a known mapping. Unknown server errors are logged and answered
+// with a generic message, as their text may carry SQL, command lines or
+// host details.
+func sendError(c *fiber.Ctx, status int, err error, extra ...fiber.Map) error {
+	apiErr := publicError(c, status, err)
+	return c.Status(apiErr.Status).JSON(middleware.ErrorBody(apiErr, extra...))
+}
+
+// publicError is err as clients see it: mapped by toAPIError, and for
+// unknown server errors a generic message, with the detail logged unless c
+// is nil (the caller logged it already)
+func publicError(c *fiber.Ctx, status int, err error) *domain.APIError {
+	apiErr, known := toAPIError(status, err)
+	if !known && apiErr.Status >= 500 {
+		if c != nil {
+			log.Printf("error on %s %s: %v", c.Method(), c.Path(), err)
+		}
+		apiErr.Message = genericMessage(apiErr.Status)
+	}
+	return apiErr
+}
+
+// describeResults fills the code and message of each failed batch item
+func describeResults(c *fiber.Ctx, results []domain.BatchResult) {
+	for i := range results {
+		if err := results[i].Err; err != nil {
+			apiErr := publicError(c, 500, err)
+			results[i].Code, results[i].Error = apiErr.Code, apiErr.Message
+		}
+	}
+}
+
+// describeSteps fills the codes and messages of failed transaction steps
+// and undos
+func describeSteps(c *fiber.Ctx, steps []domain.TransactionStep) {
+	for i := range steps {
+		if err := steps[i].Err; err != nil {
+			apiErr := publicError(c, 500, err)
+			steps[i].Code, steps[i].Error = apiErr.Code, apiErr.Message
+		}
+		if err := steps[i].RollbackErr; err != nil {
+			apiErr := publicError(c, 500, err)
+			steps[i].RollbackCode, steps[i].RollbackError = apiErr.Code, apiErr.Message
+		}
+	}
+}
+
+// genericMessage is the message for a server error whose detail is withheld
+func genericMessage(status int) string {
+	if status == 500 {
+		return "internal error"
+	}
+	return strings.ToLower(http.StatusText(status))
+}
+
+// apiError answers with a handler's own error; an empty code means the
+// generic one for status
+func apiError(c *fiber.Ctx, status int, code, message string, extra ...fiber.Map) error {
+	return c.Status(status).JSON(middleware.ErrorBody(domain.NewAPIError(status, code, message), extra...))
+}
+
+// badRequest answers 400 INVALID_REQUEST with message
+func badRequest(c *fiber.Ctx, message string) error {
+	return apiError(c, 400, domain.CodeInvalidRequest, message)
+}
+
+// ErrorHandler is the app-wide fiber.Config.ErrorHandler, so unknown routes,
+// wrong methods and oversized bodies get the same error body as handlers
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return apiError(c, fe.Code, "", fe.Message)
+	}
+	log.Printf("unhandled error on %s %s: %v", c.Method(), c.Path(), err)
+	return apiError(c, 500, "", genericMessage(500))
+}
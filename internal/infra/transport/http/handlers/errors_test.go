@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"storages-api/internal/app"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHTTPStatusForError(t *testing.T) {
+	dir := t.TempDir()
+	renameErr := os.Rename(filepath.Join(dir, "missing"), filepath.Join(dir, "target"))
+	var linkErr *os.LinkError
+	if !errors.As(renameErr, &linkErr) {
+		t.Fatalf("rename error = %T %v, want *os.LinkError", renameErr, renameErr)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not exist", os.ErrNotExist, 404},
+		{"fs not exist", fs.ErrNotExist, 404},
+		{"path error", &fs.PathError{Op: "open", Path: "/srv/x", Err: fs.ErrNotExist}, 404},
+		{"link error from rename", renameErr, 404},
+		{"permission", os.ErrPermission, 403},
+		{"path error permission", &fs.PathError{Op: "open", Path: "/srv/x", Err: fs.ErrPermission}, 403},
+		{"outside root", app.ErrPathOutsideRoot, 400},
+		{"wrapped outside root", fmt.Errorf("resolve %q: %w", "../x", app.ErrPathOutsideRoot), 400},
+		{"wrapped twice", fmt.Errorf("copy: %w", fmt.Errorf("stat: %w", os.ErrPermission)), 403},
+		{"specific before os error", fmt.Errorf("%w: %w", app.ErrTargetExists, os.ErrExist), 409},
+		{"joined", errors.Join(errors.New("first"), os.ErrNotExist), 404},
+		{"unknown", errors.New("database is locked"), 500},
+		{"wrapped unknown", fmt.Errorf("index: %w", errors.New("disk I/O error")), 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpStatusForError(tt.err); got != tt.status {
+				t.Errorf("httpStatusForError(%v) = %d, want %d", tt.err, got, tt.status)
+			}
+		})
+	}
+}
+
+func TestSendErrorHidesServerErrorDetail(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		err     error
+		want    int
+		message string
+	}{
+		{"unknown 500", 500, errors.New("sqlite: no such table: files_fts"), 500, "internal error"},
+		{"unknown 502", 502, fmt.Errorf("exec: %q: not found", "/usr/local/bin/ffmpeg"), 502, "bad gateway"},
+		{"known 5xx wrapped", 500, fmt.Errorf("upload to /srv/ssd: %w", app.ErrInsufficientSpace), 507, "not enough free space on the storage"},
+		{"invalid destination", 500, fmt.Errorf("%w: /a/b is inside /a", app.ErrInvalidDestination), 400, "destination is the source or inside it: /a/b is inside /a"},
+		{"remote status", 502, fmt.Errorf("%w: %s", app.ErrRemoteStatus, "404 Not Found"), 502, "remote server returned: 404 Not Found"},
+		{"unknown 4xx keeps redacted text", 400, &fs.PathError{Op: "open", Path: "/srv/ssd/a.txt", Err: errors.New("bad")}, 400, "open a.txt: bad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, nil)
+			e.app.Get("/", func(c *fiber.Ctx) error { return sendError(c, tt.status, tt.err) })
+			resp, body := e.do(t, httptest.NewRequest("GET", "/", nil))
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			var got struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Error.Message != tt.message {
+				t.Errorf("message = %q, want %q", got.Error.Message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"storages-api/internal/app"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/filesystem"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testEnv is a service over one storage "ssd" in a temp folder, without
+// background indexing, and a fiber app with the shared error handler
+type testEnv struct {
+	cfg     *config.Config
+	service *app.FilesystemService
+	files   *FileManagerHandler
+	app     *fiber.App
+	root    string // the storage folder
+}
+
+func newTestEnv(t *testing.T, configure func(cfg *config.Config)) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "ssd")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StorageMounts:        map[string]string{"ssd": root},
+		StorageOptions:       map[string]config.StorageOptions{},
+		JwtSecret:            "test-secret",
+		Users:                config.NewUserStore(filepath.Join(dir, "users.json"), nil),
+		TokenTTLHours:        1,
+		RefreshTokenTTLHours: 1,
+		IndexDBPath:          filepath.Join(dir, "index.db"),
+		IndexIntervalMinutes: 60,
+		ThumbCacheDir:        filepath.Join(dir, "thumbs"),
+		UploadChunkDir:       filepath.Join(dir, "chunks"),
+		ReadDirWorkers:       4,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	driver := filesystem.NewLocalDriver(cfg.StorageMounts)
+	driver.SetWriteModes(cfg.UploadFileMode, cfg.UploadDirMode)
+	driver.SetSpaceMargin(cfg.MinFreeSpacePercent)
+	driver.SetReadDirWorkers(cfg.ReadDirWorkers)
+	service := app.NewFilesystemService(driver, cfg)
+	return &testEnv{
+		cfg:     cfg,
+		service: service,
+		files:   NewFileManagerHandler(service),
+		app:     fiber.New(fiber.Config{ErrorHandler: ErrorHandler}),
+		root:    root,
+	}
+}
+
+// writeFile creates root/rel with content, making parent folders
+func (e *testEnv) writeFile(t *testing.T, rel, content string) string {
+	t.Helper()
+	full := filepath.Join(e.root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return full
+}
+
+// do runs req against the app and returns the response with its body read
+func (e *testEnv) do(t *testing.T, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := e.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp, body
+}
+
+// bodyCode is the "code" of an error body, or "" for other responses
+func bodyCode(body []byte) string {
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.Error.Code
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"storages-api/internal/domain"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func wantsHuman(c *fiber.Ctx) bool {
+	return c.QueryBool("human", false)
+}
+
+// humanizeFiles returns a copy with SizeHuman and RelativeTime set; listings
+// may come from the cache, which must not be modified
+func (h *FileManagerHandler) humanizeFiles(files []domain.FileInfo) []domain.FileInfo {
+	now := time.Now()
+	out := make([]domain.FileInfo, len(files))
+	for i, f := range files {
+		if !f.IsDir {
+			f.SizeHuman = h.service.FormatSize(f.Size)
+		}
+		if !f.ModTime.IsZero() {
+			f.RelativeTime = domain.RelativeTime(f.ModTime, now)
+		}
+		out[i] = f
+	}
+	return out
+}
+
+func (h *FileManagerHandler) humanizeStorages(storages []domain.StorageInfo) {
+	for i := range storages {
+		st := &storages[i]
+		st.TotalSizeHuman = h.service.FormatSize(int64(st.TotalSize))
+		st.UsedSizeHuman = h.service.FormatSize(int64(st.UsedSize))
+		st.FreeSizeHuman = h.service.FormatSize(int64(st.FreeSize))
+		st.AvailableSizeHuman = h.service.FormatSize(int64(st.AvailableSize))
+	}
+}
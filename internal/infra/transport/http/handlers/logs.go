@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"storages-api/internal/infra/logstream"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LogsHandler struct {
+	hub *logstream.Hub
+}
+
+func NewLogsHandler(hub *logstream.Hub) *LogsHandler {
+	return &LogsHandler{hub: hub}
+}
+
+// GET /api/logs/stream?level=warn&replay=true
+// Server-Sent Events feed of server log lines
+func (h *LogsHandler) Stream(c *fiber.Ctx) error {
+	minLevel := logstream.ParseLevel(c.Query("level", "debug"))
+	replay := c.Query("replay") == "true"
+
+	entries, cancel := h.hub.Subscribe(minLevel)
+	var backlog []logstream.Entry
+	if replay {
+		backlog = h.hub.Recent(minLevel)
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		send := func(e logstream.Entry) error {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: log\ndata: %s\n\n", data)
+			return w.Flush()
+		}
+
+		for _, e := range backlog {
+			if send(e) != nil {
+				return
+			}
+		}
+
+		// Heartbeats detect disconnected clients while the log is quiet
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e := <-entries:
+				if send(e) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
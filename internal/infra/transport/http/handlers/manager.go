@@ -1,64 +1,289 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"storages-api/internal/app"
 	"storages-api/internal/domain"
+	"storages-api/internal/infra/transport/http/middleware"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type FileManagerHandler struct {
 	service *app.FilesystemService
+	// PATH_TRAILING_SLASH=reject: refuse "/folder/" instead of cleaning it
+	rejectTrailingSlash bool
 }
 
 func NewFileManagerHandler(service *app.FilesystemService) *FileManagerHandler {
-	return &FileManagerHandler{service: service}
+	return &FileManagerHandler{service: service, rejectTrailingSlash: service.RejectTrailingSlash()}
 }
 
 // GET /api/storages - List available storages
+// ?with_stats=true adds the top 3 categories per storage from the index
 func (h *FileManagerHandler) ListStorages(c *fiber.Ctx) error {
-	storages := h.service.ListStorages()
+	var storages []domain.StorageInfo
+	if c.QueryBool("with_stats", false) {
+		storages = h.service.ListStoragesWithStats(3)
+	} else {
+		storages = h.service.ListStorages()
+	}
+	visible := storages[:0]
+	for _, st := range storages {
+		if middleware.StorageAllowed(c, st.Name) {
+			visible = append(visible, st)
+		}
+	}
+	storages = visible
+	if wantsHuman(c) {
+		h.humanizeStorages(storages)
+	}
 	return c.JSON(fiber.Map{
 		"storages": storages,
 	})
 }
 
-// GET /api/files?storage=ssd1&path=/some/folder
+// POST /api/storages - Register a mount at runtime (admin)
+func (h *FileManagerHandler) AddStorage(c *fiber.Ctx) error {
+	var req domain.AddStorageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Name == "" || req.Path == "" {
+		return badRequest(c, "name and path are required")
+	}
+
+	if err := h.service.AddStorage(req.Name, req.Path); err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"message": "storage registered, indexing started",
+	})
+}
+
+// DELETE /api/storages/:name - Unregister a mount (admin); files stay on disk
+func (h *FileManagerHandler) RemoveStorage(c *fiber.Ctx) error {
+	if err := h.service.RemoveStorage(c.Params("name")); err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "storage unregistered",
+	})
+}
+
+// GET /api/storages/:name/settings - Effective settings and which keys are overridden (admin)
+func (h *FileManagerHandler) StorageSettings(c *fiber.Ctx) error {
+	settings, overridden, err := h.service.StorageSettings(c.Params("name"))
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"settings":   settings,
+		"overridden": overridden,
+	})
+}
+
+// PUT /api/storages/:name/settings - Override settings at runtime (admin)
+// Body: {"read_only": true, "label": null}; null restores the config default
+func (h *FileManagerHandler) UpdateStorageSettings(c *fiber.Ctx) error {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || len(patch) == 0 {
+		return badRequest(c, "invalid request body")
+	}
+
+	if err := h.service.UpdateStorageSettings(c.Params("name"), patch); err != nil {
+		return sendError(c, 500, err)
+	}
+	return h.StorageSettings(c)
+}
+
+// GET /api/files?storage=ssd1&path=/some/folder&sort=size&order=desc&limit=100&offset=0
 func (h *FileManagerHandler) ListFiles(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage parameter is required",
-		})
+		return badRequest(c, "storage parameter is required")
 	}
 
+	done := middleware.Phase(c, "validate")
 	path := c.Query("path", "/")
+	err := h.normalizePaths(&path)
+	done()
+	if err != nil {
+		return sendError(c, 400, err)
+	}
+
 	recursive := c.Query("recursive") == "true"
 	showHidden := c.Query("show_hidden") == "true"
+	glob := c.Query("glob")
+	if glob != "" && recursive {
+		return badRequest(c, "glob applies to a single folder and can't be combined with recursive")
+	}
+
+	order, err := app.ParseListOrder(c.Query("sort"), c.Query("order"), c.QueryBool("dirs_first", true))
+	if err != nil {
+		return sendError(c, 400, err)
+	}
+	limit := c.QueryInt("limit", 0)
+	offset := c.QueryInt("offset", 0)
+	if limit < 0 || offset < 0 {
+		return badRequest(c, "limit and offset must not be negative")
+	}
 
 	var files []domain.FileInfo
-	var err error
+	var total int
 
+	done = middleware.Phase(c, "fs")
 	if recursive {
-		files, err = h.service.ListAllFiles(storage, showHidden)
+		files, total, err = h.service.ListAllFiles(storage, showHidden, order, limit, offset)
 	} else {
-		files, err = h.service.ListFiles(storage, path, showHidden)
+		files, total, err = h.service.ListFiles(storage, path, showHidden, glob, order, limit, offset)
 	}
+	done()
 
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return sendError(c, 500, err)
 	}
 
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		files = h.humanizeFiles(files)
+	}
 	return c.JSON(fiber.Map{
-		"storage": storage,
-		"path":    path,
-		"files":   files,
+		"storage":   storage,
+		"path":      path,
+		"files":     files,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+		"truncated": offset+len(files) < total,
+	})
+}
+
+// POST /api/prefetch?storage=ssd&path=/folder&depth=2
+// Warms the listing cache ahead of navigation (e.g. on hover)
+func (h *FileManagerHandler) Prefetch(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+	path := c.Query("path", "/")
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "fs")
+	res, err := h.service.Prefetch(storage, path, c.QueryInt("depth", 1), c.QueryBool("show_hidden", false))
+	done()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return apiError(c, 404, "", "folder not found")
+		}
+		return sendError(c, 500, err)
+	}
+	return c.JSON(res)
+}
+
+// GET /api/stat?storage=ssd1&path=/some/file.jpg
+// Supports If-None-Match so pollers get a cheap 304 while the file is unchanged.
+func (h *FileManagerHandler) Stat(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "fs")
+	info, err := h.service.Stat(storage, path)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	if notModified(c, fileETag(info.ModTime, info.Size)) {
+		return nil
+	}
+
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		info = h.humanizeFiles([]domain.FileInfo{info})[0]
+	}
+	return c.JSON(info)
+}
+
+// GET /api/exists?storage=ssd1&path=/foo.txt
+// Cheap check before writing; a missing path is {"exists": false}, not 404
+func (h *FileManagerHandler) Exists(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	exists, isDir, err := h.service.Exists(storage, path)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"exists": exists,
+		"is_dir": isDir,
+	})
+}
+
+// GET /api/mtime?storage=ssd&path=/folder
+// Latest modification time of anything under the folder
+func (h *FileManagerHandler) LatestModified(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+
+	path := c.Query("path", "/")
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "index")
+	modified, source, err := h.service.LatestModified(storage, path)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"storage":  storage,
+		"path":     path,
+		"modified": modified,
+		"source":   source,
 	})
 }
 
@@ -66,21 +291,19 @@ func (h *FileManagerHandler) ListFiles(c *fiber.Ctx) error {
 func (h *FileManagerHandler) CreateFolder(c *fiber.Ctx) error {
 	var req domain.CreateFolderRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+		return badRequest(c, "invalid request body")
 	}
 
 	if req.Storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage is required",
-		})
+		return badRequest(c, "storage is required")
+	}
+
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
 	}
 
 	if err := h.service.CreateFolder(req.Storage, req.Path); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return sendError(c, 500, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -91,241 +314,1043 @@ func (h *FileManagerHandler) CreateFolder(c *fiber.Ctx) error {
 	})
 }
 
+// POST /api/file
+// Body: { "storage": "ssd1", "path": "/notes.txt" } - an empty file; 409 if the path exists
+func (h *FileManagerHandler) CreateFile(c *fiber.Ctx) error {
+	var req domain.CreateFileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || req.Path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	if err := h.service.CreateFile(req.Storage, req.Path); err != nil {
+		if errors.Is(err, app.ErrTargetExists) {
+			extra := fiber.Map{"path": req.Path}
+			if existing, err := h.service.Stat(req.Storage, req.Path); err == nil {
+				extra["existing"] = existing
+			}
+			return sendError(c, 409, err, extra)
+		}
+		return sendError(c, 500, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success": true,
+		"message": "file created",
+		"storage": req.Storage,
+		"path":    req.Path,
+	})
+}
+
 // POST /api/upload?storage=ssd1&path=/target/folder
+// An existing file is kept (409) unless overwrite=true or on_conflict=rename|overwrite.
+// X-Checksum-SHA256 (or a checksum_sha256 form field) rejects corrupted uploads.
 func (h *FileManagerHandler) UploadFile(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage parameter is required",
-		})
+		return badRequest(c, "storage parameter is required")
+	}
+
+	onConflict := app.ConflictSkip
+	if value := c.Query("on_conflict"); value != "" {
+		policy, err := app.ParseConflictPolicy(value)
+		if err != nil {
+			return sendError(c, 400, err)
+		}
+		onConflict = policy
+	} else if c.QueryBool("overwrite", false) {
+		onConflict = app.ConflictOverwrite
 	}
 
 	targetPath := c.Query("path", "/")
+	if err := h.normalizePaths(&targetPath); err != nil {
+		return sendError(c, 400, err)
+	}
 
 	file, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "no file uploaded",
-		})
+		return badRequest(c, "no file uploaded")
 	}
 
 	src, err := file.Open()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to open uploaded file",
-		})
+		return apiError(c, 500, "", "failed to open uploaded file")
 	}
 	defer src.Close()
 
 	fullPath := filepath.Join(targetPath, file.Filename)
 
-	if err := h.service.UploadFile(storage, fullPath, src); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	expectedSHA := c.Get("X-Checksum-SHA256")
+	if expectedSHA == "" {
+		expectedSHA = c.FormValue("checksum_sha256")
+	}
+
+	res, err := h.service.UploadFile(storage, fullPath, src, file.Size, onConflict, expectedSHA)
+	if err != nil {
+		if errors.Is(err, app.ErrTargetExists) {
+			extra := fiber.Map{"path": fullPath}
+			if existing, err := h.service.Stat(storage, fullPath); err == nil {
+				extra["existing"] = existing
+			}
+			return sendError(c, 409, err, extra)
+		}
+		if errors.Is(err, app.ErrUploadBusy) {
+			c.Set("Retry-After", "5")
+		}
+		return sendError(c, 500, err)
+	}
+
+	res.Success = true
+	res.Message = "file uploaded successfully"
+	return c.JSON(res)
+}
+
+// POST /api/upload/init
+// Body: { "storage": "ssd1", "path": "/videos/big.mkv", "size": 7340032000 }
+func (h *FileManagerHandler) InitUpload(c *fiber.Ctx) error {
+	var req domain.ChunkedUploadInitRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+	if req.Storage == "" || req.Path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if req.Size < 0 {
+		return badRequest(c, "size must not be negative")
+	}
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
+	}
+	if req.Path == "/" {
+		return badRequest(c, "path must name the file")
+	}
+
+	id, err := h.service.InitUpload(req.Storage, req.Path, req.Size, uploadOwner(c))
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"id":      id,
+		"storage": req.Storage,
+		"path":    req.Path,
+	})
+}
+
+// uploadOwner is the user chunked upload sessions belong to; the other
+// upload routes only carry the id, so the ACL middleware can't check them
+func uploadOwner(c *fiber.Ctx) string {
+	username, _ := c.Locals("username").(string)
+	return username
+}
+
+// POST /api/upload/chunk?id=...&index=N
+// The request body is the raw chunk
+func (h *FileManagerHandler) UploadChunk(c *fiber.Ctx) error {
+	id := c.Query("id")
+	if id == "" || c.Query("index") == "" {
+		return badRequest(c, "id and index are required")
+	}
+	index, err := strconv.Atoi(c.Query("index"))
+	if err != nil {
+		return badRequest(c, "index must be a number")
+	}
+
+	if err := h.service.SaveChunk(id, uploadOwner(c), index, bytes.NewReader(c.Body())); err != nil {
+		if errors.Is(err, app.ErrUploadBusy) {
+			c.Set("Retry-After", "5")
+		}
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"index":   index,
+		"size":    len(c.Body()),
+	})
+}
+
+// GET /api/upload/status?id=...
+// Lists the received chunk indexes so a client can resume
+func (h *FileManagerHandler) UploadStatus(c *fiber.Ctx) error {
+	status, err := h.service.UploadStatus(c.Query("id"), uploadOwner(c))
+	if err != nil {
+		return sendError(c, 500, err)
 	}
+	return c.JSON(status)
+}
 
+// POST /api/upload/complete?id=...
+func (h *FileManagerHandler) CompleteUpload(c *fiber.Ctx) error {
+	path, err := h.service.CompleteUpload(c.Query("id"), uploadOwner(c))
+	if err != nil {
+		if errors.Is(err, app.ErrUploadBusy) {
+			c.Set("Retry-After", "5")
+		}
+		return sendError(c, 500, err)
+	}
 	return c.JSON(domain.UploadResponse{
 		Success:  true,
 		Message:  "file uploaded successfully",
-		FilePath: fullPath,
+		FilePath: path,
+	})
+}
+
+// POST /api/upload/abort?id=...
+func (h *FileManagerHandler) AbortUpload(c *fiber.Ctx) error {
+	if err := h.service.AbortUpload(c.Query("id"), uploadOwner(c)); err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// POST /api/fetch
+// Body: { "storage": "ssd1", "path": "/dest", "url": "https://example.com/file.zip" }
+func (h *FileManagerHandler) FetchRemote(c *fiber.Ctx) error {
+	var req domain.FetchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || req.URL == "" {
+		return badRequest(c, "storage and url are required")
+	}
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
+	}
+	// An existing file is kept unless asked otherwise, as for uploads
+	onConflict := app.ConflictSkip
+	if req.OnConflict != "" {
+		policy, err := app.ParseConflictPolicy(req.OnConflict)
+		if err != nil {
+			return sendError(c, 400, err)
+		}
+		onConflict = policy
+	}
+
+	res, err := h.service.FetchRemote(req.Storage, req.Path, req.Name, req.URL, onConflict)
+	if err != nil {
+		if errors.Is(err, app.ErrUploadBusy) {
+			c.Set("Retry-After", "5")
+		}
+		// Anything unmapped is the remote side failing
+		return sendError(c, 502, err)
+	}
+
+	return c.JSON(res)
+}
+
+// GET /api/download/zip?storage=ssd1&path=/folder
+// Streams the folder as a ZIP built on the fly; &show_hidden=true includes
+// hidden entries, &compression=store|deflate|auto (default auto)
+func (h *FileManagerHandler) DownloadZip(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+	path := c.Query("path", "/")
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+	compression, err := app.ParseZipCompression(c.Query("compression"))
+	if err != nil {
+		return sendError(c, 400, err)
+	}
+
+	isDir, err := h.service.IsDirectory(storage, path)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	if !isDir {
+		return badRequest(c, "path is not a folder")
+	}
+
+	name := filepath.Base(path)
+	if path == "/" {
+		name = storage
+	}
+	showHidden := c.QueryBool("show_hidden", false)
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", "attachment; filename="+name+".zip")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The status line is gone once streaming starts, so a failure midway
+	// can only be logged; the client gets a truncated archive
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.service.ZipFolder(storage, path, w, showHidden, compression); err != nil {
+			fmt.Printf("ZIP download %s:%s failed: %v\n", storage, path, err)
+			return
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// GET /api/download?storage=ssd1&path=/some/file.txt
+func (h *FileManagerHandler) DownloadFile(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	fullPath, err := h.service.GetRealPath(storage, path)
+	if err != nil {
+		return sendError(c, 404, err)
+	}
+
+	// One open and one fstat per request; the handle then serves the range
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	file, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return sendError(c, 500, err)
+	}
+	if file.IsDir() {
+		f.Close()
+		return apiError(c, 404, "", "file not found")
+	}
+
+	etag := fileETag(file.ModTime(), file.Size())
+	if notModified(c, etag) {
+		f.Close()
+		return nil
+	}
+	prepareRange(c, etag, file.ModTime())
+
+	c.Set("Content-Disposition", "attachment; filename="+filepath.Base(path))
+	contentType := domain.ContentTypeFor(filepath.Ext(path))
+	if h.accelRedirect(c, storage, path, contentType) {
+		f.Close()
+		return nil
+	}
+
+	// Content-Length comes from the range being sent, for progress tracking on mobile devices
+	return sendFileRange(c, f, file.Size(), contentType)
+}
+
+// GET /api/preview?storage=ssd&path=/image.jpg
+func (h *FileManagerHandler) PreviewFile(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	fullPath, err := h.service.GetRealPath(storage, path)
+	if err != nil {
+		return sendError(c, 404, err)
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	// Inline preview in browser
+	c.Set("Content-Disposition", "inline; filename="+filepath.Base(path))
+
+	// Auto-detect Content-Type
+	ext := strings.ToLower(filepath.Ext(path))
+	policy := h.service.PreviewPolicy()
+	decision := policy.Decide(ext, info.Size(), c.QueryBool("thumb", false), c.QueryBool("poster", false))
+
+	// A thumbnail made by the camera/NAS beats generating one
+	if decision.Action == app.PreviewPoster || decision.Action == app.PreviewThumbnail {
+		if sidecar, ok := h.service.SidecarThumbnail(fullPath, info.ModTime()); ok {
+			if thumb, err := os.ReadFile(sidecar); err == nil {
+				c.Set("Content-Type", domain.ContentTypeFor(filepath.Ext(sidecar)))
+				c.Set("X-Thumbnail-Source", "sidecar")
+				return c.Send(thumb)
+			}
+		}
+	}
+
+	switch decision.Action {
+	case app.PreviewPoster:
+		// Single static frame instead of streaming the video / playing the GIF
+		thumb, err := h.service.GetPoster(storage, path, info.ModTime())
+		if err == nil {
+			c.Set("Content-Type", "image/jpeg")
+			return c.Send(thumb)
+		}
+		if errors.Is(err, app.ErrToolUnavailable) {
+			return sendError(c, 503, err, fiber.Map{"tool": app.ToolFFmpeg})
+		}
+
+	case app.PreviewThumbnail:
+		// Formats the decoder doesn't know fall through to the full file
+		if thumb, err := h.service.ImageThumbnail(storage, path, info.ModTime(), policy.ThumbMaxPixels); err == nil {
+			c.Set("Content-Type", "image/jpeg")
+			return c.Send(thumb)
+		}
+
+	case app.PreviewTextHead:
+		head, truncated, err := h.service.ReadTextHead(fullPath, decision.MaxLines)
+		if err != nil {
+			return sendError(c, 500, err)
+		}
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		c.Set("X-Preview-Truncated", strconv.FormatBool(truncated))
+		return c.Send(head)
+	}
+
+	// Full file / video stream (Range requests for seeking)
+	etag := fileETag(info.ModTime(), info.Size())
+	c.Set("ETag", etag)
+	prepareRange(c, etag, info.ModTime())
+	if h.accelRedirect(c, storage, path, domain.ContentTypeFor(ext)) {
+		return nil
+	}
+	if info.IsDir() {
+		return apiError(c, 404, "", "file not found")
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return sendFileRange(c, f, info.Size(), domain.ContentTypeFor(ext))
+}
+
+// Thumbnails are addressed by path, so an edited file keeps its URL; the
+// ETag catches that on revalidation
+const thumbMaxAge = 3600
+
+// GET /api/thumb?storage=ssd&path=/photo.jpg
+// Small JPEG for an image or video, from a sidecar or the thumbnail cache
+func (h *FileManagerHandler) Thumb(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+	path := c.Query("path")
+	if path == "" {
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	fullPath, err := h.service.GetRealPath(storage, path)
+	if err != nil {
+		return sendError(c, 404, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	if info.IsDir() {
+		return apiError(c, 404, "", "file not found")
+	}
+
+	c.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", thumbMaxAge))
+	if notModified(c, fileETag(info.ModTime(), info.Size())) {
+		return nil
+	}
+
+	done := middleware.Phase(c, "fs")
+	thumb, err := h.service.Thumbnail(storage, path, info.ModTime())
+	done()
+	if err != nil {
+		c.Set("Cache-Control", "no-store")
+		if errors.Is(err, app.ErrToolUnavailable) {
+			return sendError(c, 503, err, fiber.Map{"tool": app.ToolFFmpeg})
+		}
+		return sendError(c, 500, err)
+	}
+	c.Set("Content-Type", thumb.ContentType)
+	c.Set("X-Thumbnail-Source", thumb.Source)
+	return c.Send(thumb.Data)
+}
+
+// GET /api/contactsheet?storage=ssd&path=/video.mp4&frames=16
+// One JPEG grid of evenly spaced frames, for scrubbing previews
+func (h *FileManagerHandler) ContactSheet(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	if storage == "" || path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	if domain.PreviewTypeFor(filepath.Ext(path)) != domain.PreviewVideo {
+		return badRequest(c, "not a video")
+	}
+
+	fullPath, err := h.service.GetRealPath(storage, path)
+	if err != nil {
+		return sendError(c, 404, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	sheet, err := h.service.GetContactSheet(fullPath, info.ModTime(), c.QueryInt("frames", 16))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return apiError(c, 504, "", "contact sheet timed out")
+		}
+		return sendError(c, 500, err)
+	}
+
+	c.Set("Content-Type", "image/jpeg")
+	return c.Send(sheet)
+}
+
+// GET /api/checksum?storage=ssd&path=/file.iso&algo=blake3
+// algo: sha256 (default, see CHECKSUM_ALGORITHM), sha1, md5, crc32, blake3
+func (h *FileManagerHandler) Checksum(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	if storage == "" || path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	info, err := h.service.Stat(storage, path)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	if info.IsDir {
+		return apiError(c, 404, "", "file not found")
+	}
+
+	done := middleware.Phase(c, "fs")
+	algo, sum, err := h.service.Checksum(storage, path, c.Query("algo"))
+	done()
+	if err != nil {
+		if errors.Is(err, app.ErrUnsupportedHash) {
+			return sendError(c, 400, err, fiber.Map{"supported": app.HashAlgorithms()})
+		}
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"storage":   storage,
+		"path":      path,
+		"size":      info.Size,
+		"algorithm": algo,
+		"checksum":  sum,
+	})
+}
+
+// GET /api/dimensions?storage=ssd&path=/img.jpg
+// Image width/height from the header only, for laying out grids
+func (h *FileManagerHandler) ImageDimensions(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	if storage == "" || path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	fullPath, err := h.service.GetRealPath(storage, path)
+	if err != nil {
+		return sendError(c, 404, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	if info.IsDir() {
+		return apiError(c, 404, "", "file not found")
+	}
+
+	done := middleware.Phase(c, "fs")
+	size, err := h.service.ImageDimensions(fullPath, info.ModTime())
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(size)
+}
+
+// GET /api/dataurl?storage=ssd&path=/icon.png
+// Small files only (DATAURL_MAX_KB), for inlining icons into JSON
+func (h *FileManagerHandler) DataURL(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	if storage == "" || path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "fs")
+	url, mime, err := h.service.DataURL(storage, path)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"path":     path,
+		"mime":     mime,
+		"data_url": url,
+	})
+}
+
+// POST /api/extract
+// Body: { "storage": "ssd1", "path": "/archive.zip", "dest": "/unpacked" }
+func (h *FileManagerHandler) Extract(c *fiber.Ctx) error {
+	var req domain.ExtractRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+	if req.Storage == "" || req.Path == "" || req.Dest == "" {
+		return badRequest(c, "storage, path and dest are required")
+	}
+	if err := h.normalizePaths(&req.Path, &req.Dest); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "fs")
+	files, err := h.service.ExtractZip(req.Storage, req.Path, req.Dest)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"storage": req.Storage,
+		"dest":    req.Dest,
+		"files":   files,
+	})
+}
+
+// GET /api/archive/list?storage=ssd&path=/backup.zip
+func (h *FileManagerHandler) ArchiveList(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	if storage == "" || path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	done := middleware.Phase(c, "fs")
+	entries, err := h.service.ArchiveEntries(storage, path)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"path":    path,
+		"entries": entries,
+		"total":   len(entries),
+	})
+}
+
+// GET /api/archive/extract-one?storage=ssd&path=/backup.zip&entry=docs/readme.txt
+// Streams one decompressed entry, capped at ARCHIVE_ENTRY_MAX_MB
+func (h *FileManagerHandler) ArchiveExtractOne(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	path := c.Query("path")
+	entry := c.Query("entry")
+	if storage == "" || path == "" || entry == "" {
+		return badRequest(c, "storage, path and entry are required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	rc, info, err := h.service.OpenArchiveEntry(storage, path, entry)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	c.Set("Content-Disposition", "attachment; filename="+filepath.Base(info.Name))
+	c.Set("Content-Type", domain.ContentTypeFor(filepath.Ext(info.Name)))
+	// Length unknown up front: the header's size isn't trusted, the cap is enforced while streaming
+	c.Response().SetBodyStream(rc, -1)
+	return nil
+}
+
+// accelRedirect hands the transfer to nginx when ACCEL_REDIRECT_PREFIX is
+// set: the response carries only headers, and nginx serves the file (Range
+// included) from its internal location. Reports whether it took over.
+func (h *FileManagerHandler) accelRedirect(c *fiber.Ctx, storage, path, contentType string) bool {
+	location, ok := h.service.AccelRedirectPath(storage, path)
+	if !ok {
+		return false
+	}
+	c.Set("X-Accel-Redirect", location)
+	c.Set("Content-Type", contentType)
+	c.Status(fiber.StatusOK)
+	return true
+}
+
+// Filters shared by search and count: storage (or "all"), ext, exclude_ext, days, q.
+// "all" covers the searchable storages the caller may use; others must be named explicitly.
+func (h *FileManagerHandler) searchFilterFromQuery(c *fiber.Ctx) app.SearchFilter {
+	var filter app.SearchFilter
+	if storage := c.Query("storage"); storage != "all" {
+		filter.Storages = []string{storage}
+	} else {
+		filter.Storages = middleware.FilterStorages(c, h.service.SearchableStorages())
+	}
+	if extParam := c.Query("ext"); extParam != "" {
+		filter.Extensions = strings.Split(extParam, ",")
+	}
+	if excludeParam := c.Query("exclude_ext"); excludeParam != "" {
+		filter.ExcludeExtensions = strings.Split(excludeParam, ",")
+	}
+	filter.Days = c.QueryInt("days", 0)
+	filter.Name = c.Query("q")
+	filter.Query = c.Query("query")
+	return filter
+}
+
+// GET /api/search?storage=ssd&ext=jpg,png&exclude_ext=tmp&query=beach+2021&limit=40&offset=0
+func (h *FileManagerHandler) SearchFiles(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage required")
+	}
+
+	filter := h.searchFilterFromQuery(c)
+	limit := c.QueryInt("limit", 0)
+	offset := c.QueryInt("offset", 0)
+
+	// Not indexed yet: walk the disk within the time budget instead
+	if h.service.NeedsLiveSearch(filter) {
+		done := middleware.Phase(c, "fs")
+		res, err := h.service.LiveSearch(filter, limit, offset)
+		done()
+		if err != nil {
+			return sendError(c, 500, err)
+		}
+
+		defer middleware.Phase(c, "encode")()
+		if wantsHuman(c) {
+			res.Files = h.humanizeFiles(res.Files)
+		}
+		return c.JSON(fiber.Map{
+			"files":      res.Files,
+			"total":      res.Total,
+			"limit":      limit,
+			"offset":     offset,
+			"days":       filter.Days,
+			"source":     "live",
+			"partial":    res.Partial,
+			"elapsed_ms": res.Elapsed.Milliseconds(),
+		})
+	}
+
+	done := middleware.Phase(c, "index")
+	files, total := h.service.SearchIndexedFiles(filter, limit, offset)
+	done()
+
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		files = h.humanizeFiles(files)
+	}
+	return c.JSON(fiber.Map{
+		"files":  files,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"days":   filter.Days,
+	})
+}
+
+// GET /api/count?storage=ssd&ext=jpg&days=30&q=beach
+// storage=all counts across every storage
+func (h *FileManagerHandler) CountFiles(c *fiber.Ctx) error {
+	if c.Query("storage") == "" {
+		return badRequest(c, "storage required")
+	}
+
+	done := middleware.Phase(c, "index")
+	count := h.service.CountIndexedFiles(h.searchFilterFromQuery(c))
+	done()
+
+	return c.JSON(fiber.Map{
+		"count": count,
 	})
 }
 
-// GET /api/download?storage=ssd1&path=/some/file.txt
-func (h *FileManagerHandler) DownloadFile(c *fiber.Ctx) error {
-	storage := c.Query("storage")
-	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage parameter is required",
-		})
+// GET /api/category?storage=ssd&category=video&limit=40&offset=0
+// Indexed search over a named category's extensions; days and q still apply
+func (h *FileManagerHandler) ListCategory(c *fiber.Ctx) error {
+	if c.Query("storage") == "" {
+		return badRequest(c, "storage required")
 	}
 
-	path := c.Query("path")
-	if path == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "path is required",
-		})
+	name, exts, ok := h.service.CategoryExtensions(c.Query("category"))
+	if !ok {
+		categories := make([]string, 0)
+		for category := range h.service.Categories() {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		return apiError(c, 400, "", "unknown category", fiber.Map{"categories": categories})
 	}
 
-	fullPath, err := h.service.GetRealPath(storage, path)
-	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "file not found"})
+	filter := h.searchFilterFromQuery(c)
+	filter.Extensions = exts
+	limit := c.QueryInt("limit", 40)
+	offset := c.QueryInt("offset", 0)
+
+	done := middleware.Phase(c, "index")
+	files, total := h.service.SearchIndexedFiles(filter, limit, offset)
+	done()
+
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		files = h.humanizeFiles(files)
 	}
+	return c.JSON(fiber.Map{
+		"category":   name,
+		"extensions": exts,
+		"files":      files,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
 
-	file, err := os.Stat(fullPath)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "failed to stat file"})
+// GET /api/recent?storage=ssd&limit=50&offset=0
+func (h *FileManagerHandler) GetRecent(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage required")
 	}
 
-	// Force set Content-Length for faster downloads and progress tracking on mobile devices
-	c.Set("Content-Length", fmt.Sprintf("%d", file.Size()))
-	c.Set("Content-Disposition", "attachment; filename="+filepath.Base(path))
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+	done := middleware.Phase(c, "index")
+	files := h.service.GetRecentFiles(storage, limit, offset)
+	done()
 
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".jpg", ".jpeg":
-		c.Set("Content-Type", "image/jpeg")
-	case ".png":
-		c.Set("Content-Type", "image/png")
-	case ".mp4":
-		c.Set("Content-Type", "video/mp4")
-	case ".pdf":
-		c.Set("Content-Type", "application/pdf")
-	case ".txt":
-		c.Set("Content-Type", "text/plain")
-	default:
-		c.Set("Content-Type", "application/octet-stream")
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		files = h.humanizeFiles(files)
 	}
-
-	return c.SendFile(fullPath)
+	return c.JSON(fiber.Map{
+		"files":  files,
+		"limit":  limit,
+		"offset": offset,
+	})
 }
 
-// GET /api/preview?storage=ssd&path=/image.jpg
-func (h *FileManagerHandler) PreviewFile(c *fiber.Ctx) error {
+// GET /api/changes?storage=ssd&since=2024-05-01T00:00:00Z&limit=500
+// Files/folders modified after since, oldest first; pass the returned
+// cursor (instead of since) to get the next page or to poll for new changes
+func (h *FileManagerHandler) Changes(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage parameter is required",
-		})
+		return badRequest(c, "storage required")
 	}
 
-	path := c.Query("path")
-	if path == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "path is required",
-		})
+	cursor := c.Query("cursor")
+	var since time.Time
+	if cursor == "" {
+		raw := c.Query("since")
+		if raw == "" {
+			return badRequest(c, "since or cursor required")
+		}
+		var err error
+		if since, err = parseSince(raw); err != nil {
+			return badRequest(c, "since must be RFC 3339 or unix seconds")
+		}
 	}
 
-	fullPath, err := h.service.GetRealPath(storage, path)
-	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "file not found",
-		})
+	limit := c.QueryInt("limit", 500)
+	if limit <= 0 || limit > 5000 {
+		limit = 500
 	}
 
-	// Inline preview in browser
-	c.Set("Content-Disposition", "inline; filename="+filepath.Base(path))
+	done := middleware.Phase(c, "index")
+	files, next, hasMore, err := h.service.Changes(storage, since, cursor, limit)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
 
-	// Auto-detect Content-Type
-	ext := strings.ToLower(filepath.Ext(path))
-	isThumb := c.Query("thumb") == "true"
-
-	switch ext {
-	case ".jpg", ".jpeg":
-		c.Set("Content-Type", "image/jpeg")
-	case ".png":
-		c.Set("Content-Type", "image/png")
-	case ".gif":
-		c.Set("Content-Type", "image/gif")
-	case ".webp":
-		c.Set("Content-Type", "image/webp")
-	case ".mp4", ".mkv", ".webm", ".mov", ".avi":
-		if isThumb {
-			// Video thumbnail generation
-			thumb, err := h.service.GetVideoThumbnail(fullPath)
-			if err == nil {
-				c.Set("Content-Type", "image/jpeg")
-				return c.Send(thumb)
-			}
-		}
-		// Full video stream
-		c.Set("Content-Type", "video/mp4")
-	case ".mp3":
-		c.Set("Content-Type", "audio/mpeg")
-	case ".pdf":
-		c.Set("Content-Type", "application/pdf")
-	case ".txt":
-		c.Set("Content-Type", "text/plain")
-	default:
-		c.Set("Content-Type", "application/octet-stream")
+	defer middleware.Phase(c, "encode")()
+	if wantsHuman(c) {
+		files = h.humanizeFiles(files)
 	}
+	return c.JSON(fiber.Map{
+		"files":    files,
+		"cursor":   next,
+		"has_more": hasMore,
+		"limit":    limit,
+	})
+}
 
-	return c.SendFile(fullPath)
+// parseSince accepts an RFC 3339 timestamp or unix seconds
+func parseSince(raw string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
 }
 
-// GET /api/search?storage=ssd&ext=jpg,png&limit=40&offset=0
-func (h *FileManagerHandler) SearchFiles(c *fiber.Ctx) error {
+// GET /api/composition?storage=ssd
+// Zero-config breakdown by MIME class for a default dashboard chart
+func (h *FileManagerHandler) Composition(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "storage required"})
+		return badRequest(c, "storage required")
 	}
 
-	extParam := c.Query("ext")
-	var extensions []string
-	if extParam != "" {
-		extensions = strings.Split(extParam, ",")
+	done := middleware.Phase(c, "index")
+	classes, err := h.service.Composition(storage)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
 	}
 
-	limit := c.QueryInt("limit", 0)
-	offset := c.QueryInt("offset", 0)
-	days := c.QueryInt("days", 0)
-
-	files, total := h.service.SearchIndexedFiles(storage, extensions, limit, offset, days)
-
+	totalCount, totalSize := 0, int64(0)
+	for _, cl := range classes {
+		totalCount += cl.Count
+		totalSize += cl.Size
+	}
 	return c.JSON(fiber.Map{
-		"files":  files,
-		"total":  total,
-		"limit":  limit,
-		"offset": offset,
-		"days":   days,
+		"storage":     storage,
+		"classes":     classes,
+		"total_count": totalCount,
+		"total_size":  totalSize,
 	})
 }
 
-// GET /api/recent?storage=ssd&limit=50&offset=0
-func (h *FileManagerHandler) GetRecent(c *fiber.Ctx) error {
+// GET /api/duplicates?storage=ssd&limit=50
+func (h *FileManagerHandler) FindDuplicates(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "storage required"})
+		return badRequest(c, "storage required")
 	}
 
-	limit := c.QueryInt("limit", 20)
-	offset := c.QueryInt("offset", 0)
-	files := h.service.GetRecentFiles(storage, limit, offset)
+	limit := c.QueryInt("limit", 50)
+	done := middleware.Phase(c, "index")
+	groups, err := h.service.FindDuplicates(storage, limit)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
 
 	return c.JSON(fiber.Map{
-		"files":  files,
+		"groups": groups,
 		"limit":  limit,
-		"offset": offset,
 	})
 }
 
-// GET /api/reindex
+// GET /api/reindex?full=true
 func (h *FileManagerHandler) Reindex(c *fiber.Ctx) error {
-	go h.service.ReindexAll()
+	go h.service.ReindexAll(c.QueryBool("full", false))
 	return c.JSON(fiber.Map{
 		"message": "Reindexing started in background",
 	})
 }
 
-// POST /api/stats
+// GET /api/index/status
+func (h *FileManagerHandler) IndexStatus(c *fiber.Ctx) error {
+	statuses := h.service.IndexStatus()
+	visible := statuses[:0]
+	for _, st := range statuses {
+		if middleware.StorageAllowed(c, st.Storage) {
+			if st.LastErr != nil {
+				// The scan logged the detail when it failed
+				apiErr := publicError(nil, 500, st.LastErr)
+				st.LastErrorCode, st.LastError = apiErr.Code, apiErr.Message
+			}
+			visible = append(visible, st)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"storages": visible,
+	})
+}
+
+// POST /api/index/optimize (admin)
+// VACUUM + ANALYZE the index database; index writes wait meanwhile
+func (h *FileManagerHandler) OptimizeIndex(c *fiber.Ctx) error {
+	done := middleware.Phase(c, "index")
+	res, err := h.service.OptimizeIndex()
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(res)
+}
+
+// POST /api/stats?storage=ssd&others_breakdown=true&others_top=10
 // Body: { "photos": ["jpg","png"], "videos": ["mp4"] }
 func (h *FileManagerHandler) GetStats(c *fiber.Ctx) error {
 	var req map[string][]string
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid body"})
+		return badRequest(c, "invalid body")
 	}
 
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "storage required"})
+		return badRequest(c, "storage required")
 	}
 
-	stats := make(map[string]int)
-	totalFiles := 0
-	sumKnown := 0
-
-	// Get total file count first
-	_, totalFiles = h.service.SearchIndexedFiles(storage, []string{}, 0, 0, 0)
-
+	known := make(map[string][]string)
 	for category, exts := range req {
-		if category == "others" {
-			continue
+		if category != "others" {
+			known[category] = exts
 		}
-		_, count := h.service.SearchIndexedFiles(storage, exts, 0, 0, 0)
-		stats[category] = count
-		sumKnown += count
 	}
+	// No categories in the body: use the server's definitions (plus others)
+	if len(known) == 0 {
+		known = h.service.Categories()
+		if req == nil {
+			req = make(map[string][]string)
+		}
+		req["others"] = nil
+	}
+
+	done := middleware.Phase(c, "index")
+	categoryStats, totalFiles, err := h.service.CategoryStats(storage, known)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+
+	stats := make(map[string]int)
+	sumKnown := 0
+	for _, st := range categoryStats {
+		stats[st.Name] = st.Count
+		sumKnown += st.Count
+	}
+
+	response := fiber.Map{}
 
 	// Calculate others
 	if _, ok := req["others"]; ok {
@@ -333,32 +1358,38 @@ func (h *FileManagerHandler) GetStats(c *fiber.Ctx) error {
 		if stats["others"] < 0 {
 			stats["others"] = 0
 		}
+
+		// Opt-in: which extensions make up "others"
+		if c.QueryBool("others_breakdown", false) {
+			breakdown, err := h.service.UncategorizedExtensions(storage, known, c.QueryInt("others_top", 10))
+			if err != nil {
+				return sendError(c, 500, err)
+			}
+			response["others_breakdown"] = breakdown
+		}
 	}
 
-	return c.JSON(fiber.Map{
-		"stats": stats,
-	})
+	response["stats"] = stats
+	return c.JSON(response)
 }
 
 // PUT /api/rename
 func (h *FileManagerHandler) RenameOrMove(c *fiber.Ctx) error {
 	var req domain.RenameRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+		return badRequest(c, "invalid request body")
 	}
 
 	if req.Storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage is required",
-		})
+		return badRequest(c, "storage is required")
+	}
+
+	if err := h.normalizePaths(&req.OldPath, &req.NewPath); err != nil {
+		return sendError(c, 400, err)
 	}
 
 	if err := h.service.RenameOrMove(req.Storage, req.OldPath, req.NewPath); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return sendError(c, 500, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -367,26 +1398,206 @@ func (h *FileManagerHandler) RenameOrMove(c *fiber.Ctx) error {
 	})
 }
 
+// POST /api/swap
+// Body: { "storage": "ssd1", "path_a": "/live.cfg", "path_b": "/staged.cfg" }
+func (h *FileManagerHandler) Swap(c *fiber.Ctx) error {
+	var req domain.SwapRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+	if req.Storage == "" || req.PathA == "" || req.PathB == "" {
+		return badRequest(c, "storage, path_a and path_b are required")
+	}
+	if err := h.normalizePaths(&req.PathA, &req.PathB); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	atomic, err := h.service.Swap(req.Storage, req.PathA, req.PathB)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return apiError(c, 404, "", "both paths must exist")
+		}
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"atomic":  atomic,
+	})
+}
+
+// PUT /api/describe
+// Body: { "storage": "ssd1", "path": "/a.jpg", "description": "..." }; empty text removes the note
+func (h *FileManagerHandler) Describe(c *fiber.Ctx) error {
+	var req domain.DescribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+	if req.Storage == "" || req.Path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	if err := h.service.SetDescription(req.Storage, req.Path, req.Description); err != nil {
+		return sendError(c, 500, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":     true,
+		"storage":     req.Storage,
+		"path":        req.Path,
+		"description": req.Description,
+	})
+}
+
+// POST /api/touch
+// Body: { "storage": "ssd1", "path": "/album", "mod_time": "2021-06-01T12:00:00Z", "recursive": true }
+func (h *FileManagerHandler) Touch(c *fiber.Ctx) error {
+	var req domain.TouchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body (mod_time must be RFC 3339)")
+	}
+	if req.Storage == "" || req.Path == "" {
+		return badRequest(c, "storage and path are required")
+	}
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	modTime := time.Now()
+	if req.ModTime != nil {
+		modTime = *req.ModTime
+	}
+	touched, err := h.service.Touch(req.Storage, req.Path, modTime, req.Recursive)
+	if err != nil {
+		return sendError(c, 500, err, fiber.Map{"touched": touched})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"touched":  touched,
+		"mod_time": modTime,
+	})
+}
+
+// POST /api/move
+// Body: { "storage": "ssd1", "paths": ["/a.jpg", "/b.jpg"], "destination": "/album", "on_conflict": "skip" }
+func (h *FileManagerHandler) MoveFiles(c *fiber.Ctx) error {
+	var req domain.MoveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || req.Destination == "" || len(req.Paths) == 0 {
+		return badRequest(c, "storage, paths, and destination are required")
+	}
+
+	if err := h.normalizePaths(&req.Destination); err != nil {
+		return sendError(c, 400, err)
+	}
+	for i := range req.Paths {
+		if err := h.normalizePaths(&req.Paths[i]); err != nil {
+			return sendError(c, 400, err)
+		}
+	}
+
+	onConflict, err := app.ParseConflictPolicy(req.OnConflict)
+	if err != nil {
+		return sendError(c, 400, err)
+	}
+
+	results, err := h.service.MoveFiles(req.Storage, req.Paths, req.Destination, onConflict)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return apiError(c, 400, "INVALID_DESTINATION", "destination folder not found")
+		}
+		return sendError(c, 500, err)
+	}
+	describeResults(c, results)
+
+	moved := 0
+	for _, r := range results {
+		if r.Success {
+			moved++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": moved == len(results),
+		"moved":   moved,
+		"results": results,
+	})
+}
+
+// POST /api/transaction
+// Runs mkdir/move/copy/delete steps in order; on failure the applied steps are
+// undone best-effort and the per-step report says what was rolled back.
+func (h *FileManagerHandler) Transaction(c *fiber.Ctx) error {
+	var req domain.TransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || len(req.Operations) == 0 {
+		return badRequest(c, "storage and operations are required")
+	}
+
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		if err := h.normalizePaths(&op.Path); err != nil {
+			return sendError(c, 400, err)
+		}
+		if op.Destination != "" {
+			if err := h.normalizePaths(&op.Destination); err != nil {
+				return sendError(c, 400, err)
+			}
+		}
+	}
+
+	result, err := h.service.RunTransaction(req.Storage, req.Operations)
+	if err != nil {
+		return sendError(c, 400, err)
+	}
+	describeSteps(c, result.Steps)
+	if !result.Success {
+		return c.Status(409).JSON(result)
+	}
+	return c.JSON(result)
+}
+
 // DELETE /api/delete?storage=ssd1&path=/some/file
+// &trash=true moves it into the storage's trash instead of deleting it
 func (h *FileManagerHandler) Delete(c *fiber.Ctx) error {
 	storage := c.Query("storage")
 	if storage == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "storage parameter is required",
-		})
+		return badRequest(c, "storage parameter is required")
 	}
 
 	path := c.Query("path")
 	if path == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "path is required",
+		return badRequest(c, "path is required")
+	}
+	if err := h.normalizePaths(&path); err != nil {
+		return sendError(c, 400, err)
+	}
+
+	if c.QueryBool("trash", false) {
+		id, err := h.service.Trash(storage, path)
+		if err != nil {
+			return sendError(c, 500, err)
+		}
+		return c.JSON(fiber.Map{
+			"success":  true,
+			"message":  "moved to trash",
+			"storage":  storage,
+			"path":     path,
+			"trash_id": id,
 		})
 	}
 
 	if err := h.service.Delete(storage, path); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return sendError(c, 500, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -397,19 +1608,109 @@ func (h *FileManagerHandler) Delete(c *fiber.Ctx) error {
 	})
 }
 
+// POST /api/delete/batch
+// Body: { "storage": "ssd1", "paths": ["/a.jpg", "/b.jpg"] }; per-path results
+func (h *FileManagerHandler) DeleteBatch(c *fiber.Ctx) error {
+	var req domain.DeleteBatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || len(req.Paths) == 0 {
+		return badRequest(c, "storage and paths are required")
+	}
+	for i := range req.Paths {
+		if err := h.normalizePaths(&req.Paths[i]); err != nil {
+			return sendError(c, 400, err)
+		}
+	}
+
+	results := h.service.DeleteBatch(req.Storage, req.Paths)
+	describeResults(c, results)
+
+	deleted := 0
+	for _, r := range results {
+		if r.Success {
+			deleted++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": deleted == len(results),
+		"deleted": deleted,
+		"results": results,
+	})
+}
+
+// GET /api/trash?storage=ssd1
+func (h *FileManagerHandler) ListTrash(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+	items, err := h.service.ListTrash(storage)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"storage": storage,
+		"items":   items,
+		"total":   len(items),
+	})
+}
+
+// POST /api/trash/restore
+// Body: { "storage": "ssd1", "id": "20240101T120000.000000000" }
+func (h *FileManagerHandler) RestoreTrash(c *fiber.Ctx) error {
+	var req domain.TrashRestoreRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+	if req.Storage == "" || req.ID == "" {
+		return badRequest(c, "storage and id are required")
+	}
+
+	path, err := h.service.RestoreFromTrash(req.Storage, req.ID)
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"storage": req.Storage,
+		"path":    path,
+	})
+}
+
+// DELETE /api/trash?storage=ssd1&id=...
+// Without id the whole trash of the storage is emptied
+func (h *FileManagerHandler) PurgeTrash(c *fiber.Ctx) error {
+	storage := c.Query("storage")
+	if storage == "" {
+		return badRequest(c, "storage parameter is required")
+	}
+	if err := h.service.PurgeTrash(storage, c.Query("id")); err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
 // POST /api/copy
 func (h *FileManagerHandler) Copy(c *fiber.Ctx) error {
 	var req domain.RenameRequest // Reuse RenameRequest as it has storage, old_path (src), and new_path (dst)
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+		return badRequest(c, "invalid request body")
 	}
 
 	if req.Storage == "" || req.OldPath == "" || req.NewPath == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "storage, old_path, and new_path are required"})
+		return badRequest(c, "storage, old_path, and new_path are required")
+	}
+
+	if err := h.normalizePaths(&req.OldPath, &req.NewPath); err != nil {
+		return sendError(c, 400, err)
 	}
 
 	if err := h.service.Copy(req.Storage, req.OldPath, req.NewPath); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return sendError(c, 500, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -418,6 +1719,36 @@ func (h *FileManagerHandler) Copy(c *fiber.Ctx) error {
 	})
 }
 
+// POST /api/estimate - Space and scale of a copy/move before running it
+// Body: {"operation": "copy", "storage": "ssd", "paths": ["/a"], "destination": "/b"}
+func (h *FileManagerHandler) Estimate(c *fiber.Ctx) error {
+	var req domain.EstimateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return badRequest(c, "invalid request body")
+	}
+
+	if req.Storage == "" || req.Destination == "" || len(req.Paths) == 0 {
+		return badRequest(c, "storage, paths, and destination are required")
+	}
+
+	if err := h.normalizePaths(&req.Destination); err != nil {
+		return sendError(c, 400, err)
+	}
+	for i := range req.Paths {
+		if err := h.normalizePaths(&req.Paths[i]); err != nil {
+			return sendError(c, 400, err)
+		}
+	}
+
+	done := middleware.Phase(c, "fs")
+	result, err := h.service.Estimate(req)
+	done()
+	if err != nil {
+		return sendError(c, 500, err)
+	}
+	return c.JSON(result)
+}
+
 // POST /api/duplicate
 func (h *FileManagerHandler) Duplicate(c *fiber.Ctx) error {
 	var req struct {
@@ -425,15 +1756,19 @@ func (h *FileManagerHandler) Duplicate(c *fiber.Ctx) error {
 		Path    string `json:"path"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+		return badRequest(c, "invalid request body")
 	}
 
 	if req.Storage == "" || req.Path == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "storage and path are required"})
+		return badRequest(c, "storage and path are required")
+	}
+
+	if err := h.normalizePaths(&req.Path); err != nil {
+		return sendError(c, 400, err)
 	}
 
 	if err := h.service.Duplicate(req.Storage, req.Path); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return sendError(c, 500, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"storages-api/internal/app"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/transport/http/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ManifestHandler serves the public capability document the frontend reads
+// at load time to adapt its UI (not an API schema)
+type ManifestHandler struct {
+	cfg            *config.Config
+	service        *app.FilesystemService
+	uploadMaxBytes int
+}
+
+func NewManifestHandler(cfg *config.Config, service *app.FilesystemService, uploadMaxBytes int) *ManifestHandler {
+	return &ManifestHandler{cfg: cfg, service: service, uploadMaxBytes: uploadMaxBytes}
+}
+
+// GET /api/manifest - public, no auth. Storages are listed only for a
+// signed-in caller, and only those they may use.
+func (h *ManifestHandler) Manifest(c *fiber.Ctx) error {
+	tools := h.service.Tools()
+
+	// Names and labels only; mount paths stay private
+	storages := make([]fiber.Map, 0)
+	names := []string{}
+	if _, signedIn := c.Locals("role").(string); signedIn {
+		names = middleware.FilterStorages(c, h.service.StorageNames())
+	}
+	for _, name := range names {
+		opts := h.service.StorageOptions(name)
+		label := opts.Label
+		if label == "" {
+			label = name
+		}
+		// Empty write_prefixes = the whole storage is writable
+		storages = append(storages, fiber.Map{
+			"name":           name,
+			"label":          label,
+			"write_prefixes": opts.WritePrefixes,
+			"searchable":     opts.IsSearchable(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"auth": fiber.Map{
+			"required": true,
+			"login":    "/api/login",
+			"scheme":   "Bearer",
+		},
+		"upload": fiber.Map{
+			"max_bytes":      h.uploadMaxBytes,
+			"max_concurrent": h.cfg.UploadMaxConcurrent,
+			"chunked":        true, // POST /api/upload/init, max_bytes applies per chunk
+		},
+		"fetch": fiber.Map{
+			"max_bytes":       h.cfg.FetchMaxBytes,
+			"timeout_seconds": h.cfg.FetchTimeoutSeconds,
+		},
+		"preview": fiber.Map{
+			"video_thumbnails":       tools[app.ToolFFmpeg],
+			"image_thumbnails":       true,
+			"image_inline_max_bytes": h.cfg.PreviewImageInlineMaxBytes,
+			"text_max_lines":         h.cfg.PreviewTextMaxLines,
+		},
+		"list_max_entries": h.cfg.ListMaxEntries,
+		"size_units":       sizeUnits(h.cfg.SizeUnitsBinary),
+		"storages":         storages,
+		"categories":       h.service.Categories(),
+		"hash_algorithms":  app.HashAlgorithms(),
+		"features": fiber.Map{
+			"duplicates":    h.cfg.IndexHashEnabled,
+			"transactions":  true,
+			"server_timing": true,
+			"logs_stream":   true,
+		},
+	})
+}
+
+func sizeUnits(binary bool) string {
+	if binary {
+		return "binary"
+	}
+	return "decimal"
+}
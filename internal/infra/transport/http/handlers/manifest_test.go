@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"storages-api/internal/config"
+	"storages-api/internal/infra/transport/http/middleware"
+	"testing"
+)
+
+func TestManifestListsStoragesOnlyToSignedInCallers(t *testing.T) {
+	e := newTestEnv(t, func(cfg *config.Config) { cfg.StorageMounts["hdd"] = t.TempDir() })
+	auth := NewAuthHandler(e.cfg, e.service)
+	e.app.Post("/api/login", auth.Login)
+	manifest := NewManifestHandler(e.cfg, e.service, 1<<20)
+	e.app.Get("/api/manifest", middleware.OptionalAuth(e.cfg, middleware.AuthMiddleware(e.cfg, e.service.TokenRevoked)), manifest.Manifest)
+	if _, err := e.cfg.Users.Add("bob", "bob password", []string{"hdd"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	storages := func(token string) (int, []string) {
+		req := httptest.NewRequest("GET", "/api/manifest", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, body := e.do(t, req)
+		var m struct {
+			Storages []struct {
+				Name string `json:"name"`
+			} `json:"storages"`
+		}
+		json.Unmarshal(body, &m)
+		names := []string{}
+		for _, s := range m.Storages {
+			names = append(names, s.Name)
+		}
+		return resp.StatusCode, names
+	}
+
+	if status, names := storages(""); status != 200 || len(names) != 0 {
+		t.Errorf("anonymous: status %d, storages %v; want 200 and none", status, names)
+	}
+	token := loginResponse(t, e, "bob", "bob password").Token
+	if status, names := storages(token); status != 200 || len(names) != 1 || names[0] != "hdd" {
+		t.Errorf("bob: status %d, storages %v; want 200 and [hdd]", status, names)
+	}
+	if status, _ := storages("not-a-token"); status != 401 {
+		t.Errorf("bad token: status %d, want 401", status)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMoveFilesDestinationErrors(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.app.Post("/api/move", e.files.MoveFiles)
+	e.writeFile(t, "a.txt", "a")
+	e.writeFile(t, "file.txt", "x")
+
+	tests := []struct {
+		destination string
+		status      int
+		code        string
+	}{
+		{"/file.txt", 400, "NOT_A_FOLDER"},
+		{"/missing", 400, "INVALID_DESTINATION"},
+	}
+	for _, tt := range tests {
+		body := `{"storage":"ssd","paths":["/a.txt"],"destination":"` + tt.destination + `"}`
+		req := httptest.NewRequest("POST", "/api/move", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, respBody := e.do(t, req)
+		if resp.StatusCode != tt.status || bodyCode(respBody) != tt.code {
+			t.Errorf("destination %s: %d %s, want %d %s", tt.destination, resp.StatusCode, respBody, tt.status, tt.code)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errInvalidPath   = errors.New("invalid path: '..' segments are not allowed")
+	errTrailingSlash = errors.New("invalid path: a trailing '/' is not allowed")
+)
+
+// normalizePath canonicalizes a client path so equivalent spellings
+// ("folder", "/folder/", "./folder", "//folder") share cache keys and index
+// paths. The result always starts with "/" and never ends with one (except
+// the root). With rejectTrailingSlash "/folder/" is refused instead of
+// mapped to "/folder". Spaces are part of the name and left alone.
+func normalizePath(p string, rejectTrailingSlash bool) (string, error) {
+	p = filepath.ToSlash(p)
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", errInvalidPath
+		}
+	}
+	if rejectTrailingSlash && len(p) > 1 && strings.HasSuffix(p, "/") {
+		return "", errTrailingSlash
+	}
+	return filepath.Clean("/" + p), nil
+}
+
+// normalizePaths normalizes each path in place
+func (h *FileManagerHandler) normalizePaths(paths ...*string) error {
+	for _, p := range paths {
+		clean, err := normalizePath(*p, h.rejectTrailingSlash)
+		if err != nil {
+			return err
+		}
+		*p = clean
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"storages-api/internal/config"
+	"testing"
+)
+
+func TestNormalizePathCanonicalForms(t *testing.T) {
+	groups := map[string][]string{
+		"/":              {"", "/", ".", "./", "//", "/."},
+		"/folder":        {"folder", "/folder", "/folder/", "./folder", "//folder", "/./folder", "folder//"},
+		"/a/b":           {"a/b", "/a/b/", "a//b", "/a/./b", "./a/b/."},
+		"/ spaced name ": {" spaced name ", "/ spaced name /"},
+		"/...":           {"...", "/.../"},
+		"/..hidden":      {"..hidden"},
+	}
+	for want, inputs := range groups {
+		for _, in := range inputs {
+			got, err := normalizePath(in, false)
+			if err != nil || got != want {
+				t.Errorf("normalizePath(%q) = %q, %v; want %q", in, got, err, want)
+			}
+		}
+	}
+	for _, in := range []string{"..", "../x", "/a/../b", "a/..", "/a/../../etc"} {
+		if _, err := normalizePath(in, false); err != errInvalidPath {
+			t.Errorf("normalizePath(%q) err = %v, want errInvalidPath", in, err)
+		}
+	}
+}
+
+func TestNormalizePathRejectTrailingSlash(t *testing.T) {
+	for in, wantErr := range map[string]bool{"/": false, "": false, "/folder": false, "folder": false, "/folder/": true, "a/b//": true} {
+		_, err := normalizePath(in, true)
+		if (err == errTrailingSlash) != wantErr {
+			t.Errorf("normalizePath(%q, reject) err = %v, want rejected %v", in, err, wantErr)
+		}
+	}
+}
+
+func TestEquivalentPathsStatTheSameFile(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.writeFile(t, "docs/a.txt", "a")
+	e.app.Get("/api/stat", e.files.Stat)
+	for _, p := range []string{"docs/a.txt", "/docs/a.txt", "./docs//a.txt", "/docs/a.txt/"} {
+		resp, body := e.do(t, httptest.NewRequest("GET", "/api/stat?storage=ssd&path="+p, nil))
+		if resp.StatusCode != 200 {
+			t.Errorf("stat %q: status %d: %s", p, resp.StatusCode, body)
+		}
+	}
+
+	strict := newTestEnv(t, func(cfg *config.Config) { cfg.RejectTrailingSlash = true })
+	strict.writeFile(t, "docs/a.txt", "a")
+	strict.app.Get("/api/stat", strict.files.Stat)
+	if resp, _ := strict.do(t, httptest.NewRequest("GET", "/api/stat?storage=ssd&path=/docs/a.txt/", nil)); resp.StatusCode != 400 {
+		t.Errorf("trailing slash with reject: status %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+)
+
+// previewEnv mounts the preview route on a fresh test env
+func previewEnv(t *testing.T, configure func(cfg *config.Config)) *testEnv {
+	e := newTestEnv(t, configure)
+	e.app.Get("/api/preview", e.files.PreviewFile)
+	return e
+}
+
+func TestPreviewVideoContentType(t *testing.T) {
+	types := map[string]string{
+		".mp4":  "video/mp4",
+		".m4v":  "video/x-m4v",
+		".mkv":  "video/x-matroska",
+		".webm": "video/webm",
+		".mov":  "video/quicktime",
+		".avi":  "video/x-msvideo",
+		".MKV":  "video/x-matroska",
+	}
+	e := previewEnv(t, nil)
+	content := strings.Repeat("0123456789", 10)
+	for ext, want := range types {
+		t.Run(ext, func(t *testing.T) {
+			e.writeFile(t, "clip"+ext, content)
+			req := httptest.NewRequest("GET", "/api/preview?storage=ssd&path=/clip"+ext, nil)
+			req.Header.Set("Range", "bytes=10-19")
+			resp, body := e.do(t, req)
+			if resp.StatusCode != 206 {
+				t.Fatalf("status = %d, want 206: %s", resp.StatusCode, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != want {
+				t.Errorf("Content-Type = %q, want %q", ct, want)
+			}
+			if string(body) != content[10:20] {
+				t.Errorf("body = %q, want %q", body, content[10:20])
+			}
+		})
+	}
+}
+
+func TestPreviewTextHead(t *testing.T) {
+	e := previewEnv(t, func(cfg *config.Config) { cfg.PreviewTextMaxLines = 2 })
+	e.writeFile(t, "long.log", "one\ntwo\nthree\n")
+	e.writeFile(t, "short.log", "one\n")
+	tests := []struct {
+		path, body, truncated string
+	}{
+		{"/long.log", "one\ntwo\n", "true"},
+		{"/short.log", "one\n", "false"},
+	}
+	for _, tt := range tests {
+		resp, body := e.do(t, httptest.NewRequest("GET", "/api/preview?storage=ssd&path="+tt.path, nil))
+		if resp.StatusCode != 200 || string(body) != tt.body {
+			t.Errorf("%s: status %d, body %q; want 200, %q", tt.path, resp.StatusCode, body, tt.body)
+		}
+		if got := resp.Header.Get("X-Preview-Truncated"); got != tt.truncated {
+			t.Errorf("%s: X-Preview-Truncated = %q, want %q", tt.path, got, tt.truncated)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("%s: Content-Type = %q", tt.path, ct)
+		}
+	}
+}
+
+func TestPreviewAudioMidFileRange(t *testing.T) {
+	types := map[string]string{
+		".mp3":  "audio/mpeg",
+		".flac": "audio/flac",
+		".ogg":  "audio/ogg",
+		".opus": "audio/ogg",
+		".wav":  "audio/wav",
+		".m4a":  "audio/mp4",
+		".aac":  "audio/aac",
+	}
+	e := previewEnv(t, nil)
+	content := strings.Repeat("abcdefghij", 1000)
+	for ext, want := range types {
+		t.Run(ext, func(t *testing.T) {
+			e.writeFile(t, "track"+ext, content)
+			req := httptest.NewRequest("GET", "/api/preview?storage=ssd&path=/track"+ext, nil)
+			req.Header.Set("Range", "bytes=5000-5099")
+			resp, body := e.do(t, req)
+			if resp.StatusCode != 206 {
+				t.Fatalf("status = %d, want 206: %s", resp.StatusCode, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != want {
+				t.Errorf("Content-Type = %q, want %q", ct, want)
+			}
+			if got := resp.Header.Get("Content-Range"); got != "bytes 5000-5099/10000" {
+				t.Errorf("Content-Range = %q", got)
+			}
+			if resp.Header.Get("Accept-Ranges") != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", resp.Header.Get("Accept-Ranges"))
+			}
+			if string(body) != content[5000:5100] {
+				t.Errorf("body = %q, want %q", body, content[5000:5100])
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Download managers split a file into several Range requests sent in
+// parallel. Each response reads its own slice through an io.SectionReader
+// (ReadAt, no shared file offset) from the handle the request already opened
+// and stat'ed, so concurrent slices never interfere.
+
+// sectionFile streams a slice of f and closes f once the response is written
+type sectionFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s sectionFile) Close() error {
+	return s.f.Close()
+}
+
+// Several ranges in one request are answered as multipart/byteranges; past
+// maxRanges the whole file is cheaper for both sides.
+const maxRanges = 16
+
+type byteRange struct {
+	start, length int64
+}
+
+// parseByteRanges resolves "bytes=a-b", "bytes=a-" and "bytes=-n" specs,
+// comma separated, against size. ok is false for headers that are ignored
+// (not bytes, malformed, too many ranges) so the whole file is sent. Ranges
+// past the end of the file are dropped; none left means 416.
+func parseByteRanges(header string, size int64) (ranges []byteRange, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found {
+		return nil, false
+	}
+	specs := strings.Split(spec, ",")
+	if len(specs) > maxRanges {
+		return nil, false
+	}
+	for _, one := range specs {
+		r, valid, satisfiable := parseOneRange(strings.TrimSpace(one), size)
+		if !valid {
+			return nil, false
+		}
+		if satisfiable {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges, true
+}
+
+func parseOneRange(spec string, size int64) (r byteRange, valid, satisfiable bool) {
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return r, false, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return r, false, false
+		}
+		if n == 0 || size == 0 {
+			return r, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{size - n, n}, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return r, false, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return r, false, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return r, true, false
+	}
+	return byteRange{start, end - start + 1}, true, true
+}
+
+// multipartFile streams the parts of a multipart/byteranges body and closes
+// f once the response is written
+type multipartFile struct {
+	io.Reader
+	f *os.File
+}
+
+func (m multipartFile) Close() error {
+	return m.f.Close()
+}
+
+// byteRangesBody builds the multipart/byteranges body for ranges of f and
+// returns it with its exact length
+func byteRangesBody(f *os.File, ranges []byteRange, size int64, contentType, boundary string) (io.Reader, int64) {
+	var readers []io.Reader
+	var length int64
+	for i, r := range ranges {
+		head := fmt.Sprintf("--%s\r\nContent-Type: %s\r\nContent-Range: bytes %d-%d/%d\r\n\r\n",
+			boundary, contentType, r.start, r.start+r.length-1, size)
+		if i > 0 {
+			head = "\r\n" + head
+		}
+		readers = append(readers, strings.NewReader(head), io.NewSectionReader(f, r.start, r.length))
+		length += int64(len(head)) + r.length
+	}
+	tail := "\r\n--" + boundary + "--\r\n"
+	readers = append(readers, strings.NewReader(tail))
+	length += int64(len(tail))
+	return io.MultiReader(readers...), length
+}
+
+// sendFileRange answers with the whole file or the requested byte range(s)
+// and takes ownership of f. Call prepareRange first so a stale If-Range has
+// already dropped the Range header.
+func sendFileRange(c *fiber.Ctx, f *os.File, size int64, contentType string) error {
+	c.Set("Accept-Ranges", "bytes")
+	// Keep the compress middleware off: byte offsets and Content-Length must
+	// describe the file itself (SendFile does the same)
+	c.Request().Header.Del(fiber.HeaderAcceptEncoding)
+
+	ranges := []byteRange{{0, size}}
+	if header := c.Get("Range"); header != "" {
+		parsed, ok := parseByteRanges(header, size)
+		if ok {
+			ranges = parsed
+		}
+		switch {
+		case !ok:
+		case len(ranges) == 0:
+			f.Close()
+			c.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		case len(ranges) == 1:
+			c.Status(fiber.StatusPartialContent)
+			c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", ranges[0].start, ranges[0].start+ranges[0].length-1, size))
+		default:
+			boundary := fmt.Sprintf("%016x", rand.Uint64())
+			body, length := byteRangesBody(f, ranges, size, contentType, boundary)
+			c.Status(fiber.StatusPartialContent)
+			c.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+			c.Response().SetBodyStream(multipartFile{body, f}, int(length))
+			return nil
+		}
+	}
+
+	c.Set("Content-Type", contentType)
+	c.Response().SetBodyStream(sectionFile{io.NewSectionReader(f, ranges[0].start, ranges[0].length), f}, int(ranges[0].length))
+	return nil
+}
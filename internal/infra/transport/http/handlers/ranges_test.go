@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Run with -race: parallel ranged connections to one file each read their
+// own slice and put together give back the file
+func TestConcurrentRangeReadsReassemble(t *testing.T) {
+	e := conditionalEnv(t)
+	content := make([]byte, 1<<20+123)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range content {
+		content[i] = byte(rng.Uint32())
+	}
+	e.writeFile(t, "big.bin", string(content))
+
+	const parts = 32
+	chunk := (len(content) + parts - 1) / parts
+	got := make([]byte, len(content))
+	var wg sync.WaitGroup
+	for p := 0; p < parts; p++ {
+		start := p * chunk
+		end := min(start+chunk, len(content)) - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/api/download?storage=ssd&path=/big.bin", nil)
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+			resp, err := e.app.Test(req, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			want := fmt.Sprintf("bytes %d-%d/%d", start, end, len(content))
+			if resp.StatusCode != 206 || resp.Header.Get("Content-Range") != want {
+				t.Errorf("range %d-%d: status %d, Content-Range %q", start, end, resp.StatusCode, resp.Header.Get("Content-Range"))
+				return
+			}
+			if len(body) != end-start+1 {
+				t.Errorf("range %d-%d: got %d bytes", start, end, len(body))
+				return
+			}
+			copy(got[start:], body)
+		}()
+	}
+	wg.Wait()
+	if !bytes.Equal(got, content) {
+		t.Error("reassembled file differs from the original")
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"errors"
+	"storages-api/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StorageAllowed reports whether the caller may use the named storage.
+// Admins and users without a storage list may use every storage.
+func StorageAllowed(c *fiber.Ctx, storage string) bool {
+	user, ok := c.Locals("user").(config.UserAccount)
+	return !ok || user.CanAccess(storage)
+}
+
+// FilterStorages keeps the storages the caller may use
+func FilterStorages(c *fiber.Ctx, names []string) []string {
+	allowed := make([]string, 0, len(names))
+	for _, name := range names {
+		if StorageAllowed(c, name) {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
+
+// requestStorages are the storages a request names: every ?storage= value
+// plus the "storage" field of the body. The body goes through BodyParser like
+// in the handlers, so JSON, XML, form-urlencoded and multipart bodies resolve
+// to the same name the handler will act on.
+func requestStorages(c *fiber.Ctx) []string {
+	var storages []string
+	for _, v := range c.Context().QueryArgs().PeekMulti("storage") {
+		storages = append(storages, string(v))
+	}
+	if len(c.Body()) > 0 {
+		var body struct {
+			Storage string `json:"storage"`
+		}
+		if err := c.BodyParser(&body); err == nil && body.Storage != "" {
+			storages = append(storages, body.Storage)
+		}
+	}
+	return storages
+}
+
+// checkStorages runs CheckAccess for every storage the request names; "all"
+// passes through and handlers narrow it with FilterStorages
+func checkStorages(c *fiber.Ctx, cfg *config.Config, write bool) error {
+	username, _ := c.Locals("username").(string)
+	for _, storage := range requestStorages(c) {
+		if storage == "" || storage == "all" {
+			continue
+		}
+		if err := cfg.CheckAccess(username, storage, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accessError answers a CheckAccess failure with 403 and its error code
+func accessError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, config.ErrStorageReadOnly) {
+		return apiError(c, 403, "STORAGE_READ_ONLY", "you may only read this storage")
+	}
+	return apiError(c, 403, "STORAGE_FORBIDDEN", "you may not use this storage")
+}
+
+// StorageACL rejects requests naming a storage the caller may not use, in
+// the query or in the body. "all" passes through; handlers narrow it with
+// FilterStorages.
+func StorageACL(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, restricted := c.Locals("user").(config.UserAccount); !restricted {
+			return c.Next()
+		}
+		if err := checkStorages(c, cfg, false); err != nil {
+			return accessError(c, err)
+		}
+		return c.Next()
+	}
+}
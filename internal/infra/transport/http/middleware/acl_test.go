@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"storages-api/internal/config"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func testConfig() *config.Config {
+	return &config.Config{
+		JwtSecret: testSecret,
+		Users: config.NewUserStore("", map[string]config.UserAccount{
+			"bob": {Storages: []string{"ssd1"}, ReadOnlyStorages: []string{"ssd3"}},
+		}),
+	}
+}
+
+func testToken(t *testing.T, username, role string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"role":     role,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// testApp mounts the auth and ACL middleware like main does, with a read
+// route and a write route that both answer 200
+func testApp(cfg *config.Config) *fiber.App {
+	app := fiber.New()
+	notRevoked := func(string) bool { return false }
+	protected := app.Group("/api", AuthMiddleware(cfg, notRevoked), StorageACL(cfg))
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(200) }
+	protected.Get("/files", ok)
+	protected.Post("/stat", ok)
+	protected.Delete("/delete", RequireWriter(cfg), ok)
+	return app
+}
+
+// errorCode is the "code" of an error body, or "" for other responses
+func errorCode(t *testing.T, body io.Reader) string {
+	t.Helper()
+	var resp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(body)
+	json.Unmarshal(data, &resp)
+	return resp.Error.Code
+}
+
+func TestStorageACL(t *testing.T) {
+	const multipartBody = "--XX\r\nContent-Disposition: form-data; name=\"storage\"\r\n\r\nssd2\r\n--XX--\r\n"
+	tests := []struct {
+		name        string
+		user, role  string
+		method, url string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"allowed storage", "bob", RoleUser, "GET", "/api/files?storage=ssd1", "", "", 200, ""},
+		{"other storage in query", "bob", RoleUser, "GET", "/api/files?storage=ssd2", "", "", 403, "STORAGE_FORBIDDEN"},
+		{"repeated query parameter", "bob", RoleUser, "GET", "/api/files?storage=ssd1&storage=ssd2", "", "", 403, "STORAGE_FORBIDDEN"},
+		{"all", "bob", RoleUser, "GET", "/api/files?storage=all", "", "", 200, ""},
+		{"json body", "bob", RoleUser, "POST", "/api/stat", "application/json", `{"storage":"ssd2","path":"/x"}`, 403, "STORAGE_FORBIDDEN"},
+		{"json body, other key case", "bob", RoleUser, "POST", "/api/stat", "application/json", `{"STORAGE":"ssd2"}`, 403, "STORAGE_FORBIDDEN"},
+		{"form body", "bob", RoleUser, "POST", "/api/stat", "application/x-www-form-urlencoded", "storage=ssd2&path=/x", 403, "STORAGE_FORBIDDEN"},
+		{"form body, other key case", "bob", RoleUser, "POST", "/api/stat", "application/x-www-form-urlencoded", "Storage=ssd2&path=/x", 403, "STORAGE_FORBIDDEN"},
+		{"multipart body", "bob", RoleUser, "POST", "/api/stat", "multipart/form-data; boundary=XX", multipartBody, 403, "STORAGE_FORBIDDEN"},
+		{"allowed query, forbidden body", "bob", RoleUser, "POST", "/api/stat?storage=ssd1", "application/x-www-form-urlencoded", "storage=ssd2", 403, "STORAGE_FORBIDDEN"},
+		{"allowed form body", "bob", RoleUser, "POST", "/api/stat", "application/x-www-form-urlencoded", "storage=ssd1&path=/x", 200, ""},
+		{"read-only storage, read", "bob", RoleUser, "GET", "/api/files?storage=ssd3", "", "", 200, ""},
+		{"read-only storage, json write", "bob", RoleUser, "DELETE", "/api/delete", "application/json", `{"storage":"ssd3","path":"/x"}`, 403, "STORAGE_READ_ONLY"},
+		{"read-only storage, form write", "bob", RoleUser, "DELETE", "/api/delete", "application/x-www-form-urlencoded", "storage=ssd3&path=/x", 403, "STORAGE_READ_ONLY"},
+		{"writable storage, form write", "bob", RoleUser, "DELETE", "/api/delete", "application/x-www-form-urlencoded", "storage=ssd1&path=/x", 200, ""},
+		{"admin is unrestricted", "admin", RoleAdmin, "POST", "/api/stat", "application/x-www-form-urlencoded", "storage=ssd2", 200, ""},
+	}
+
+	app := testApp(testConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken(t, tt.user, tt.role))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if code := errorCode(t, resp.Body); code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
@@ -1,49 +1,153 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"storages-api/internal/config"
+	"storages-api/internal/domain"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(cfg *config.Config) fiber.Handler {
+// ParseToken verifies a login JWT's signature and expiry and returns its claims
+func ParseToken(cfg *config.Config, tokenString string) (jwt.MapClaims, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fiber.NewError(401, "invalid signing method")
+		}
+		return []byte(cfg.JwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// AuthMiddleware accepts the guest token or a login JWT whose jti revoked
+// doesn't report as logged out
+func AuthMiddleware(cfg *config.Config, revoked func(jti string) bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "missing authorization header",
-			})
+			if token := queryToken(c, cfg); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
+		if authHeader == "" {
+			return apiError(c, 401, domain.CodeUnauthorized, "missing authorization header")
 		}
 
 		// Format: "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "invalid authorization format, use: Bearer <token>",
-			})
+			return apiError(c, 401, domain.CodeUnauthorized, "invalid authorization format, use: Bearer <token>")
 		}
 
 		tokenString := parts[1]
 
+		// The guest token is a plain shared secret, not a JWT
+		if cfg.GuestToken != "" && subtle.ConstantTimeCompare([]byte(tokenString), []byte(cfg.GuestToken)) == 1 {
+			c.Locals("username", GuestUsername)
+			c.Locals("role", RoleViewer)
+			c.Locals("user", config.UserAccount{Storages: cfg.GuestStorages})
+			return c.Next()
+		}
+
 		// Verify JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(401, "invalid signing method")
-			}
-			return []byte(cfg.JwtSecret), nil
-		})
+		claims, ok := ParseToken(cfg, tokenString)
+		if !ok {
+			return apiError(c, 401, "INVALID_TOKEN", "invalid or expired token")
+		}
+		// Tokens issued before logout existed have no jti and can't be revoked
+		jti, _ := claims["jti"].(string)
+		if jti != "" && revoked(jti) {
+			return apiError(c, 401, "TOKEN_REVOKED", "token has been revoked")
+		}
 
-		if err != nil || !token.Valid {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "invalid or expired token",
-			})
+		// Expose the caller to handlers. Tokens issued before roles existed
+		// belong to the single admin account.
+		username, role := "admin", RoleAdmin
+		if u, ok := claims["username"].(string); ok && u != "" {
+			username = u
+		}
+		if r, ok := claims["role"].(string); ok && r != "" {
+			role = r
+		}
+		c.Locals("username", username)
+		c.Locals("role", role)
+		c.Locals("claims", claims)
+
+		// Non-admin accounts are re-read on every request so removing a user
+		// or narrowing their storages applies to tokens already issued
+		if role != RoleAdmin {
+			user, ok := cfg.User(username)
+			if !ok {
+				return apiError(c, 401, "INVALID_TOKEN", "invalid or expired token")
+			}
+			c.Locals("user", user)
 		}
 
 		// Token is valid, continue to handler
 		return c.Next()
 	}
 }
+
+// queryToken returns the ?token= credential when it may be used: <img>/<video>
+// tags and download managers can't set headers, so QUERY_TOKEN_ENABLED lets
+// GET requests carry it instead
+func queryToken(c *fiber.Ctx, cfg *config.Config) string {
+	if !cfg.QueryTokenEnabled || (c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead) {
+		return ""
+	}
+	return c.Query("token")
+}
+
+// OptionalAuth runs auth only for requests that carry credentials, so a
+// public route can tell signed-in callers apart; bad credentials still fail
+func OptionalAuth(cfg *config.Config, auth fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" && queryToken(c, cfg) == "" {
+			return c.Next()
+		}
+		return auth(c)
+	}
+}
+
+const (
+	RoleAdmin  = "admin"
+	RoleUser   = "user"
+	RoleViewer = "viewer" // read-only, e.g. the guest token
+)
+
+// GuestUsername is how guest-token requests appear in logs
+const GuestUsername = "guest"
+
+// RequireAdmin rejects callers whose token doesn't carry the admin role
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("role").(string); role != RoleAdmin {
+			return apiError(c, 403, domain.CodePermissionDenied, "admin role required")
+		}
+		return c.Next()
+	}
+}
+
+// RequireWriter rejects read-only (viewer) callers on endpoints that modify
+// storage, and users writing to a storage they may only read
+func RequireWriter(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("role").(string); role == RoleViewer {
+			return apiError(c, 403, "READ_ONLY_ACCESS", "this token is read-only")
+		}
+		if _, restricted := c.Locals("user").(config.UserAccount); restricted {
+			if err := checkStorages(c, cfg, true); err != nil {
+				return accessError(c, err)
+			}
+		}
+		return c.Next()
+	}
+}
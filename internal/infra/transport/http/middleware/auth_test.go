@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestQueryToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		method  string
+		status  int
+		code    string
+	}{
+		{"disabled by default", false, "GET", 401, "UNAUTHORIZED"},
+		{"GET", true, "GET", 200, ""},
+		{"HEAD", true, "HEAD", 200, ""},
+		{"POST", true, "POST", 401, "UNAUTHORIZED"},
+		{"DELETE", true, "DELETE", 401, "UNAUTHORIZED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.QueryTokenEnabled = tt.enabled
+			app := fiber.New()
+			ok := func(c *fiber.Ctx) error { return c.SendStatus(200) }
+			app.Add(tt.method, "/api/files", AuthMiddleware(cfg, func(string) bool { return false }), ok)
+
+			req := httptest.NewRequest(tt.method, "/api/files?token="+testToken(t, "admin", RoleAdmin), nil)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if code := errorCode(t, resp.Body); tt.method != "HEAD" && code != tt.code {
+				t.Errorf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestOptionalAuthQueryToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		method  string
+		status  int
+	}{
+		// A ?token= that wouldn't be honoured is ignored, not checked
+		{"disabled", false, "GET", 200},
+		{"POST", true, "POST", 200},
+		{"GET", true, "GET", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.QueryTokenEnabled = tt.enabled
+			app := fiber.New()
+			auth := AuthMiddleware(cfg, func(string) bool { return false })
+			ok := func(c *fiber.Ctx) error { return c.SendStatus(200) }
+			app.Add(tt.method, "/api/manifest", OptionalAuth(cfg, auth), ok)
+
+			resp, err := app.Test(httptest.NewRequest(tt.method, "/api/manifest?token=stale", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"storages-api/internal/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorBody is the {"error": {"code", "message"}} body of every error
+// response, plus any extra top-level fields
+func ErrorBody(apiErr *domain.APIError, extra ...fiber.Map) fiber.Map {
+	body := fiber.Map{"error": apiErr}
+	for _, m := range extra {
+		for k, v := range m {
+			body[k] = v
+		}
+	}
+	return body
+}
+
+// apiError answers with a middleware's own error; an empty code means the
+// generic one for status
+func apiError(c *fiber.Ctx, status int, code, message string, extra ...fiber.Map) error {
+	return c.Status(status).JSON(ErrorBody(domain.NewAPIError(status, code, message), extra...))
+}
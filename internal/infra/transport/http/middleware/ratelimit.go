@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"storages-api/internal/domain"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// RateLimit allows each caller perMinute requests to the route within a
+// sliding minute and answers 429 RATE_LIMITED, with Retry-After, beyond that.
+// Callers are told apart by username; guests share a token, so they are
+// counted per IP. perMinute <= 0 disables the limit.
+func RateLimit(perMinute int) fiber.Handler {
+	if perMinute <= 0 {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+	return limiter.New(limiter.Config{
+		Max:               perMinute,
+		Expiration:        time.Minute,
+		LimiterMiddleware: limiter.SlidingWindow{},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if user, _ := c.Locals("username").(string); user != "" && user != GuestUsername {
+				return "user:" + user
+			}
+			return "ip:" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return apiError(c, 429, domain.CodeRateLimited, "too many requests, retry later")
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SlowRequestLogger logs only requests slower than threshold, as warnings.
+// Elapsed time is measured from the "startTime" local set by the first middleware.
+func SlowRequestLogger(threshold time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		start, ok := c.Locals("startTime").(time.Time)
+		if !ok {
+			return err
+		}
+		elapsed := time.Since(start)
+		if elapsed < threshold {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if fe, ok := err.(*fiber.Error); ok {
+			status = fe.Code
+		}
+		storage := c.Query("storage")
+		if storage == "" {
+			storage = "-"
+		}
+		user, _ := c.Locals("username").(string)
+		if user == "" {
+			user = "-"
+		}
+		fmt.Printf("WARN slow request: %s %s storage=%s user=%s status=%d latency=%s\n",
+			c.Method(), c.Path(), storage, user, status, elapsed.Round(time.Millisecond))
+		return err
+	}
+}
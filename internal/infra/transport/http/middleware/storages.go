@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireStorages answers 503 no_storages while no mount is configured, so a
+// misconfigured server says so instead of failing each endpoint differently.
+// The mount admin endpoints and the log stream stay reachable to fix it.
+func RequireStorages(count func() int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if count() > 0 || strings.HasPrefix(c.Path(), "/api/storages") || strings.HasPrefix(c.Path(), "/api/logs") {
+			return c.Next()
+		}
+		return apiError(c, 503, "NO_STORAGES",
+			"no storage mounts are configured; set STORAGE_MOUNTS (e.g. ssd:/mnt/ssd) or register one with POST /api/storages")
+	}
+}
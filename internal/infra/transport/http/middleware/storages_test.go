@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequireStorages(t *testing.T) {
+	mounts := 0
+	app := fiber.New()
+	app.Use("/api", RequireStorages(func() int { return mounts }))
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(200) }
+	app.Get("/api/files", ok)
+	app.Get("/api/storages", ok)
+
+	tests := []struct {
+		mounts int
+		url    string
+		status int
+		code   string
+	}{
+		{0, "/api/files", 503, "NO_STORAGES"},
+		{0, "/api/storages", 200, ""},
+		{1, "/api/files", 200, ""},
+	}
+	for _, tt := range tests {
+		mounts = tt.mounts
+		resp, err := app.Test(httptest.NewRequest("GET", tt.url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%d mounts, %s: status = %d, want %d", tt.mounts, tt.url, resp.StatusCode, tt.status)
+		}
+		if code := errorCode(t, resp.Body); code != tt.code {
+			t.Errorf("%d mounts, %s: code = %q, want %q", tt.mounts, tt.url, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const timingsKey = "serverTimings"
+
+type timingPhase struct {
+	name string
+	dur  time.Duration
+}
+
+// Timings collects phase durations of one request for the Server-Timing header
+type Timings struct {
+	phases []timingPhase
+}
+
+// ServerTiming emits a Server-Timing header for every request when always is
+// set, otherwise only for requests carrying ?trace=true. Handlers add phases
+// with Phase; a total for the whole chain is always appended.
+func ServerTiming(always bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !always && !c.QueryBool("trace", false) {
+			return c.Next()
+		}
+
+		t := &Timings{}
+		c.Locals(timingsKey, t)
+		start := time.Now()
+		err := c.Next()
+		t.phases = append(t.phases, timingPhase{name: "total", dur: time.Since(start)})
+
+		c.Set("Server-Timing", t.header())
+		c.Set("Timing-Allow-Origin", "*") // let cross-origin dashboards read it
+		return err
+	}
+}
+
+// Phase starts timing a named phase (e.g. "fs", "index", "encode") and returns
+// the function that ends it. A no-op unless the request is traced.
+func Phase(c *fiber.Ctx, name string) func() {
+	t, ok := c.Locals(timingsKey).(*Timings)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.phases = append(t.phases, timingPhase{name: name, dur: time.Since(start)})
+	}
+}
+
+func (t *Timings) header() string {
+	parts := make([]string, len(t.phases))
+	for i, p := range t.phases {
+		parts[i] = fmt.Sprintf("%s;dur=%.3f", p.name, float64(p.dur.Microseconds())/1000)
+	}
+	return strings.Join(parts, ", ")
+}